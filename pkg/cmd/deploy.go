@@ -1,27 +1,35 @@
 package cmd
 
 import (
-	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
-	"github.com/Uitware/locreg/pkg/providers/aws"
-	"github.com/Uitware/locreg/pkg/providers/azure"
-	"github.com/Uitware/locreg/pkg/providers/gcp"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/Uitware/locreg/pkg/tunnels"
 	"github.com/spf13/cobra"
 	"log"
+	"strings"
+
+	// Register deployment providers
+	_ "github.com/Uitware/locreg/pkg/providers/aws"
+	_ "github.com/Uitware/locreg/pkg/providers/azure"
+	_ "github.com/Uitware/locreg/pkg/providers/gcp"
 )
 
 // deployCmd represents the deploy command
 var deployCmd = &cobra.Command{
 	Use:   "deploy [provider]",
 	Short: "Create a cloud resource and deploy your application",
-	Long:  `Create a cloud provider's serverless container runtime resource and deploy your application.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Create a cloud provider's serverless container runtime resource and deploy your application.
+Available providers: ` + strings.Join(providers.Names(), ", "),
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		provider := args[0]
+		provider, err := providers.Get(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		profile, _ := parser.LoadProfileData()
 
-		if profile.AzureCloudResource != nil {
+		if profile.HasCloudResource() {
 			log.Fatalf("❌ Cloud resource already exists. Please destroy it before deploying a new one")
 		}
 		configFilePath := "locreg.yaml"
@@ -40,15 +48,22 @@ var deployCmd = &cobra.Command{
 			}
 		}
 
-		switch provider {
-		case "aws":
-			aws.Deploy(config, envVars)
-		case "azure":
-			azure.Deploy(config, envVars)
-		case "gcp":
-			gcp.Deploy()
-		default:
-			fmt.Println("❌ Unknown provider:", provider)
+		if err := checkTunnel(config, profile); err != nil {
+			log.Fatalf("❌ Tunnel can't be used by %s: %v", args[0], err)
+		}
+		if err := provider.Validate(config); err != nil {
+			log.Fatalf("❌ Invalid configuration for %s provider: %v", args[0], err)
+		}
+		if err := provider.Deploy(config, envVars); err != nil {
+			log.Fatalf("❌ Error deploying to %s: %v", args[0], err)
+		}
+		// Providers record their resources in the profile, so it is loaded again
+		err = parser.Update(func(profile *parser.Profile) error {
+			profile.DeployedImage = config.GetRegistryImage()
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ Error saving deployed image to profile, retention may delete it: %v", err)
 		}
 	},
 }
@@ -57,3 +72,18 @@ func init() {
 	deployCmd.Flags().StringP("env", "e", "", "Path to the env file")
 	rootCmd.AddCommand(deployCmd)
 }
+
+// checkTunnel returns an error if cloud runtimes can't pull the image through the running tunnel
+func checkTunnel(config *parser.Config, profile *parser.Profile) error {
+	if profile.Tunnel == nil {
+		return nil
+	}
+	provider, err := tunnels.FromProfile(profile)
+	if err != nil {
+		return err
+	}
+	if checker, ok := provider.(tunnels.DeployChecker); ok {
+		return checker.CheckDeploy(config)
+	}
+	return nil
+}
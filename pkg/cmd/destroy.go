@@ -1,12 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/Uitware/locreg/pkg/local_registry"
 	"github.com/Uitware/locreg/pkg/parser"
-	"github.com/Uitware/locreg/pkg/providers/aws"
-	"github.com/Uitware/locreg/pkg/providers/azure"
-	"github.com/Uitware/locreg/pkg/tunnels/ngrok"
+	"github.com/Uitware/locreg/pkg/providers"
 	"github.com/spf13/cobra"
 	"log"
 )
@@ -19,6 +18,7 @@ var destroyCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		resource := args[0]
+		purge, _ := cmd.Flags().GetBool("purge")
 
 		configFilePath := "locreg.yaml"
 		config, err := parser.LoadConfig(configFilePath)
@@ -34,42 +34,29 @@ var destroyCmd = &cobra.Command{
 		switch resource {
 		case "registry":
 			if profile.LocalRegistry != nil {
-				err := local_registry.DestroyLocalRegistry()
+				err := local_registry.DestroyLocalRegistry(purge)
 				if err != nil {
 					log.Fatalf("❌ Error destroying local registry: %v", err)
 				}
-				profile.LocalRegistry = nil
-				saveProfile(profile, profilePath)
+				updateProfile(profilePath, func(profile *parser.Profile) { profile.LocalRegistry = nil })
 				fmt.Println("✅ Registry destroyed successfully")
 			}
 
 		case "tunnel":
 			if profile.Tunnel != nil {
-				err := ngrok.DestroyTunnel()
+				err := stopTunnel(config, profile)
 				if err != nil {
 					log.Fatalf("❌ Error destroying tunnel: %v", err)
 				}
-				profile.Tunnel = nil
-				saveProfile(profile, profilePath)
+				updateProfile(profilePath, func(profile *parser.Profile) { profile.Tunnel = nil })
 				fmt.Println("✅ Tunnel destroyed successfully")
 			}
 
 		case "cloud":
-			if profile.AzureCloudResource != nil {
-				azure.Destroy()
-				profile.AzureCloudResource = nil
-				saveProfile(profile, profilePath)
-				fmt.Println("✅ Cloud resources destroyed successfully")
-			}
-			if profile.AWSCloudResource != nil {
-				aws.Destroy(config)
-				profile.AWSCloudResource = nil
-				profile.Save()
-				fmt.Println("✅ Cloud resources destroyed successfully")
-			}
+			destroyCloudResources(config)
 
 		case "all":
-			destroyAllResources(profile, profilePath)
+			destroyAllResources(profile, profilePath, purge)
 			fmt.Println("✅ All resources destroyed successfully")
 
 		default:
@@ -80,10 +67,11 @@ var destroyCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(destroyCmd)
+	destroyCmd.Flags().Bool("purge", false, "Remove registry data kept in the storage volume or directory")
 }
 
 // destroyAllResources destroys all resources defined in the profile.
-func destroyAllResources(profile *parser.Profile, profilePath string) {
+func destroyAllResources(profile *parser.Profile, profilePath string, purge bool) {
 	configFilePath := "locreg.yaml"
 	config, err := parser.LoadConfig(configFilePath)
 	if err != nil {
@@ -91,43 +79,55 @@ func destroyAllResources(profile *parser.Profile, profilePath string) {
 	}
 
 	if profile.LocalRegistry != nil {
-		err := local_registry.DestroyLocalRegistry()
+		err := local_registry.DestroyLocalRegistry(purge)
 		if err != nil {
 			log.Fatalf("❌ Error destroying local registry: %v", err)
 		}
-		profile.LocalRegistry = nil
-		saveProfile(profile, profilePath)
+		updateProfile(profilePath, func(profile *parser.Profile) { profile.LocalRegistry = nil })
 		fmt.Println("✅ Registry destroyed successfully")
 	}
 
 	if profile.Tunnel != nil {
-		err := ngrok.DestroyTunnel()
+		err := stopTunnel(config, profile)
 		if err != nil {
 			log.Fatalf("❌ Error destroying tunnel: %v", err)
 		}
-		profile.Tunnel = nil
-		saveProfile(profile, profilePath)
+		updateProfile(profilePath, func(profile *parser.Profile) { profile.Tunnel = nil })
 		fmt.Println("✅ Tunnel destroyed successfully")
 	}
 
-	if profile.AzureCloudResource != nil {
-		azure.Destroy()
-		profile.AzureCloudResource = nil
-		saveProfile(profile, profilePath)
-		fmt.Println("✅ Cloud resources destroyed successfully")
-	}
+	destroyCloudResources(config)
+}
 
-	if profile.AWSCloudResource != nil {
-		aws.Destroy(config)
-		profile.AWSCloudResource = nil
-		profile.Save()
-		fmt.Println("✅ Cloud resources destroyed successfully")
+// destroyCloudResources destroys resources of every registered provider that are recorded in the profile.
+// Providers clear their resources from the profile themselves
+func destroyCloudResources(config *parser.Config) {
+	for _, name := range providers.Names() {
+		provider, err := providers.Get(name)
+		if err != nil {
+			log.Fatalf("❌ Error getting provider: %v", err)
+		}
+		err = provider.Destroy(config)
+		if errors.Is(err, providers.ErrNotDeployed) {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("❌ Error destroying %s cloud resources: %v", name, err)
+		}
+		fmt.Printf("✅ %s cloud resources destroyed successfully\n", name)
+	}
+	if profile, profilePath := parser.LoadProfileData(); profile != nil && !profile.HasCloudResource() && profile.DeployedImage != "" {
+		updateProfile(profilePath, func(profile *parser.Profile) { profile.DeployedImage = "" })
 	}
 }
 
-// saveProfile saves the profile
-func saveProfile(profile *parser.Profile, profilePath string) {
-	if err := parser.SaveProfile(profile, profilePath); err != nil {
+// updateProfile applies the update to the profile under the profile lock
+func updateProfile(profilePath string, update func(profile *parser.Profile)) {
+	err := parser.UpdateProfile(profilePath, func(profile *parser.Profile) error {
+		update(profile)
+		return nil
+	})
+	if err != nil {
 		log.Printf("❌ Error saving profile: %v", err)
 	}
 }
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage images stored in the local registry",
+	Long:  `List, inspect, delete, export and import images stored in the local registry using the credentials recorded in the profile.`,
+}
+
+var imagesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List repositories of the local registry",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, registryClient := newLocalRegistryClient()
+		repositories, err := registryClient.Catalog(ctx)
+		if err != nil {
+			log.Fatalf("❌ Error listing images: %v", err)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(writer, "REPOSITORY\tTAGS")
+		for _, repository := range repositories {
+			tags, err := registryClient.Tags(ctx, repository)
+			if err != nil {
+				log.Fatalf("❌ Error listing images: %v", err)
+			}
+			fmt.Fprintf(writer, "%s\t%d\n", repository, len(tags))
+		}
+		writer.Flush()
+	},
+}
+
+var imagesTagsCmd = &cobra.Command{
+	Use:   "tags <name>",
+	Short: "List tags of a repository in the local registry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, registryClient := newLocalRegistryClient()
+		tags, err := registryClient.Tags(ctx, args[0])
+		if err != nil {
+			log.Fatalf("❌ Error listing tags: %v", err)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+	},
+}
+
+var imagesInspectCmd = &cobra.Command{
+	Use:   "inspect <name:tag|name@digest>",
+	Short: "Show manifest, config and layers of an image in the local registry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, registryClient := newLocalRegistryClient()
+		details, err := local_registry.InspectImage(ctx, registryClient, args[0])
+		if err != nil {
+			log.Fatalf("❌ Error inspecting image: %v", err)
+		}
+		fmt.Printf("Image:      %s:%s\n", details.Repository, details.Reference)
+		fmt.Printf("Digest:     %s\n", details.Digest)
+		fmt.Printf("Media type: %s\n", details.MediaType)
+		if details.Platforms != nil {
+			fmt.Println("Platforms:")
+			for _, platform := range details.Platforms {
+				name := "unknown"
+				if platform.Platform != nil {
+					name = platform.Platform.OS + "/" + platform.Platform.Architecture
+					if platform.Platform.Variant != "" {
+						name += "/" + platform.Platform.Variant
+					}
+				}
+				fmt.Printf("  %s\t%s\n", name, platform.Digest)
+			}
+			return
+		}
+		if details.Config.Created != nil {
+			fmt.Printf("Created:    %s\n", details.Config.Created.Format("2006-01-02 15:04:05 MST"))
+		}
+		fmt.Printf("Platform:   %s/%s\n", details.Config.OS, details.Config.Architecture)
+		fmt.Printf("Size:       %s\n", local_registry.FormatSize(details.Size))
+		fmt.Println("Layers:")
+		for _, layer := range details.Layers {
+			fmt.Printf("  %s\t%s\n", layer.Digest, local_registry.FormatSize(layer.Size))
+		}
+	},
+}
+
+var imagesDeleteCmd = &cobra.Command{
+	Use:   "delete <name:tag|name@digest>...",
+	Short: "Delete images from the local registry",
+	Long: `Delete images from the local registry. Images are deleted by digest, so other tags of the same image are deleted as well.
+Deleting requires registry.config.storage.delete to be true, disk space is freed by the registry garbage collection.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, registryClient := newLocalRegistryClient()
+		for _, ref := range args {
+			digest, err := local_registry.DeleteImage(ctx, registryClient, ref)
+			if err != nil {
+				log.Fatalf("❌ Error deleting image %s: %v", ref, err)
+			}
+			fmt.Printf("✅ Deleted %s (%s)\n", ref, digest)
+		}
+	},
+}
+
+var imagesExportCmd = &cobra.Command{
+	Use:   "export <name:tag|name@digest>",
+	Short: "Export an image from the local registry to an OCI layout archive",
+	Long: `Export the image with all its platforms from the local registry to a tar archive in OCI image layout.
+The archive is annotated with the image name, so it can be imported with locreg images import, docker load or other OCI tools.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		ctx, registryClient := newLocalRegistryClient()
+		file, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("❌ Error creating archive: %v", err)
+		}
+		descriptor, err := local_registry.ExportImage(ctx, registryClient, args[0], file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(output)
+			log.Fatalf("❌ Error exporting image %s: %v", args[0], err)
+		}
+		fmt.Printf("✅ Exported %s (%s) to %s\n", args[0], descriptor.Digest, output)
+	},
+}
+
+var imagesImportCmd = &cobra.Command{
+	Use:   "import <archive> [name:tag]",
+	Short: "Import images from an OCI layout archive to the local registry",
+	Long: `Push images of a tar archive in OCI image layout to the local registry. Images are pushed under the names
+they are annotated with, like archives of locreg images export or docker save, or under name:tag if it is set.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ref := ""
+		if len(args) == 2 {
+			ref = args[1]
+		}
+		ctx, registryClient := newLocalRegistryClient()
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("❌ Error opening archive: %v", err)
+		}
+		defer file.Close()
+		imported, err := local_registry.ImportImages(ctx, registryClient, file, ref)
+		for _, image := range imported {
+			fmt.Printf("✅ Imported %s\n", image)
+		}
+		if err != nil {
+			log.Fatalf("❌ Error importing %s: %v", args[0], err)
+		}
+	},
+}
+
+var imagesCopyCmd = &cobra.Command{
+	Use:   "copy <source> [name:tag]",
+	Short: "Copy an image from a remote registry to the local registry",
+	Long: `Stream manifests and blobs of the image from a remote registry, Docker Hub if the source has no registry host,
+to the local registry. Every platform of a multi-platform image is copied unless --platform is set.
+The image is stored under name:tag, or under the source name without the registry host if it is not set.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+		platform, _ := cmd.Flags().GetString("platform")
+		image, err := local_registry.ParseRemoteReference(args[0])
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		_, target := local_registry.SplitRegistryHost(args[0])
+		if len(args) == 2 {
+			target = args[1]
+		}
+		repository, reference, err := local_registry.ParseReference(target)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		ctx, registryClient := newLocalRegistryClient()
+		source := local_registry.NewClient(image.Registry, username, password)
+		target = local_registry.FormatReference(repository, reference)
+		fmt.Printf("Copying %s to %s...\n", args[0], target)
+		descriptor, err := local_registry.CopyImage(ctx, source, image, registryClient, repository, reference, platform)
+		if err != nil {
+			log.Fatalf("❌ Error copying image %s: %v", args[0], err)
+		}
+		fmt.Printf("✅ Copied %s to %s (%s)\n", args[0], target, descriptor.Digest)
+	},
+}
+
+// newLocalRegistryClient returns a client of the local registry described in the config and the profile
+func newLocalRegistryClient() (context.Context, *local_registry.Client) {
+	config := loadDeployConfig()
+	registryClient, err := local_registry.NewLocalClient(config)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	return context.Background(), registryClient
+}
+
+func init() {
+	imagesCmd.AddCommand(imagesListCmd)
+	imagesCmd.AddCommand(imagesTagsCmd)
+	imagesCmd.AddCommand(imagesInspectCmd)
+	imagesCmd.AddCommand(imagesDeleteCmd)
+	imagesExportCmd.Flags().StringP("output", "o", "", "Path of the archive to write")
+	_ = imagesExportCmd.MarkFlagRequired("output")
+	imagesCmd.AddCommand(imagesExportCmd)
+	imagesCmd.AddCommand(imagesImportCmd)
+	imagesCopyCmd.Flags().String("username", "", "Username of the source registry, pulls anonymously if not set")
+	imagesCopyCmd.Flags().String("password", "", "Password or access token of the source registry")
+	imagesCopyCmd.Flags().String("platform", "", "Copy only the image of the platform like linux/amd64 from a multi-platform image")
+	imagesCmd.AddCommand(imagesCopyCmd)
+	rootCmd.AddCommand(imagesCmd)
+}
@@ -12,15 +12,41 @@ import (
 var pushCmd = &cobra.Command{
 	Use:   "push [directory]",
 	Short: "Build and push a container image to the local registry",
-	Long:  `Build a container image from the specified directory and push it to the local registry.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Build a container image from the specified directory, or from image.build.context if it is omitted, and push it to the local registry.
+Dockerfile, target stage, build args, labels and platform are taken from image.build in the config, the flags override them.
+Images built by other tools are pushed without building with --image, which takes an image from the local Docker daemon,
+or with --from-archive, which takes an OCI layout archive. They are pushed with the image name and tag from the config.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		source, _ := cmd.Flags().GetString("image")
+		archive, _ := cmd.Flags().GetString("from-archive")
+		if source != "" || archive != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		// Directory may be omitted when image.build.context is set in the config
+		return cobra.MaximumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		dir := args[0]
+		source, _ := cmd.Flags().GetString("image")
+		archive, _ := cmd.Flags().GetString("from-archive")
 		configFilePath := "locreg.yaml"
 		profile, _ := parser.LoadProfileData()
-		err := local_registry.BuildCommand(configFilePath, dir)
+		var err error
+		switch {
+		case source != "":
+			err = local_registry.PushImageCommand(configFilePath, source)
+		case archive != "":
+			err = local_registry.PushArchiveCommand(configFilePath, archive)
+		default:
+			dir := ""
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			err = local_registry.BuildCommand(configFilePath, dir, buildOptions(cmd))
+		}
 		if err != nil {
 			fmt.Println("❌ Error building and pushing image:", err)
+		} else if source != "" || archive != "" {
+			fmt.Println("✅ Image successfully pushed.")
 		} else {
 			fmt.Println("✅ Image successfully built and pushed.")
 		}
@@ -28,7 +54,30 @@ var pushCmd = &cobra.Command{
 	},
 }
 
+// buildOptions returns the build flags overriding image.build from the config
+func buildOptions(cmd *cobra.Command) local_registry.BuildOptions {
+	var options local_registry.BuildOptions
+	options.Dockerfile, _ = cmd.Flags().GetString("file")
+	options.Target, _ = cmd.Flags().GetString("target")
+	options.Args, _ = cmd.Flags().GetStringArray("build-arg")
+	options.Labels, _ = cmd.Flags().GetStringArray("label")
+	options.Platform, _ = cmd.Flags().GetString("platform")
+	options.NoCache, _ = cmd.Flags().GetBool("no-cache")
+	options.Pull, _ = cmd.Flags().GetBool("pull")
+	return options
+}
+
 func init() {
+	pushCmd.Flags().StringP("file", "f", "", "Path of the Dockerfile inside the build context (default \"Dockerfile\")")
+	pushCmd.Flags().String("target", "", "Stage of a multi-stage Dockerfile to build")
+	pushCmd.Flags().StringArray("build-arg", nil, "Build arg in KEY=value format, may be repeated")
+	pushCmd.Flags().StringArray("label", nil, "Image label in key=value format, may be repeated")
+	pushCmd.Flags().String("platform", "", "Platform to build the image for, like linux/amd64")
+	pushCmd.Flags().Bool("no-cache", false, "Build without using the cache")
+	pushCmd.Flags().Bool("pull", false, "Always pull base images")
+	pushCmd.Flags().String("image", "", "Push the image from the local Docker daemon instead of building it")
+	pushCmd.Flags().String("from-archive", "", "Push the image from the OCI layout archive instead of building it")
+	pushCmd.MarkFlagsMutuallyExclusive("image", "from-archive")
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.Root().CompletionOptions.DisableDefaultCmd = true
 }
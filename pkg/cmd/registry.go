@@ -1,14 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Uitware/locreg/pkg/local_registry"
 	"github.com/Uitware/locreg/pkg/parser"
-	"github.com/Uitware/locreg/pkg/tunnels/ngrok"
+	"github.com/Uitware/locreg/pkg/providers"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
-	"os/exec"
+	"time"
 )
 
 var registryCmd = &cobra.Command{
@@ -27,22 +28,21 @@ var registryCmd = &cobra.Command{
 		}
 
 		configFilePath := "locreg.yaml"
-		exePath, err := os.Executable()
+		config, err := parser.LoadConfig(configFilePath)
 		if err != nil {
-			log.Fatalf("❌ Failed to get executable path: %v", err)
+			log.Fatalf("❌ Error loading config: %v", err)
 		}
-		cmdTunnel := exec.Command(exePath, "tunnel")
 
-		err = cmdTunnel.Run()
-		if err != nil {
-			log.Fatalf("❌ Failed to run tunnel: %v.\nCheck NGROK_AUTHTOKEN env variable value", err)
+		if err := startTunnel(config); err != nil {
+			log.Fatalf("❌ Failed to run tunnel: %v", err)
 		}
 
 		if err := local_registry.InitCommand(configFilePath); err != nil {
-			err := ngrok.DestroyTunnel()
-			if err != nil {
+			profile, profilePath := parser.LoadProfileData()
+			if err := stopTunnel(config, profile); err != nil {
 				log.Fatalf("❌ error destroying tunnel: %v. \nYou need to do this manually", err)
 			}
+			updateProfile(profilePath, func(profile *parser.Profile) { profile.Tunnel = nil })
 			log.Fatalf("❌ error running registry: %v", err)
 		}
 	},
@@ -51,19 +51,309 @@ var registryCmd = &cobra.Command{
 var rotateCmd = &cobra.Command{
 	Use:   "rotate",
 	Short: "Rotate credentials of the local container registry",
-	Long:  `Rotates the credentials (username and password => token) of the local container registry.`,
+	Long: `Generate new username and password of the local container registry, apply them to the registry and record them in the profile.
+Deployed cloud resources are updated to pull with the new credentials: the Secrets Manager secret used by ECS,
+Azure App Service registry settings and Azure Container Instance registry credentials. Finally a test pull of the image is made.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		configFilePath := "locreg.yaml"
-		err := local_registry.RotateCommand(configFilePath)
+		if err := local_registry.RotateCommand(configFilePath); err != nil {
+			log.Fatalf("❌ Error rotating registry credentials: %v", err)
+		}
+		config, err := parser.LoadConfig(configFilePath)
+		if err != nil {
+			log.Fatalf("❌ Error loading config: %v", err)
+		}
+		if err := rotateDeployedCredentials(config); err != nil {
+			log.Fatalf("❌ Error updating deployed resources, they can't pull the image until fixed: %v", err)
+		}
+		if err := local_registry.VerifyPull(config); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		fmt.Println("✅ Credentials rotated successfully.")
+	},
+}
+
+// rotateDeployedCredentials updates registry credentials of resources of every provider that has them deployed
+func rotateDeployedCredentials(config *parser.Config) error {
+	var errs []error
+	for _, name := range providers.Names() {
+		provider, err := providers.Get(name)
+		if err != nil {
+			return err
+		}
+		rotator, ok := provider.(providers.CredentialRotator)
+		if !ok {
+			continue
+		}
+		err = rotator.RotateRegistryCredentials(config)
+		if errors.Is(err, providers.ErrNotDeployed) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renewPullCredentials hands new pull-only credentials to deployed resources when the current ones are about to expire,
+// otherwise cloud runtimes silently stop pulling the image once they do
+func renewPullCredentials(config *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if !local_registry.PullCredentialsExpiring(config, profile) {
+		return nil
+	}
+	log.Printf("🔄 Renewing pull credentials of deployed resources")
+	if err := rotateDeployedCredentials(config); err != nil {
+		return fmt.Errorf("❌ failed to renew pull credentials of deployed resources: %w", err)
+	}
+	return nil
+}
+
+var registryGatewayCmd = &cobra.Command{
+	Use:    "gateway",
+	Short:  "Run registry gateway in the foreground",
+	Long:   `Run the token server and the proxy in front of the local registry in the foreground. It is started in the background when token authentication is enabled.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ failed to load config: %v", err)
+		}
+		if err := local_registry.RunGateway(config); err != nil {
+			log.Fatalf("❌ Registry gateway failed: %v", err)
+		}
+	},
+}
+
+var registryServeCmd = &cobra.Command{
+	Use:    "serve",
+	Short:  "Run embedded registry in the foreground",
+	Long:   `Serve the embedded registry from the storage directory in the foreground. It is started in the background when registry.backend is embedded.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		storagePath, _ := cmd.Flags().GetString("storage")
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ failed to load config: %v", err)
+		}
+		if err := local_registry.RunEmbeddedRegistry(config, storagePath); err != nil {
+			log.Fatalf("❌ Embedded registry failed: %v", err)
+		}
+	},
+}
+
+var registryListenCmd = &cobra.Command{
+	Use:    "listen",
+	Short:  "Run registry notification listener in the foreground",
+	Long:   `Receive push events of the local registry in the foreground and redeploy cloud resources when the image from the config is pushed. It is started in the background when registry.notifications.redeploy is enabled.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := local_registry.RunNotificationListener("locreg.yaml", updateDeployedImages); err != nil {
+			log.Fatalf("❌ Notification listener failed: %v", err)
+		}
+	},
+}
+
+// updateDeployedImages points resources of every provider that has them deployed to the pushed image
+// and records it in the profile, so that retention keeps it
+func updateDeployedImages(config *parser.Config, event local_registry.PushEvent) error {
+	var errs []error
+	if err := renewPullCredentials(config); err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range providers.Names() {
+		provider, err := providers.Get(name)
+		if err != nil {
+			return err
+		}
+		updater, ok := provider.(providers.ImageUpdater)
+		if !ok {
+			continue
+		}
+		err = updater.UpdateImage(config)
+		if errors.Is(err, providers.ErrNotDeployed) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || !profile.HasCloudResource() {
+		log.Printf("Nothing is deployed, push of %s:%s is ignored", event.Repository, event.Tag)
+		return nil
+	}
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.DeployedImage = config.GetRegistryImage()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	log.Printf("✅ %s:%s (%s) is deployed", event.Repository, event.Tag, event.Digest)
+	return nil
+}
+
+var registryTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Issue pull-only credentials for the local container registry",
+	Long:  `Issue expiring credentials that can only pull the specified repositories from the local registry. Requires token authentication to be set under registry.auth.token in the config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		repositories, _ := cmd.Flags().GetStringSlice("repository")
+		expiration, _ := cmd.Flags().GetDuration("expiration")
+
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ Error loading config: %v", err)
+		}
+		if !config.IsTokenAuthEnabled() {
+			log.Fatalf("❌ Token authentication is not set under registry.auth.token in the config")
+		}
+		if len(repositories) == 0 {
+			repositories = []string{config.Image.Name}
+		}
+		profile, _ := parser.LoadProfileData()
+		if profile == nil || profile.LocalRegistry == nil {
+			log.Fatalf("❌ Local registry is not found in profile")
+		}
+		issuer, err := local_registry.LoadTokenIssuer(config)
+		if err != nil {
+			log.Fatalf("❌ Error loading token signing key: %v", err)
+		}
+		password, err := issuer.IssuePullCredential(repositories, profile.LocalRegistry.PullGeneration, expiration)
+		if err != nil {
+			log.Fatalf("❌ Error issuing pull credentials: %v", err)
+		}
+		fmt.Printf("Username: %s\nPassword: %s\n", local_registry.PullUsername, password)
+	},
+}
+
+var registryUserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage additional users of the local container registry",
+	Long: `Manage users checked by the gateway in front of the local registry. Changes are picked up on the next request,
+nothing is restarted. The gateway runs when users are set under registry.users or token authentication is enabled in the config.`,
+}
+
+var registryUserAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Add a user to the local container registry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, _ := cmd.Flags().GetString("password")
+		readOnly, _ := cmd.Flags().GetBool("read-only")
+		password, err := local_registry.AddUser(args[0], password, readOnly)
+		if err != nil {
+			log.Fatalf("❌ Error adding user: %v", err)
+		}
+		fmt.Printf("✅ User %s added\nUsername: %s\nPassword: %s\n", args[0], args[0], password)
+	},
+}
+
+var registryUserRemoveCmd = &cobra.Command{
+	Use:   "remove <username>",
+	Short: "Remove a user from the local container registry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := local_registry.RemoveUser(args[0]); err != nil {
+			log.Fatalf("❌ Error removing user: %v", err)
+		}
+		fmt.Printf("✅ User %s removed\n", args[0])
+	},
+}
+
+var registryUserListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users of the local container registry",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		users, err := local_registry.ListUsers()
+		if err != nil {
+			log.Fatalf("❌ Error listing users: %v", err)
+		}
+		for _, user := range users {
+			permissions := "pull, push"
+			if user.ReadOnly {
+				permissions = "pull"
+			}
+			fmt.Printf("%s: %s\n", user.Username, permissions)
+		}
+	},
+}
+
+var registryGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Free disk space taken by deleted images",
+	Long: `Run garbage collection of the local registry, it removes layers that are not referenced by any image.
+The registry is restarted in read-only mode for the collection, so pushes are rejected until it is finished.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteUntagged, _ := cmd.Flags().GetBool("delete-untagged")
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ Error loading config: %v", err)
+		}
+		output, err := local_registry.GarbageCollect(config, deleteUntagged)
+		fmt.Print(output)
+		if err != nil {
+			log.Fatalf("❌ Error collecting garbage: %v", err)
+		}
+		fmt.Println("✅ Garbage collection finished")
+	},
+}
+
+var registryRetentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Delete old tags according to registry.retention",
+	Long: `Delete tags that are not kept by registry.retention in the config. It is run automatically after every push.
+The configured image and the image deployed to the cloud are always kept.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ Error loading config: %v", err)
+		}
+		if !config.IsRetentionEnabled() {
+			log.Fatalf("❌ Retention is not set under registry.retention in the config")
+		}
+		registryClient, err := local_registry.NewLocalClient(config)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		profile, _ := parser.LoadProfileData()
+		deleted, err := local_registry.ApplyRetention(context.Background(), registryClient, config, profile)
+		for _, ref := range deleted {
+			fmt.Printf("🗑️ Deleted %s\n", ref)
+		}
 		if err != nil {
-			fmt.Println("❌ Error rotating registry credentials:", err)
-		} else {
-			fmt.Println("✅ Credentials rotated successfully.")
+			log.Fatalf("❌ Error applying retention: %v", err)
 		}
+		fmt.Printf("✅ %d tags deleted\n", len(deleted))
 	},
 }
 
 func init() {
+	registryGCCmd.Flags().Bool("delete-untagged", false, "Also delete images that have no tags")
+	registryCmd.AddCommand(registryGCCmd)
+	registryCmd.AddCommand(registryRetentionCmd)
+	registryUserAddCmd.Flags().String("password", "", "Password of the user, generated if not set")
+	registryUserAddCmd.Flags().Bool("read-only", false, "Allow the user only to pull images")
+	registryUserCmd.AddCommand(registryUserAddCmd)
+	registryUserCmd.AddCommand(registryUserRemoveCmd)
+	registryUserCmd.AddCommand(registryUserListCmd)
+	registryCmd.AddCommand(registryUserCmd)
+	registryTokenCmd.Flags().StringSlice("repository", nil, "Repositories that can be pulled, defaults to image name from the config")
+	registryTokenCmd.Flags().Duration("expiration", 24*time.Hour, "Time after which the credentials expire")
+	registryCmd.AddCommand(registryGatewayCmd)
+	registryServeCmd.Flags().String("storage", "", "Directory the images are stored in")
+	_ = registryServeCmd.MarkFlagRequired("storage")
+	registryCmd.AddCommand(registryServeCmd)
+	registryCmd.AddCommand(registryListenCmd)
+	registryCmd.AddCommand(registryTokenCmd)
 	registryCmd.AddCommand(rotateCmd)
 	rootCmd.AddCommand(registryCmd)
 }
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [provider]",
+	Short: "Show the state of deployed cloud resources",
+	Long: `Show the state of cloud resources deployed by locreg. If provider is omitted, all providers are checked.
+With token authentication it also shows when pull-only credentials of deployed resources expire.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadDeployConfig()
+		reportPullCredentials(config)
+		for _, name := range selectProviders(args) {
+			provider, err := providers.Get(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			status, err := provider.Status(config)
+			if errors.Is(err, providers.ErrNotDeployed) {
+				if len(args) != 0 {
+					fmt.Printf("%s: nothing is deployed\n", name)
+				}
+				continue
+			}
+			if err != nil {
+				log.Fatalf("❌ Error getting %s status: %v", name, err)
+			}
+			fmt.Printf("%s: %s\n", name, status)
+		}
+	},
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [provider]",
+	Short: "Show logs of the deployed application",
+	Long:  `Show the most recent logs of the application deployed by locreg. If provider is omitted, all providers are checked.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadDeployConfig()
+		for _, name := range selectProviders(args) {
+			provider, err := providers.Get(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			lines, err := provider.Logs(config)
+			if errors.Is(err, providers.ErrNotDeployed) {
+				continue
+			}
+			if errors.Is(err, providers.ErrNotSupported) {
+				fmt.Printf("%s: logs are not supported for the deployed resource\n", name)
+				continue
+			}
+			if err != nil {
+				log.Fatalf("❌ Error getting %s logs: %v", name, err)
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+		}
+	},
+}
+
+// reportPullCredentials prints when pull-only credentials of deployed resources expire,
+// renewing them is left to watch, deploy and registry rotate
+func reportPullCredentials(config *parser.Config) {
+	profile, _ := parser.LoadProfileData()
+	if !config.IsTokenAuthEnabled() || profile == nil || !profile.HasCloudResource() || profile.LocalRegistry == nil {
+		return
+	}
+	expiresAt := profile.LocalRegistry.PullExpiresAt
+	switch {
+	case expiresAt.IsZero():
+		fmt.Println("registry: expiration of pull credentials of deployed resources is unknown, run `locreg registry rotate` to renew them")
+	case local_registry.PullCredentialsExpiring(config, profile):
+		fmt.Printf("registry: pull credentials of deployed resources expire in %s, run `locreg registry rotate` to renew them\n",
+			time.Until(expiresAt).Round(time.Minute))
+	default:
+		fmt.Printf("registry: pull credentials of deployed resources expire at %s\n", expiresAt.Local().Format(time.RFC1123))
+	}
+}
+
+// selectProviders returns the provider passed as an argument or all registered providers
+func selectProviders(args []string) []string {
+	if len(args) == 1 {
+		return args
+	}
+	return providers.Names()
+}
+
+func loadDeployConfig() *parser.Config {
+	config, err := parser.LoadConfig("locreg.yaml")
+	if err != nil {
+		log.Fatalf("❌ Error loading config: %v", err)
+	}
+	return config
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(logsCmd)
+}
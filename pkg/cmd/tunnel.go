@@ -3,9 +3,16 @@ package cmd
 import (
 	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
 	"github.com/Uitware/locreg/pkg/tunnels/ngrok"
+	"github.com/Uitware/locreg/pkg/tunnels/ssh_reverse"
 	"github.com/spf13/cobra"
 	"log"
+
+	// Register tunnel providers
+	_ "github.com/Uitware/locreg/pkg/tunnels/bore"
+	_ "github.com/Uitware/locreg/pkg/tunnels/cloudflared"
+	_ "github.com/Uitware/locreg/pkg/tunnels/microsoft_dev_tunnels"
 )
 
 var tunnelCmd = &cobra.Command{
@@ -25,15 +32,67 @@ var tunnelCmd = &cobra.Command{
 			fmt.Println(fmt.Errorf("❌ failed to load config: %w", err))
 			return
 		}
-		if !config.IsNgrokConfigured() {
-			fmt.Println("❌ Please specify 'ngrok' in the config file. Or if you want to use another provider, " +
-				"please wait for the next release or contribute by yourself")
-			return
+		if err := startTunnel(config); err != nil {
+			log.Fatalf("❌ Failed to run tunnel: %v", err)
+		}
+	},
+}
+
+var sshTunnelDaemonCmd = &cobra.Command{
+	Use:    "ssh-daemon",
+	Short:  "Run SSH reverse tunnel in the foreground",
+	Long:   `Run SSH reverse tunnel in the foreground, reconnecting when the connection is lost. It is started in the background by the ssh tunnel provider.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ failed to load config: %v", err)
+		}
+		if err := ssh_reverse.RunDaemon(config); err != nil {
+			log.Fatalf("❌ SSH tunnel failed: %v", err)
+		}
+	},
+}
+
+var ngrokTunnelDaemonCmd = &cobra.Command{
+	Use:    "ngrok-daemon",
+	Short:  "Run ngrok tunnel in the foreground",
+	Long:   `Run ngrok tunnel with ngrok-go in the foreground. It is started in the background by the ngrok tunnel provider in sdk mode.`,
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ failed to load config: %v", err)
+		}
+		if err := ngrok.RunDaemon(config); err != nil {
+			log.Fatalf("❌ ngrok tunnel failed: %v", err)
 		}
-		ngrok.RunNgrokTunnelContainer(config)
 	},
 }
 
+// startTunnel starts the tunnel provider selected in the config
+func startTunnel(config *parser.Config) error {
+	name, provider, err := tunnels.FromConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := provider.Start(config); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// stopTunnel stops the tunnel recorded in the profile using the provider that created it
+func stopTunnel(config *parser.Config, profile *parser.Profile) error {
+	provider, err := tunnels.FromProfile(profile)
+	if err != nil {
+		return err
+	}
+	return provider.Stop(config)
+}
+
 func init() {
+	tunnelCmd.AddCommand(sshTunnelDaemonCmd)
+	tunnelCmd.AddCommand(ngrokTunnelDaemonCmd)
 	rootCmd.AddCommand(tunnelCmd)
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/spf13/cobra"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var tunnelWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch the tunnel, restart it when it is down and update deployments when its URL changes",
+	Long: `Probe the tunnel until interrupted. If the tunnel stays unhealthy it is restarted, and when its public URL changes
+deployed cloud resources are updated to pull the image through the new URL: a new ECS task definition revision is rolled out,
+Azure Container Instances are updated and Azure App Service LinuxFxVersion is changed.
+Pull-only credentials of deployed resources are renewed before they expire when token authentication is enabled.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		failures, _ := cmd.Flags().GetInt("failures")
+		config, err := parser.LoadConfig("locreg.yaml")
+		if err != nil {
+			log.Fatalf("❌ failed to load config: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		watcher := &tunnels.Watcher{
+			Config:           config,
+			Interval:         interval,
+			FailureThreshold: failures,
+			OnURLChange: func(_ string) error {
+				return redeployAll(config)
+			},
+			OnProbe: func() error {
+				return renewPullCredentials(config)
+			},
+		}
+		fmt.Printf("👀 Watching tunnel every %s, press Ctrl+C to stop\n", interval)
+		if err := watcher.Run(ctx); err != nil {
+			log.Fatalf("❌ Error watching tunnel: %v", err)
+		}
+	},
+}
+
+// redeployAll points resources of every provider that has them deployed to the tunnel URL recorded in the profile
+func redeployAll(config *parser.Config) error {
+	var errs []error
+	for _, name := range providers.Names() {
+		provider, err := providers.Get(name)
+		if err != nil {
+			return err
+		}
+		redeployer, ok := provider.(providers.Redeployer)
+		if !ok {
+			continue
+		}
+		err = redeployer.Redeploy(config)
+		if errors.Is(err, providers.ErrNotDeployed) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func init() {
+	tunnelWatchCmd.Flags().Duration("interval", 30*time.Second, "Time between tunnel health probes")
+	tunnelWatchCmd.Flags().Int("failures", 3, "Number of failed probes in a row after which the tunnel is restarted")
+	tunnelCmd.AddCommand(tunnelWatchCmd)
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// stopTimeout is the time given to a daemon to exit after SIGTERM before it is killed
+const stopTimeout = 10 * time.Second
+
+// Dir returns the directory where logs of background locreg processes are stored
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".locreg.d"), nil
+}
+
+// LogPath returns the path of the log file of the daemon with provided name
+func LogPath(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".log"), nil
+}
+
+// Spawn starts the current locreg executable with provided args as a background process
+// detached from the terminal, so it keeps running after the command that started it exits.
+// Output of the process is appended to its log file, returns PID of the started process
+func Spawn(name string, args ...string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("❌ failed to get locreg executable: %w", err)
+	}
+	logPath, err := LogPath(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		return 0, fmt.Errorf("❌ failed to create daemon directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("❌ failed to open daemon log file: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("❌ failed to start %s daemon: %w", name, err)
+	}
+	pid := cmd.Process.Pid
+	// Process is not waited for, release its resources as it outlives this process
+	if err := cmd.Process.Release(); err != nil {
+		return 0, fmt.Errorf("❌ failed to release %s daemon: %w", name, err)
+	}
+	return pid, nil
+}
+
+// IsRunning reports whether the process with provided PID exists
+func IsRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Stop sends SIGTERM to the process and waits for it to exit, the process is killed if it doesn't exit in time
+func Stop(pid int) error {
+	if !IsRunning(pid) {
+		return nil
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("❌ failed to find process %d: %w", pid, err)
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("❌ failed to stop process %d: %w", pid, err)
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		if !IsRunning(pid) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := process.Kill(); err != nil {
+		return fmt.Errorf("❌ failed to kill process %d: %w", pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package local_registry
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// ociIndexFile lists the images of the OCI image layout
+	ociIndexFile = "index.json"
+	// containerdImageName is the annotation with the full name of the image, Docker and containerd read it on import
+	containerdImageName = "io.containerd.image.name"
+	// maxArchiveManifestSize is the size of the largest index.json or manifest read from an archive
+	maxArchiveManifestSize = 4 << 20
+)
+
+// ExportImage writes the image to w as a tar archive in OCI image layout. Every platform of a multi-platform
+// image is exported, the image is annotated with its name so that it can be imported without naming it again
+func ExportImage(ctx context.Context, client *Client, ref string, w io.Writer) (ocispec.Descriptor, error) {
+	repository, reference, err := ParseReference(ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	manifestDigest, err := client.ManifestDigest(ctx, repository, reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	content, mediaType, err := client.GetManifest(ctx, repository, manifestDigest)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	descriptor := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	if descriptor.Digest.String() != manifestDigest {
+		return ocispec.Descriptor{}, fmt.Errorf("❌ manifest of %s doesn't match its digest %s", ref, manifestDigest)
+	}
+	if reference != manifestDigest {
+		descriptor.Annotations = map[string]string{
+			ocispec.AnnotationRefName: reference,
+			containerdImageName:       repository + ":" + reference,
+		}
+	}
+
+	exporter := &imageExporter{ctx: ctx, client: client, repository: repository, archive: tar.NewWriter(w), written: map[digest.Digest]bool{}}
+	layout, _ := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err := exporter.writeFile(ocispec.ImageLayoutFile, layout); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := exporter.writeImage(content, mediaType); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	index, _ := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{descriptor},
+	})
+	if err := exporter.writeFile(ociIndexFile, index); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := exporter.archive.Close(); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("❌ failed to write archive: %w", err)
+	}
+	return descriptor, nil
+}
+
+// imageExporter writes manifests and blobs of a repository to the archive, every blob is written once
+type imageExporter struct {
+	ctx        context.Context
+	client     *Client
+	repository string
+	archive    *tar.Writer
+	written    map[digest.Digest]bool
+}
+
+// writeImage writes the manifest with its config and layers, or the index with the manifests of all its platforms
+func (exporter *imageExporter) writeImage(content []byte, mediaType string) error {
+	if isIndex(mediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return fmt.Errorf("❌ failed to decode index: %w", err)
+		}
+		for _, platform := range index.Manifests {
+			child, childType, err := exporter.client.GetManifest(exporter.ctx, exporter.repository, platform.Digest.String())
+			if err != nil {
+				return err
+			}
+			if err := exporter.writeImage(child, valueOrDefault(childType, platform.MediaType)); err != nil {
+				return err
+			}
+		}
+	} else {
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return fmt.Errorf("❌ failed to decode manifest: %w", err)
+		}
+		for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+			if err := exporter.writeBlob(blob); err != nil {
+				return err
+			}
+		}
+	}
+	d := digest.FromBytes(content)
+	if exporter.written[d] {
+		return nil
+	}
+	exporter.written[d] = true
+	return exporter.writeFile(blobPath(d), content)
+}
+
+// writeBlob streams the blob from the registry to the archive and checks its digest
+func (exporter *imageExporter) writeBlob(blob ocispec.Descriptor) error {
+	// Non-distributable layers are pulled from their URLs, registries don't store them
+	if exporter.written[blob.Digest] || len(blob.URLs) > 0 {
+		return nil
+	}
+	if err := blob.Digest.Validate(); err != nil {
+		return fmt.Errorf("❌ invalid blob digest %q: %w", blob.Digest, err)
+	}
+	content, _, err := exporter.client.GetBlob(exporter.ctx, exporter.repository, blob.Digest.String())
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if err := exporter.archive.WriteHeader(&tar.Header{Name: blobPath(blob.Digest), Mode: 0644, Size: blob.Size, Typeflag: tar.TypeReg}); err != nil {
+		return fmt.Errorf("❌ failed to write archive: %w", err)
+	}
+	verifier := blob.Digest.Verifier()
+	n, err := io.Copy(exporter.archive, io.TeeReader(io.LimitReader(content, blob.Size), verifier))
+	if err != nil {
+		return fmt.Errorf("❌ failed to export blob %s: %w", blob.Digest, err)
+	}
+	if n != blob.Size || !verifier.Verified() {
+		return fmt.Errorf("❌ blob %s doesn't match its size or digest", blob.Digest)
+	}
+	exporter.written[blob.Digest] = true
+	return nil
+}
+
+func (exporter *imageExporter) writeFile(name string, content []byte) error {
+	if err := exporter.archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		return fmt.Errorf("❌ failed to write archive: %w", err)
+	}
+	if _, err := exporter.archive.Write(content); err != nil {
+		return fmt.Errorf("❌ failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// ImportImages pushes the images of the tar archive in OCI image layout to the registry and returns their references.
+// Images are pushed under the names they are annotated with, or under ref if it is set, which requires the archive
+// to have a single image. Blobs the registry already has aren't uploaded again
+func ImportImages(ctx context.Context, client *Client, archive io.ReadSeeker, ref string) ([]string, error) {
+	layout := &ociArchive{file: archive}
+	if _, err := layout.read(ocispec.ImageLayoutFile); err != nil {
+		return nil, fmt.Errorf("%w, only archives in OCI image layout can be imported", err)
+	}
+	content, err := layout.read(ociIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("❌ failed to decode %s of the archive: %w", ociIndexFile, err)
+	}
+	if len(index.Manifests) == 0 {
+		return nil, fmt.Errorf("❌ archive has no images")
+	}
+	if ref != "" && len(index.Manifests) > 1 {
+		return nil, fmt.Errorf("❌ archive has %d images, they are imported only under their own names", len(index.Manifests))
+	}
+
+	var imported []string
+	for _, descriptor := range index.Manifests {
+		name := ref
+		if name == "" {
+			name = annotatedName(descriptor)
+		}
+		if name == "" {
+			return imported, fmt.Errorf("❌ image %s of the archive has no name, set name:tag to import it", descriptor.Digest)
+		}
+		repository, reference, err := ParseReference(name)
+		if err != nil {
+			return imported, err
+		}
+		pusher := &imagePusher{ctx: ctx, client: client, repository: repository, source: layout}
+		if err := pusher.pushImage(descriptor, reference); err != nil {
+			return imported, err
+		}
+		imported = append(imported, FormatReference(repository, reference))
+	}
+	return imported, nil
+}
+
+// annotatedName returns the name of the image without the registry host, from the annotation written by
+// `locreg images export`, Docker or containerd
+func annotatedName(descriptor ocispec.Descriptor) string {
+	_, name := SplitRegistryHost(descriptor.Annotations[containerdImageName])
+	return name
+}
+
+// ociArchive reads files of a tar archive in OCI image layout. The archive is scanned from the start for every file,
+// so blobs are streamed from the archive without extracting it
+type ociArchive struct {
+	file io.ReadSeeker
+}
+
+func (archive *ociArchive) manifest(_ context.Context, d digest.Digest) ([]byte, string, error) {
+	content, err := archive.read(blobPath(d))
+	return content, "", err
+}
+
+func (archive *ociArchive) blob(_ context.Context, d digest.Digest) (io.ReadCloser, int64, error) {
+	content, size, err := archive.open(blobPath(d))
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(content), size, nil
+}
+
+// open returns the content of the file and its size, it is valid until the next file is opened
+func (archive *ociArchive) open(name string) (io.Reader, int64, error) {
+	if _, err := archive.file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("❌ failed to read archive: %w", err)
+	}
+	reader := tar.NewReader(archive.file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, 0, fmt.Errorf("❌ %s is not found in the archive", name)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("❌ failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && path.Clean(header.Name) == name {
+			return reader, header.Size, nil
+		}
+	}
+}
+
+// read returns the content of a small file like index.json or a manifest
+func (archive *ociArchive) read(name string) ([]byte, error) {
+	reader, size, err := archive.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxArchiveManifestSize {
+		return nil, fmt.Errorf("❌ %s of the archive is larger than %d bytes", name, maxArchiveManifestSize)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to read %s of the archive: %w", name, err)
+	}
+	return content, nil
+}
+
+// blobPath returns the path of the blob in OCI image layout
+func blobPath(d digest.Digest) string {
+	return path.Join(ocispec.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+}
@@ -0,0 +1,117 @@
+package local_registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newEmbeddedClient returns a client of an embedded registry served for the test
+func newEmbeddedClient(t *testing.T) *Client {
+	storage, err := embedded.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	server := httptest.NewServer(&embedded.Server{Storage: storage})
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "", "")
+}
+
+// pushMultiPlatform pushes images tagged amd64 and arm64 and the index of both of them tagged with the tag
+func pushMultiPlatform(t *testing.T, client *Client, repository, tag string) []byte {
+	ctx := context.Background()
+	var platforms []ocispec.Descriptor
+	for _, architecture := range []string{"amd64", "arm64"} {
+		pushToEmbedded(t, client, repository, architecture, time.Now())
+		manifest, mediaType, err := client.GetManifest(ctx, repository, architecture)
+		if err != nil {
+			t.Fatalf("❌ failed to get manifest: %v", err)
+		}
+		platforms = append(platforms, ocispec.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(manifest),
+			Size:      int64(len(manifest)),
+			Platform:  &ocispec.Platform{OS: "linux", Architecture: architecture},
+		})
+	}
+	index, _ := json.Marshal(ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: ocispec.MediaTypeImageIndex, Manifests: platforms})
+	if err := client.PutManifest(ctx, repository, tag, ocispec.MediaTypeImageIndex, index); err != nil {
+		t.Fatalf("❌ failed to push index: %v", err)
+	}
+	return index
+}
+
+func TestExportAndImportImage(t *testing.T) {
+	ctx := context.Background()
+	source := newEmbeddedClient(t)
+	index := pushMultiPlatform(t, source, "app", "v1")
+
+	archivePath := filepath.Join(t.TempDir(), "app.tar")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("❌ failed to create archive: %v", err)
+	}
+	descriptor, err := ExportImage(ctx, source, "app:v1", file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("❌ failed to export image: %v", err)
+	}
+	if descriptor.Digest != digest.FromBytes(index) || descriptor.Annotations[containerdImageName] != "app:v1" {
+		t.Errorf("❌ unexpected exported descriptor %+v", descriptor)
+	}
+
+	file, err = os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("❌ failed to open archive: %v", err)
+	}
+	defer file.Close()
+	target := newEmbeddedClient(t)
+	imported, err := ImportImages(ctx, target, file, "")
+	if err != nil || !reflect.DeepEqual(imported, []string{"app:v1"}) {
+		t.Fatalf("❌ expected app:v1 to be imported, got %v: %v", imported, err)
+	}
+	details, err := InspectImage(ctx, target, "app:v1")
+	if err != nil || details.Digest != descriptor.Digest.String() || len(details.Platforms) != 2 {
+		t.Fatalf("❌ imported image doesn't match the exported one %+v: %v", details, err)
+	}
+	for _, platform := range details.Platforms {
+		if _, err := InspectImage(ctx, target, "app@"+platform.Digest.String()); err != nil {
+			t.Errorf("❌ platform %s is not imported: %v", platform.Platform.Architecture, err)
+		}
+	}
+
+	imported, err = ImportImages(ctx, target, file, "team/app:copy")
+	if err != nil || !reflect.DeepEqual(imported, []string{"team/app:copy"}) {
+		t.Errorf("❌ expected team/app:copy to be imported, got %v: %v", imported, err)
+	}
+	if _, err := ImportImages(ctx, target, bytes.NewReader([]byte("not an archive")), ""); err == nil {
+		t.Error("❌ invalid archive is imported")
+	}
+}
+
+func TestAnnotatedName(t *testing.T) {
+	for annotation, name := range map[string]string{
+		"app:v1":                    "app:v1",
+		"team/app:v1":               "team/app:v1",
+		"docker.io/library/redis:7": "library/redis:7",
+		"localhost:5000/app:v1":     "app:v1",
+		"localhost/app:v1":          "app:v1",
+		"":                          "",
+	} {
+		descriptor := ocispec.Descriptor{Annotations: map[string]string{containerdImageName: annotation}}
+		if got := annotatedName(descriptor); got != name {
+			t.Errorf("❌ %q: expected %q, got %q", annotation, name, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package local_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultBackend is used when `registry.backend` is not set
+const defaultBackend = "distribution"
+
+// healthTimeout is the time given to the registry to start serving requests
+const healthTimeout = 30 * time.Second
+
+// ConfigFile is a file written to the registry container before it is started
+type ConfigFile struct {
+	Path    string
+	Content []byte
+}
+
+// RegistryBackend is a container registry implementation run by locreg as the local registry.
+// The backend is selected with `registry.backend` in locreg.yaml
+type RegistryBackend interface {
+	// Image returns the image reference of the registry, `registry.image` and `registry.tag` override the defaults
+	Image(config *parser.Config) string
+	// Port returns the port registry listens on inside its container
+	Port() int
+	// RenderConfig returns the registry configuration files
+	RenderConfig(config *parser.Config) ([]ConfigFile, error)
+	// SetupAuth returns the files enabling basic auth with the provided credentials
+	SetupAuth(username, password string) ([]ConfigFile, error)
+	// DataDirectory returns the directory inside the container where images are stored
+	DataDirectory(config *parser.Config) string
+	// HealthEndpoint returns the path answering with 200 or 401 once the registry is serving requests
+	HealthEndpoint() string
+}
+
+// TokenAuthBackend is implemented by backends supporting token authentication served by the gateway
+type TokenAuthBackend interface {
+	// SetupTokenAuth returns the files enabling verification of tokens signed by the key of the certificate
+	SetupTokenAuth(certificate []byte) []ConfigFile
+}
+
+// GarbageCollectingBackend is implemented by backends whose garbage collection is run on demand,
+// other backends collect garbage on their own
+type GarbageCollectingBackend interface {
+	// RenderReadOnlyConfig renders the config with pushes rejected, so blobs aren't uploaded while they are collected
+	RenderReadOnlyConfig(config *parser.Config) (ConfigFile, error)
+	// GarbageCollectCommand returns the command run in the registry container to collect garbage
+	GarbageCollectCommand(deleteUntagged bool) []string
+}
+
+var backends = map[string]RegistryBackend{
+	defaultBackend: distributionBackend{},
+	"zot":          zotBackend{},
+}
+
+// GetBackend returns the registry backend with the provided name
+func GetBackend(name string) (RegistryBackend, error) {
+	if name == "" {
+		name = defaultBackend
+	}
+	if name == EmbeddedBackend {
+		return nil, fmt.Errorf("❌ %s registry backend doesn't run in a container", name)
+	}
+	backend, ok := backends[name]
+	if !ok {
+		names := []string{EmbeddedBackend}
+		for name := range backends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("❌ unknown registry backend %q, available backends: %s", name, strings.Join(names, ", "))
+	}
+	return backend, nil
+}
+
+// ContainerAddress returns the address of the registry container inside the tunnel network. If the registry
+// is served through the gateway or by the embedded registry tunnels forward to the host instead
+func ContainerAddress(config *parser.Config) (string, error) {
+	if config.IsRegistryGatewayEnabled() || isEmbedded(config) {
+		return fmt.Sprintf("%s:%d", gatewayHost, config.Registry.Port), nil
+	}
+	backend, err := GetBackend(config.Registry.Backend)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", config.Registry.Name, backend.Port()), nil
+}
+
+// ContainerExtraHosts returns the hosts tunnel containers need to reach the registry
+func ContainerExtraHosts(config *parser.Config) []string {
+	if config.IsRegistryGatewayEnabled() || isEmbedded(config) {
+		return []string{gatewayHost + ":host-gateway"}
+	}
+	return nil
+}
+
+// imageRef returns `registry.image` and `registry.tag` if set, otherwise the provided defaults are used
+func imageRef(config *parser.Config, defaultImage, defaultTag string) string {
+	image, tag := config.Registry.Image, config.Registry.Tag
+	if image == "" {
+		image = defaultImage
+	}
+	if tag == "" {
+		tag = defaultTag
+	}
+	return fmt.Sprintf("%s:%s", image, tag)
+}
+
+// htpasswd returns an htpasswd file in the same format as `htpasswd -Bnb` command does,
+// bcrypt is the only hash supported by both distribution and zot
+func htpasswd(path, username, password string) (ConfigFile, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("❌ failed to hash password: %w", err)
+	}
+	return ConfigFile{
+		Path:    path,
+		Content: []byte(fmt.Sprintf("%s:%s\n", username, hashedPassword)),
+	}, nil
+}
+
+// waitForHealthy polls the health endpoint of the registry through its published port. Credentials are sent,
+// so the gateway forwards the request to the registry instead of rejecting it
+func waitForHealthy(ctx context.Context, config *parser.Config, endpoint, username, password string) error {
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", config.Registry.Port, endpoint)
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(healthTimeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("❌ failed to create health request: %w", err)
+		}
+		req.SetBasicAuth(username, password)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		lastErr = err
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Errorf("❌ registry is not healthy after %s: %w", healthTimeout, lastErr)
+}
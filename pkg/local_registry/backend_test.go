@@ -0,0 +1,75 @@
+package local_registry
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestGetBackend(t *testing.T) {
+	for _, name := range []string{"", "distribution", "zot"} {
+		if _, err := GetBackend(name); err != nil {
+			t.Errorf("❌ backend %q is not found: %v", name, err)
+		}
+	}
+	if _, err := GetBackend("harbor"); err == nil {
+		t.Error("❌ unknown backend is returned")
+	}
+}
+
+func TestBackendImage(t *testing.T) {
+	config := &parser.Config{}
+	backend, _ := GetBackend("zot")
+	if image := backend.Image(config); !strings.HasPrefix(image, "ghcr.io/project-zot/zot:") {
+		t.Errorf("❌ unexpected default zot image %s", image)
+	}
+	config.Registry.Tag = "v2.0.0"
+	if image := backend.Image(config); image != "ghcr.io/project-zot/zot:v2.0.0" {
+		t.Errorf("❌ registry tag is not used, got %s", image)
+	}
+}
+
+func TestZotRenderConfig(t *testing.T) {
+	backend, _ := GetBackend("zot")
+	files, err := backend.RenderConfig(&parser.Config{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("❌ failed to render config: %v", err)
+	}
+	file := files[0]
+	var zotConfig struct {
+		HTTP struct {
+			Port string `json:"port"`
+			Auth struct {
+				Htpasswd struct {
+					Path string `json:"path"`
+				} `json:"htpasswd"`
+			} `json:"auth"`
+		} `json:"http"`
+	}
+	if err := json.Unmarshal(file.Content, &zotConfig); err != nil {
+		t.Fatalf("❌ rendered config is not valid JSON: %v", err)
+	}
+	if zotConfig.HTTP.Port != "5000" || zotConfig.HTTP.Auth.Htpasswd.Path != zotHtpasswdPath {
+		t.Errorf("❌ unexpected zot config: %s", file.Content)
+	}
+}
+
+func TestSetupAuth(t *testing.T) {
+	for _, name := range []string{"distribution", "zot"} {
+		backend, _ := GetBackend(name)
+		files, err := backend.SetupAuth("user", "password")
+		if err != nil {
+			t.Fatalf("❌ failed to set up auth for %s: %v", name, err)
+		}
+		username, hash, _ := strings.Cut(strings.TrimSpace(string(files[0].Content)), ":")
+		if username != "user" {
+			t.Errorf("❌ unexpected username in htpasswd of %s: %s", name, username)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("password")); err != nil {
+			t.Errorf("❌ htpasswd of %s doesn't match the password: %v", name, err)
+		}
+	}
+}
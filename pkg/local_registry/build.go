@@ -0,0 +1,185 @@
+package local_registry
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// defaultDockerfile is built when `image.build.dockerfile` is not set
+const defaultDockerfile = "Dockerfile"
+
+// BuildOptions are `locreg push` flags overriding `image.build` from the config
+type BuildOptions struct {
+	Dockerfile string
+	Target     string
+	Args       []string // KEY=value, added to the args from the config
+	Labels     []string // key=value, added to the labels from the config
+	Platform   string
+	NoCache    bool
+	Pull       bool
+}
+
+// apply overrides the build settings of the config with the options that are set
+func (options BuildOptions) apply(config *parser.Config) {
+	build := &config.Image.Build
+	build.Dockerfile = valueOrDefault(options.Dockerfile, build.Dockerfile)
+	build.Target = valueOrDefault(options.Target, build.Target)
+	build.Platform = valueOrDefault(options.Platform, build.Platform)
+	// Later values of the same key win, so the flags override the config
+	build.Args = append(build.Args, options.Args...)
+	build.Labels = append(build.Labels, options.Labels...)
+	build.NoCache = build.NoCache || options.NoCache
+	build.Pull = build.Pull || options.Pull
+}
+
+// buildContext returns the directory the image is built from, the directory passed to `locreg push` takes precedence
+func buildContext(config *parser.Config, dir string) (string, error) {
+	dir = valueOrDefault(dir, config.Image.Build.Context)
+	if dir == "" {
+		return "", fmt.Errorf("❌ build context is not set, pass the directory to locreg push or set image.build.context")
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("❌ build context %s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// imageBuildOptions returns the options of the Docker build of the image tag from `image.build`
+func imageBuildOptions(config *parser.Config, dir string, imageTag string) (types.ImageBuildOptions, error) {
+	build := config.Image.Build
+	dockerfile := filepath.ToSlash(filepath.Clean(valueOrDefault(build.Dockerfile, defaultDockerfile)))
+	// Docker reads the Dockerfile from the context sent to it, so it must be inside the context
+	if filepath.IsAbs(dockerfile) || dockerfile == ".." || strings.HasPrefix(dockerfile, "../") {
+		return types.ImageBuildOptions{}, fmt.Errorf("❌ image.build.dockerfile %s must be a path inside the build context", dockerfile)
+	}
+	if _, err := os.Stat(filepath.Join(dir, dockerfile)); err != nil {
+		return types.ImageBuildOptions{}, fmt.Errorf("❌ %s is not found in the build context %s", dockerfile, dir)
+	}
+
+	args := map[string]*string{}
+	for _, arg := range build.Args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			// Like docker build, an arg without a value is taken from the environment and skipped if it isn't set
+			if value, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+		if key == "" {
+			return types.ImageBuildOptions{}, fmt.Errorf("❌ invalid build arg %q, expected KEY=value", arg)
+		}
+		args[key] = &value
+	}
+	labels := map[string]string{}
+	for _, label := range build.Labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return types.ImageBuildOptions{}, fmt.Errorf("❌ invalid label %q, expected key=value", label)
+		}
+		labels[key] = value
+	}
+
+	return types.ImageBuildOptions{
+		Dockerfile: dockerfile,
+		Tags:       []string{imageTag},
+		Target:     build.Target,
+		BuildArgs:  args,
+		Labels:     labels,
+		Platform:   build.Platform,
+		NoCache:    build.NoCache,
+		PullParent: build.Pull,
+		Remove:     true,
+	}, nil
+}
+
+// contextArchive returns the tar of the build context without the files excluded by its ignore file and prints its size
+func contextArchive(dir, dockerfile string) (io.ReadCloser, error) {
+	patterns, err := dockerignorePatterns(dir, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	size, err := contextSize(dir, patterns)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("✅ Sending build context of %s to Docker\n", FormatSize(size))
+	tar, err := archive.TarWithOptions(dir, &archive.TarOptions{ExcludePatterns: patterns})
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to create tar archive: %w", err)
+	}
+	return tar, nil
+}
+
+// dockerignorePatterns reads the patterns of `<Dockerfile>.dockerignore` next to the Dockerfile or, if there is none,
+// of `.dockerignore` in the root of the build context, the same way as docker build
+func dockerignorePatterns(dir, dockerfile string) ([]string, error) {
+	for _, name := range []string{dockerfile + ".dockerignore", ".dockerignore"} {
+		file, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("❌ failed to read %s: %w", name, err)
+		}
+		defer file.Close()
+		patterns, err := ignorefile.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("❌ failed to parse %s: %w", name, err)
+		}
+		// Docker reads the Dockerfile from the context, so it is sent even if it's ignored
+		return append(patterns, "!"+dockerfile), nil
+	}
+	return nil, nil
+}
+
+// contextSize returns the total size of the files of the build context that aren't excluded by the patterns
+func contextSize(dir string, patterns []string) (int64, error) {
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return 0, fmt.Errorf("❌ invalid .dockerignore pattern: %w", err)
+	}
+	var size int64
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		excluded, err := matcher.MatchesOrParentMatches(relative)
+		if err != nil {
+			return err
+		}
+		if excluded {
+			// Exclusion patterns like !dir/keep may bring back files of an excluded directory
+			if entry.IsDir() && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("❌ failed to read build context %s: %w", dir, err)
+	}
+	return size, nil
+}
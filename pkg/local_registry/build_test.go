@@ -0,0 +1,129 @@
+package local_registry
+
+import (
+	tarfile "archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestImageBuildOptions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "deploy", "Dockerfile.api"), []byte("FROM scratch AS runtime\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	config := &parser.Config{}
+	config.Image.Build.Context = dir
+	config.Image.Build.Dockerfile = "deploy/Dockerfile.api"
+	config.Image.Build.Args = []string{"GO_VERSION=1.21", "GITHUB_TOKEN", "UNSET_ARG"}
+	config.Image.Build.Labels = []string{"team=api"}
+	BuildOptions{
+		Target:   "runtime",
+		Args:     []string{"GO_VERSION=1.22"},
+		Labels:   []string{"org.opencontainers.image.source=https://github.com/team/monorepo"},
+		Platform: "linux/amd64",
+		NoCache:  true,
+	}.apply(config)
+
+	context, err := buildContext(config, "")
+	if err != nil || context != dir {
+		t.Fatalf("❌ expected context from the config, got %s: %v", context, err)
+	}
+	options, err := imageBuildOptions(config, context, "localhost:5000/app:dev")
+	if err != nil {
+		t.Fatalf("❌ failed to build options: %v", err)
+	}
+	args := map[string]string{}
+	for key, value := range options.BuildArgs {
+		args[key] = *value
+	}
+	if !reflect.DeepEqual(args, map[string]string{"GO_VERSION": "1.22", "GITHUB_TOKEN": "token"}) {
+		t.Errorf("❌ unexpected build args %v", args)
+	}
+	if !reflect.DeepEqual(options.Labels, map[string]string{"team": "api", "org.opencontainers.image.source": "https://github.com/team/monorepo"}) {
+		t.Errorf("❌ unexpected labels %v", options.Labels)
+	}
+	if options.Dockerfile != "deploy/Dockerfile.api" || options.Target != "runtime" || options.Platform != "linux/amd64" || !options.NoCache {
+		t.Errorf("❌ unexpected build options %+v", options)
+	}
+
+	for name, update := range map[string]func(config *parser.Config){
+		"missing dockerfile":       func(config *parser.Config) { config.Image.Build.Dockerfile = "Dockerfile" },
+		"dockerfile above context": func(config *parser.Config) { config.Image.Build.Dockerfile = "../Dockerfile" },
+		"label without value":      func(config *parser.Config) { config.Image.Build.Labels = []string{"team"} },
+	} {
+		invalid := *config
+		update(&invalid)
+		if _, err := imageBuildOptions(&invalid, context, "localhost:5000/app:dev"); err == nil {
+			t.Errorf("❌ %s is accepted", name)
+		}
+	}
+	if _, err := buildContext(&parser.Config{}, ""); err == nil {
+		t.Error("❌ build without context is accepted")
+	}
+}
+
+func TestContextArchive(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".env":                               "SECRET=value",
+		".git/HEAD":                          "ref: refs/heads/main",
+		"node_modules/lib/index.js":          "module.exports = {}",
+		"deploy/Dockerfile.api":              "FROM scratch\nCOPY . /\n",
+		"deploy/Dockerfile.api.dockerignore": "*\n!main.go\n",
+		".dockerignore":                      ".git\n.env\nnode_modules\n",
+		"main.go":                            "package main",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patterns, err := dockerignorePatterns(dir, "Dockerfile")
+	if err != nil {
+		t.Fatalf("❌ failed to read .dockerignore: %v", err)
+	}
+	size, err := contextSize(dir, patterns)
+	expected := len(".git\n.env\nnode_modules\n") + len("FROM scratch\nCOPY . /\n") + len("*\n!main.go\n") + len("package main")
+	if err != nil || size != int64(expected) {
+		t.Errorf("❌ expected context of %d bytes without ignored files, got %d: %v", expected, size, err)
+	}
+
+	// The ignore file of the Dockerfile takes precedence, the Dockerfile itself is always sent
+	tar, err := contextArchive(dir, "deploy/Dockerfile.api")
+	if err != nil {
+		t.Fatalf("❌ failed to create build context: %v", err)
+	}
+	defer tar.Close()
+	reader := tarfile.NewReader(tar)
+	var files []string
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("❌ failed to read build context: %v", err)
+		}
+		if header.Typeflag == tarfile.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, []string{"deploy/Dockerfile.api", "main.go"}) {
+		t.Errorf("❌ unexpected files in build context %v", files)
+	}
+}
@@ -0,0 +1,424 @@
+package local_registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// manifestMediaTypes are the manifest formats accepted from the registry
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// challengeParam matches a parameter of the authentication challenge
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Client talks to the Registry HTTP API v2, it authenticates with basic auth or with a token
+// requested from the token server named in the authentication challenge of the registry.
+// Requests are anonymous if the username is empty
+type Client struct {
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // Tokens issued by the token server by scope
+}
+
+// NewClient returns a client of the registry at the base URL
+func NewClient(baseURL, username, password string) *Client {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Username:   username,
+		Password:   password,
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+		tokens:     map[string]string{},
+	}
+}
+
+// NewLocalClient returns a client of the local registry using the credentials recorded in the profile
+func NewLocalClient(config *parser.Config) (*Client, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return nil, fmt.Errorf("❌ local registry is not found in profile")
+	}
+	return NewClient(
+		fmt.Sprintf("http://127.0.0.1:%d", config.Registry.Port),
+		profile.LocalRegistry.Username,
+		profile.LocalRegistry.Password,
+	), nil
+}
+
+// Do sends the request to the registry, scope is the access requested from the token server if token auth is used.
+// Request body must be replayable with GetBody, as the request is repeated after authentication
+func (client *Client) Do(req *http.Request, scope string) (*http.Response, error) {
+	client.mu.Lock()
+	token := client.tokens[scope]
+	client.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if client.Username != "" {
+		req.SetBasicAuth(client.Username, client.Password)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("❌ registry rejected credentials of %s", client.Username)
+	}
+	token, err = client.fetchToken(req.Context(), challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("❌ request body can't be replayed after authentication")
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return client.HTTPClient.Do(retry)
+}
+
+// fetchToken requests a token for the scope from the token server of the challenge
+func (client *Client) fetchToken(ctx context.Context, challenge, scope string) (string, error) {
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("❌ registry authentication challenge has no realm: %s", challenge)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create token request: %w", err)
+	}
+	// Public repositories, e.g. on Docker Hub, issue tokens to anonymous clients
+	if client.Username != "" {
+		req.SetBasicAuth(client.Username, client.Password)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("❌ token server rejected credentials of %s: %s", client.Username, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("❌ failed to decode token response: %w", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	client.mu.Lock()
+	client.tokens[scope] = token
+	client.mu.Unlock()
+	return token, nil
+}
+
+// GetManifest returns the manifest of the image and its media type
+func (client *Client) GetManifest(ctx context.Context, repository, reference string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", client.BaseURL, repository, reference), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("❌ failed to create manifest request: %w", err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := client.Do(req, pullScope(repository))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, "", fmt.Errorf("❌ failed to get manifest of %s:%s: %w", repository, reference, err)
+	}
+	manifest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("❌ failed to read manifest: %w", err)
+	}
+	return manifest, resp.Header.Get("Content-Type"), nil
+}
+
+// ManifestDigest returns the digest of the manifest the reference points to
+func (client *Client) ManifestDigest(ctx context.Context, repository, reference string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", client.BaseURL, repository, reference), nil)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create manifest request: %w", err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := client.Do(req, pullScope(repository))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", fmt.Errorf("❌ failed to get manifest of %s:%s: %w", repository, reference, err)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("❌ registry didn't return digest of %s:%s", repository, reference)
+	}
+	return digest, nil
+}
+
+// DeleteManifest deletes the manifest by digest, all tags pointing to it are deleted with it
+func (client *Client) DeleteManifest(ctx context.Context, repository, digest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", client.BaseURL, repository, digest), nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create delete request: %w", err)
+	}
+	resp, err := client.Do(req, fmt.Sprintf("repository:%s:delete", repository))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return fmt.Errorf("❌ registry doesn't allow deleting images, set registry.config.storage.delete to true")
+	}
+	if err := checkResponse(resp, http.StatusAccepted); err != nil {
+		return fmt.Errorf("❌ failed to delete %s@%s: %w", repository, digest, err)
+	}
+	return nil
+}
+
+// GetBlob returns the content of the blob and its size, the caller must close it
+func (client *Client) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/v2/%s/blobs/%s", client.BaseURL, repository, digest), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("❌ failed to create blob request: %w", err)
+	}
+	resp, err := client.Do(req, pullScope(repository))
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("❌ failed to get blob %s of %s: %w", digest, repository, err)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// BlobExists checks if the repository has the blob, so that it isn't uploaded again
+func (client *Client) BlobExists(ctx context.Context, repository, digest string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead,
+		fmt.Sprintf("%s/v2/%s/blobs/%s", client.BaseURL, repository, digest), nil)
+	if err != nil {
+		return false, fmt.Errorf("❌ failed to create blob request: %w", err)
+	}
+	resp, err := client.Do(req, pushScope(repository))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return false, fmt.Errorf("❌ failed to check blob %s of %s: %w", digest, repository, err)
+	}
+	return true, nil
+}
+
+// PutBlob uploads the blob of the size in a single request after the upload is started
+func (client *Client) PutBlob(ctx context.Context, repository, digest string, size int64, content io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/v2/%s/blobs/uploads/", client.BaseURL, repository), nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create upload request: %w", err)
+	}
+	// Upload is started without a body, so authentication happens before the content is streamed
+	resp, err := client.Do(req, pushScope(repository))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := checkResponse(resp, http.StatusAccepted); err != nil {
+		return fmt.Errorf("❌ failed to start upload of %s to %s: %w", digest, repository, err)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("❌ registry returned invalid upload location %q", resp.Header.Get("Location"))
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, location.String(), content)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = client.Do(req, pushScope(repository))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return fmt.Errorf("❌ failed to upload blob %s to %s: %w", digest, repository, err)
+	}
+	return nil
+}
+
+// PutManifest uploads the manifest and points the reference, a tag or the digest of the manifest, to it
+func (client *Client) PutManifest(ctx context.Context, repository, reference, mediaType string, manifest []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", client.BaseURL, repository, reference), bytes.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("❌ failed to create manifest request: %w", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := client.Do(req, pushScope(repository))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, http.StatusCreated); err != nil {
+		return fmt.Errorf("❌ failed to push manifest of %s:%s: %w", repository, reference, err)
+	}
+	return nil
+}
+
+// Catalog returns names of all repositories in the registry
+func (client *Client) Catalog(ctx context.Context) ([]string, error) {
+	var repositories []string
+	err := client.paginate(ctx, client.BaseURL+"/v2/_catalog?n=1000", "registry:catalog:*", func(body io.Reader) error {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		repositories = append(repositories, page.Repositories...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to list repositories: %w", err)
+	}
+	return repositories, nil
+}
+
+// Tags returns all tags of the repository
+func (client *Client) Tags(ctx context.Context, repository string) ([]string, error) {
+	var tags []string
+	err := client.paginate(ctx, fmt.Sprintf("%s/v2/%s/tags/list?n=1000", client.BaseURL, repository), pullScope(repository), func(body io.Reader) error {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		tags = append(tags, page.Tags...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to list tags of %s: %w", repository, err)
+	}
+	return tags, nil
+}
+
+// paginate requests the list and its following pages named in the Link header
+func (client *Client) paginate(ctx context.Context, pageURL, scope string, decode func(io.Reader) error) error {
+	for pageURL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req, scope)
+		if err != nil {
+			return err
+		}
+		if err := checkResponse(resp, http.StatusOK); err != nil {
+			resp.Body.Close()
+			return err
+		}
+		err = decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		pageURL = nextPage(resp)
+	}
+	return nil
+}
+
+// nextPage returns the URL of the next page from `Link: </v2/_catalog?last=a&n=1000>; rel="next"` header
+func nextPage(resp *http.Response) string {
+	link := resp.Header.Get("Link")
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start == -1 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return ""
+	}
+	next, err := resp.Request.URL.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
+
+// ErrNotFound is returned when the registry doesn't have the requested resource
+var ErrNotFound = errors.New("not found")
+
+// checkResponse returns an error with the registry error message if the response status is unexpected
+func checkResponse(resp *http.Response, expected ...int) error {
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func pullScope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull", repository)
+}
+
+func pushScope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull,push", repository)
+}
@@ -0,0 +1,71 @@
+package local_registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Registry Realm"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/app/manifests/latest" {
+			http.Error(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	_, mediaType, err := NewClient(server.URL, "admin", "secret").GetManifest(context.Background(), "app", "latest")
+	if err != nil || mediaType != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("❌ expected manifest to be returned, got %q: %v", mediaType, err)
+	}
+	if _, _, err := NewClient(server.URL, "admin", "secret").GetManifest(context.Background(), "app", "v1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("❌ expected ErrNotFound, got %v", err)
+	}
+	if _, _, err := NewClient(server.URL, "admin", "wrong").GetManifest(context.Background(), "app", "latest"); err == nil {
+		t.Error("❌ invalid credentials are accepted")
+	}
+}
+
+func TestClientTokenAuth(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	tokenRequests := 0
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		username, password, _ := r.BasicAuth()
+		if username != "admin" || password != "secret" || r.URL.Query().Get("scope") != "repository:app:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"issued"}`))
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer issued" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="locreg-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	registryClient := NewClient(server.URL, "admin", "secret")
+	for i := 0; i < 2; i++ {
+		if _, _, err := registryClient.GetManifest(context.Background(), "app", "latest"); err != nil {
+			t.Fatalf("❌ failed to get manifest with token: %v", err)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("❌ expected token to be reused, it was requested %d times", tokenRequests)
+	}
+}
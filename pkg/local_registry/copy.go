@@ -0,0 +1,199 @@
+package local_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dockerHubRegistry is the API endpoint of Docker Hub
+const dockerHubRegistry = "https://registry-1.docker.io"
+
+// RemoteImage is an image in a registry other than the local one
+type RemoteImage struct {
+	Registry   string // Base URL of the registry API
+	Repository string
+	Reference  string // Tag or digest
+}
+
+// ParseRemoteReference parses `[host/]name[:tag|@digest]` the way Docker does: names without a registry host
+// are pulled from Docker Hub, where single component names are in the `library` namespace
+func ParseRemoteReference(ref string) (RemoteImage, error) {
+	host, name := SplitRegistryHost(ref)
+	repository, reference, err := ParseReference(name)
+	if err != nil {
+		return RemoteImage{}, err
+	}
+	image := RemoteImage{Registry: "https://" + host, Repository: repository, Reference: reference}
+	switch {
+	case host == "" || contains(dockerHubHosts, host):
+		image.Registry = dockerHubRegistry
+		if !strings.Contains(repository, "/") {
+			image.Repository = "library/" + repository
+		}
+	case host == "localhost" || strings.HasPrefix(host, "localhost:") || strings.HasPrefix(host, "127.0.0.1"):
+		// Docker treats local registries as insecure, they are served over plain HTTP
+		image.Registry = "http://" + host
+	}
+	return image, nil
+}
+
+// SplitRegistryHost splits the registry host from the image name, the host is empty if the first
+// component of the name doesn't look like a host
+func SplitRegistryHost(name string) (string, string) {
+	host, rest, ok := strings.Cut(name, "/")
+	if ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return host, rest
+	}
+	return "", name
+}
+
+// CopyImage streams the image from the source registry to the repository and the tag or digest of the target registry.
+// Every platform of a multi-platform image is copied unless platform like linux/amd64 is set, then only the image
+// of that platform is copied. Blobs the target registry already has aren't copied again
+func CopyImage(ctx context.Context, source *Client, image RemoteImage, target *Client, repository, reference, platform string) (ocispec.Descriptor, error) {
+	content, mediaType, err := source.GetManifest(ctx, image.Repository, image.Reference)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	descriptor := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	if platform != "" && isIndex(mediaType) {
+		if descriptor, err = selectPlatform(content, platform); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	if _, err := digest.Parse(reference); err == nil {
+		// Digest of the copied manifest differs from the source one when a single platform is copied
+		reference = descriptor.Digest.String()
+	}
+	pusher := &imagePusher{
+		ctx:        ctx,
+		client:     target,
+		repository: repository,
+		source:     &registrySource{client: source, repository: image.Repository},
+	}
+	return descriptor, pusher.pushImage(descriptor, reference)
+}
+
+// selectPlatform returns the manifest of the platform `os/architecture[/variant]` from the index
+func selectPlatform(content []byte, platform string) (ocispec.Descriptor, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return ocispec.Descriptor{}, fmt.Errorf("❌ invalid platform %q, expected os/architecture[/variant]", platform)
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("❌ failed to decode index: %w", err)
+	}
+	var available []string
+	for _, manifest := range index.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		name := manifest.Platform.OS + "/" + manifest.Platform.Architecture
+		if manifest.Platform.Variant != "" {
+			name += "/" + manifest.Platform.Variant
+		}
+		available = append(available, name)
+		if manifest.Platform.OS == parts[0] && manifest.Platform.Architecture == parts[1] &&
+			(len(parts) == 2 || manifest.Platform.Variant == parts[2]) {
+			return manifest, nil
+		}
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("❌ image has no %s platform, available: %s", platform, strings.Join(available, ", "))
+}
+
+// imageSource provides manifests and blobs of the image pushed to the registry
+type imageSource interface {
+	// manifest returns the manifest or the index with the digest and its media type if it is known
+	manifest(ctx context.Context, d digest.Digest) ([]byte, string, error)
+	// blob returns the content of the blob and its size, the caller must close it
+	blob(ctx context.Context, d digest.Digest) (io.ReadCloser, int64, error)
+}
+
+// registrySource reads the image from a repository of another registry
+type registrySource struct {
+	client     *Client
+	repository string
+}
+
+func (source *registrySource) manifest(ctx context.Context, d digest.Digest) ([]byte, string, error) {
+	return source.client.GetManifest(ctx, source.repository, d.String())
+}
+
+func (source *registrySource) blob(ctx context.Context, d digest.Digest) (io.ReadCloser, int64, error) {
+	return source.client.GetBlob(ctx, source.repository, d.String())
+}
+
+// imagePusher pushes manifests and blobs of the source to a repository of the registry
+type imagePusher struct {
+	ctx        context.Context
+	client     *Client
+	repository string
+	source     imageSource
+}
+
+// pushImage pushes the blobs and the manifests of the image before pointing the reference to it
+func (pusher *imagePusher) pushImage(descriptor ocispec.Descriptor, reference string) error {
+	content, mediaType, err := pusher.source.manifest(pusher.ctx, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	if digest.FromBytes(content) != descriptor.Digest {
+		return fmt.Errorf("❌ manifest %s doesn't match its digest", descriptor.Digest)
+	}
+	mediaType = valueOrDefault(descriptor.MediaType, mediaType)
+	if mediaType == "" {
+		var versioned struct {
+			MediaType string `json:"mediaType"`
+		}
+		_ = json.Unmarshal(content, &versioned)
+		mediaType = versioned.MediaType
+	}
+
+	if isIndex(mediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return fmt.Errorf("❌ failed to decode index %s: %w", descriptor.Digest, err)
+		}
+		for _, platform := range index.Manifests {
+			if err := pusher.pushImage(platform, platform.Digest.String()); err != nil {
+				return err
+			}
+		}
+	} else {
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return fmt.Errorf("❌ failed to decode manifest %s: %w", descriptor.Digest, err)
+		}
+		for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+			if err := pusher.pushBlob(blob); err != nil {
+				return err
+			}
+		}
+	}
+	return pusher.client.PutManifest(pusher.ctx, pusher.repository, reference, mediaType, content)
+}
+
+// pushBlob uploads the blob from the source unless the registry already has it
+func (pusher *imagePusher) pushBlob(blob ocispec.Descriptor) error {
+	// Non-distributable layers are pulled from their URLs, registries don't store them
+	if len(blob.URLs) > 0 {
+		return nil
+	}
+	exists, err := pusher.client.BlobExists(pusher.ctx, pusher.repository, blob.Digest.String())
+	if err != nil || exists {
+		return err
+	}
+	content, _, err := pusher.source.blob(pusher.ctx, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return pusher.client.PutBlob(pusher.ctx, pusher.repository, blob.Digest.String(), blob.Size, io.LimitReader(content, blob.Size))
+}
@@ -0,0 +1,67 @@
+package local_registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParseRemoteReference(t *testing.T) {
+	for ref, expected := range map[string]RemoteImage{
+		"redis":                        {dockerHubRegistry, "library/redis", "latest"},
+		"docker.io/library/redis:7":    {dockerHubRegistry, "library/redis", "7"},
+		"bitnami/redis:7":              {dockerHubRegistry, "bitnami/redis", "7"},
+		"ghcr.io/team/app@sha256:abc":  {"https://ghcr.io", "team/app", "sha256:abc"},
+		"localhost:5001/app:v1":        {"http://localhost:5001", "app", "v1"},
+		"myregistry.azurecr.io/app:v1": {"https://myregistry.azurecr.io", "app", "v1"},
+	} {
+		image, err := ParseRemoteReference(ref)
+		if err != nil || image != expected {
+			t.Errorf("❌ %s: expected %+v, got %+v: %v", ref, expected, image, err)
+		}
+	}
+}
+
+func TestCopyImage(t *testing.T) {
+	ctx := context.Background()
+	storage, err := embedded.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	server := httptest.NewServer(&embedded.Server{
+		Storage:      storage,
+		Authenticate: func(username, password string) bool { return username == "reader" && password == "secret" },
+	})
+	defer server.Close()
+	source := NewClient(server.URL, "reader", "secret")
+	index := pushMultiPlatform(t, source, "library/redis", "7")
+	image := RemoteImage{Registry: server.URL, Repository: "library/redis", Reference: "7"}
+
+	target := newEmbeddedClient(t)
+	descriptor, err := CopyImage(ctx, source, image, target, "redis", "7", "")
+	if err != nil {
+		t.Fatalf("❌ failed to copy image: %v", err)
+	}
+	details, err := InspectImage(ctx, target, "redis:7")
+	if err != nil || descriptor.Digest != digest.FromBytes(index) || details.Digest != descriptor.Digest.String() || len(details.Platforms) != 2 {
+		t.Fatalf("❌ copied image doesn't match the source %+v: %v", details, err)
+	}
+
+	descriptor, err = CopyImage(ctx, source, image, target, "redis", "7-arm64", "linux/arm64")
+	if err != nil {
+		t.Fatalf("❌ failed to copy platform: %v", err)
+	}
+	details, err = InspectImage(ctx, target, "redis:7-arm64")
+	if err != nil || details.Platforms != nil || details.Digest != descriptor.Digest.String() {
+		t.Errorf("❌ expected only the arm64 image to be copied, got %+v: %v", details, err)
+	}
+	if _, err := CopyImage(ctx, source, image, target, "redis", "7-s390x", "linux/s390x"); err == nil {
+		t.Error("❌ missing platform is copied")
+	}
+	if _, err := CopyImage(ctx, NewClient(server.URL, "reader", "wrong"), image, target, "redis", "7", ""); err == nil {
+		t.Error("❌ image is copied with wrong source credentials")
+	}
+}
@@ -43,8 +43,9 @@ func StopAndRemoveContainer(containerID string) error {
 	return nil
 }
 
-// DestroyLocalRegistry stops and removes the local Docker registry based on the ID stored in the profile
-func DestroyLocalRegistry() error {
+// DestroyLocalRegistry stops and removes the local Docker registry based on the ID stored in the profile.
+// Registry data stored in a volume or a host directory is kept unless purge is set
+func DestroyLocalRegistry(purge bool) error {
 	profilePath, err := parser.GetProfilePath()
 	if err != nil {
 		return fmt.Errorf("❌ failed to get profile path: %w", err)
@@ -55,5 +56,30 @@ func DestroyLocalRegistry() error {
 		return fmt.Errorf("❌ failed to load or create profile: %w", err)
 	}
 
-	return StopAndRemoveContainer(profile.LocalRegistry.RegistryID)
+	if profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry is not found in profile")
+	}
+	if err := stopListener(profile.LocalRegistry); err != nil {
+		return err
+	}
+	if err := stopGateway(profile.LocalRegistry); err != nil {
+		return err
+	}
+	if profile.LocalRegistry.EmbeddedPID != 0 {
+		if err := stopEmbedded(profile.LocalRegistry); err != nil {
+			return err
+		}
+	} else if err := StopAndRemoveContainer(profile.LocalRegistry.RegistryID); err != nil {
+		return err
+	}
+	if !purge {
+		return nil
+	}
+	var cli *client.Client
+	if profile.LocalRegistry.Volume != "" {
+		if cli, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation()); err != nil {
+			return fmt.Errorf("❌ failed to create Docker client: %w", err)
+		}
+	}
+	return purgeStorage(cli, context.Background(), profile.LocalRegistry)
 }
@@ -0,0 +1,88 @@
+package local_registry
+
+import (
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+const (
+	distributionHtpasswdPath  = "/htpasswd"
+	distributionTokenCertPath = "/etc/docker/registry/token.crt"
+	distributionConfigPath    = "/etc/docker/registry/config.yml"
+)
+
+// distributionBackend runs CNCF distribution, the reference implementation of the registry API
+type distributionBackend struct{}
+
+func (distributionBackend) Image(config *parser.Config) string {
+	return imageRef(config, "registry", "2")
+}
+
+func (distributionBackend) Port() int {
+	return 5000
+}
+
+// RenderConfig renders `registry.config` from locreg.yaml with htpasswd auth enabled
+func (distributionBackend) RenderConfig(config *parser.Config) ([]ConfigFile, error) {
+	distributionConfig, err := NewDistributionConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	file, err := renderDistributionConfig(distributionConfig)
+	if err != nil {
+		return nil, err
+	}
+	return []ConfigFile{file}, nil
+}
+
+// RenderReadOnlyConfig renders the config with maintenance read-only mode enabled
+func (distributionBackend) RenderReadOnlyConfig(config *parser.Config) (ConfigFile, error) {
+	distributionConfig, err := NewDistributionConfig(config)
+	if err != nil {
+		return ConfigFile{}, err
+	}
+	distributionConfig.Storage.Maintenance = &DistributionMaintenance{ReadOnly: DistributionEnabled{Enabled: true}}
+	return renderDistributionConfig(distributionConfig)
+}
+
+// GarbageCollectCommand returns the command removing blobs that are not referenced by any manifest
+func (distributionBackend) GarbageCollectCommand(deleteUntagged bool) []string {
+	cmd := []string{"registry", "garbage-collect", distributionConfigPath}
+	if deleteUntagged {
+		cmd = append(cmd, "--delete-untagged")
+	}
+	return cmd
+}
+
+func (distributionBackend) SetupAuth(username, password string) ([]ConfigFile, error) {
+	file, err := htpasswd(distributionHtpasswdPath, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return []ConfigFile{file}, nil
+}
+
+// SetupTokenAuth returns the certificate the registry verifies tokens with
+func (distributionBackend) SetupTokenAuth(certificate []byte) []ConfigFile {
+	return []ConfigFile{{Path: distributionTokenCertPath, Content: certificate}}
+}
+
+// DataDirectory returns root directory of filesystem storage driver
+func (distributionBackend) DataDirectory(config *parser.Config) string {
+	return valueOrDefault(config.Registry.Config.Storage.Parameters["rootdirectory"], distributionRootDirectory)
+}
+
+// HealthEndpoint returns the API version check, it answers with 401 when auth is enabled
+func (distributionBackend) HealthEndpoint() string {
+	return "/v2/"
+}
+
+func renderDistributionConfig(distributionConfig *DistributionConfig) (ConfigFile, error) {
+	content, err := distributionConfig.Render()
+	if err != nil {
+		return ConfigFile{}, err
+	}
+	return ConfigFile{
+		Path:    distributionConfigPath,
+		Content: content,
+	}, nil
+}
@@ -0,0 +1,300 @@
+package local_registry
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// distributionRootDirectory is the directory where filesystem storage driver keeps the images
+const distributionRootDirectory = "/var/lib/registry"
+
+var (
+	distributionLogLevels      = []string{"error", "warn", "info", "debug"}
+	distributionLogFormatters  = []string{"text", "json", "logstash"}
+	distributionStorageDrivers = []string{"filesystem", "inmemory", "s3", "azure", "gcs"}
+)
+
+// DistributionConfig is the subset of the distribution configuration file managed by locreg,
+// see https://distribution.github.io/distribution/about/configuration/
+type DistributionConfig struct {
+	Version       string                     `yaml:"version"`
+	Log           DistributionLog            `yaml:"log"`
+	Storage       DistributionStorage        `yaml:"storage"`
+	HTTP          DistributionHTTP           `yaml:"http"`
+	Health        DistributionHealth         `yaml:"health"`
+	Auth          DistributionAuth           `yaml:"auth"`
+	Notifications *DistributionNotifications `yaml:"notifications,omitempty"`
+	Proxy         *DistributionProxy         `yaml:"proxy,omitempty"`
+}
+
+type DistributionLog struct {
+	Level     string            `yaml:"level"`
+	Formatter string            `yaml:"formatter,omitempty"`
+	Fields    map[string]string `yaml:"fields,omitempty"`
+}
+
+// DistributionStorage holds the parameters of the storage driver under the driver name
+type DistributionStorage struct {
+	Drivers     map[string]map[string]string `yaml:",inline"`
+	Delete      *DistributionEnabled         `yaml:"delete,omitempty"`
+	Cache       map[string]string            `yaml:"cache,omitempty"`
+	Maintenance *DistributionMaintenance     `yaml:"maintenance,omitempty"`
+}
+
+type DistributionMaintenance struct {
+	ReadOnly DistributionEnabled `yaml:"readonly"`
+}
+
+type DistributionEnabled struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type DistributionHTTP struct {
+	Addr    string              `yaml:"addr"`
+	Headers map[string][]string `yaml:"headers,omitempty"`
+}
+
+type DistributionHealth struct {
+	StorageDriver struct {
+		Enabled   bool   `yaml:"enabled"`
+		Interval  string `yaml:"interval"`
+		Threshold int    `yaml:"threshold"`
+	} `yaml:"storagedriver"`
+}
+
+type DistributionAuth struct {
+	Htpasswd *DistributionHtpasswd `yaml:"htpasswd,omitempty"`
+	Token    *DistributionToken    `yaml:"token,omitempty"`
+}
+
+type DistributionToken struct {
+	Realm          string `yaml:"realm"`
+	Service        string `yaml:"service"`
+	Issuer         string `yaml:"issuer"`
+	RootCertBundle string `yaml:"rootcertbundle"`
+}
+
+type DistributionHtpasswd struct {
+	Realm string `yaml:"realm"`
+	Path  string `yaml:"path"`
+}
+
+type DistributionNotifications struct {
+	Endpoints []DistributionEndpoint `yaml:"endpoints"`
+}
+
+type DistributionEndpoint struct {
+	Name      string              `yaml:"name"`
+	URL       string              `yaml:"url"`
+	Headers   map[string][]string `yaml:"headers,omitempty"`
+	Timeout   string              `yaml:"timeout,omitempty"`
+	Threshold int                 `yaml:"threshold,omitempty"`
+	Backoff   string              `yaml:"backoff,omitempty"`
+	Ignore    *DistributionIgnore `yaml:"ignore,omitempty"`
+}
+
+type DistributionIgnore struct {
+	Actions []string `yaml:"actions,omitempty"`
+}
+
+type DistributionProxy struct {
+	RemoteURL string `yaml:"remoteurl"`
+	Username  string `yaml:"username,omitempty"`
+	Password  string `yaml:"password,omitempty"`
+}
+
+// NewDistributionConfig builds the distribution configuration from `registry.config` in locreg.yaml
+func NewDistributionConfig(config *parser.Config) (*DistributionConfig, error) {
+	registryConfig := config.Registry.Config
+	if err := validateDistributionConfig(config); err != nil {
+		return nil, err
+	}
+
+	distributionConfig := &DistributionConfig{
+		Version: "0.1",
+		Log: DistributionLog{
+			Level:     valueOrDefault(registryConfig.Log.Level, "info"),
+			Formatter: registryConfig.Log.Formatter,
+			Fields:    map[string]string{"service": "registry"},
+		},
+		HTTP: DistributionHTTP{
+			Addr: fmt.Sprintf(":%d", distributionBackend{}.Port()),
+			Headers: map[string][]string{
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+	}
+	if config.IsTokenAuthEnabled() {
+		// Realm is rewritten by the gateway to the origin used by the client
+		distributionConfig.Auth.Token = &DistributionToken{
+			Realm:          fmt.Sprintf("http://localhost:%d/token", config.Registry.Port),
+			Service:        config.Registry.Auth.Token.Service,
+			Issuer:         config.Registry.Auth.Token.Issuer,
+			RootCertBundle: distributionTokenCertPath,
+		}
+	} else {
+		distributionConfig.Auth.Htpasswd = &DistributionHtpasswd{
+			Realm: "basic-realm",
+			Path:  distributionHtpasswdPath,
+		}
+	}
+	for name, values := range registryConfig.HTTP.Headers {
+		distributionConfig.HTTP.Headers[name] = values
+	}
+
+	driver := valueOrDefault(registryConfig.Storage.Driver, "filesystem")
+	parameters := map[string]string{}
+	for name, value := range registryConfig.Storage.Parameters {
+		parameters[name] = value
+	}
+	if driver == "filesystem" && parameters["rootdirectory"] == "" {
+		parameters["rootdirectory"] = distributionRootDirectory
+	}
+	distributionConfig.Storage = DistributionStorage{
+		Drivers: map[string]map[string]string{driver: parameters},
+		Cache:   map[string]string{"blobdescriptor": "inmemory"},
+	}
+	// Retention deletes tags through the API, which is rejected unless deletes are enabled
+	if registryConfig.Storage.Delete || config.IsRetentionEnabled() {
+		distributionConfig.Storage.Delete = &DistributionEnabled{Enabled: true}
+	}
+
+	distributionConfig.Health.StorageDriver.Enabled = true
+	distributionConfig.Health.StorageDriver.Interval = "10s"
+	distributionConfig.Health.StorageDriver.Threshold = 3
+
+	for _, endpoint := range registryConfig.Notifications.Endpoints {
+		if distributionConfig.Notifications == nil {
+			distributionConfig.Notifications = &DistributionNotifications{}
+		}
+		distributionConfig.Notifications.Endpoints = append(distributionConfig.Notifications.Endpoints, DistributionEndpoint{
+			Name:      endpoint.Name,
+			URL:       endpoint.URL,
+			Headers:   endpoint.Headers,
+			Timeout:   endpoint.Timeout,
+			Threshold: endpoint.Threshold,
+			Backoff:   endpoint.Backoff,
+		})
+	}
+
+	if config.IsRedeployOnPushEnabled() {
+		endpoint, err := notificationEndpoint(config)
+		if err != nil {
+			return nil, err
+		}
+		if distributionConfig.Notifications == nil {
+			distributionConfig.Notifications = &DistributionNotifications{}
+		}
+		distributionConfig.Notifications.Endpoints = append(distributionConfig.Notifications.Endpoints, endpoint)
+	}
+
+	if registryConfig.Proxy.RemoteURL != "" {
+		distributionConfig.Proxy = &DistributionProxy{
+			RemoteURL: registryConfig.Proxy.RemoteURL,
+			Username:  registryConfig.Proxy.Username,
+			Password:  registryConfig.Proxy.Password,
+		}
+	}
+	return distributionConfig, nil
+}
+
+// Render returns the configuration in YAML format expected by the registry
+func (distributionConfig *DistributionConfig) Render() ([]byte, error) {
+	content, err := yaml.Marshal(distributionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to render registry config: %w", err)
+	}
+	return content, nil
+}
+
+// validateDistributionConfig checks `registry.config` so that the registry doesn't fail on startup
+func validateDistributionConfig(config *parser.Config) error {
+	registryConfig := config.Registry.Config
+	if err := validateOneOf("registry.config.log.level", registryConfig.Log.Level, distributionLogLevels); err != nil {
+		return err
+	}
+	if err := validateOneOf("registry.config.log.formatter", registryConfig.Log.Formatter, distributionLogFormatters); err != nil {
+		return err
+	}
+	if err := validateOneOf("registry.config.storage.driver", registryConfig.Storage.Driver, distributionStorageDrivers); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for i, endpoint := range registryConfig.Notifications.Endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("❌ registry.config.notifications.endpoints[%d]: name must be set", i)
+		}
+		if names[endpoint.Name] || (endpoint.Name == notificationsEndpointName && config.IsRedeployOnPushEnabled()) {
+			return fmt.Errorf("❌ registry.config.notifications.endpoints[%d]: duplicate name %q", i, endpoint.Name)
+		}
+		names[endpoint.Name] = true
+		if err := validateURL(fmt.Sprintf("registry.config.notifications.endpoints[%d].url", i), endpoint.URL); err != nil {
+			return err
+		}
+		for key, value := range map[string]string{"timeout": endpoint.Timeout, "backoff": endpoint.Backoff} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("❌ registry.config.notifications.endpoints[%d].%s: %w", i, key, err)
+			}
+		}
+		if endpoint.Threshold < 0 {
+			return fmt.Errorf("❌ registry.config.notifications.endpoints[%d].threshold must not be negative", i)
+		}
+	}
+
+	return validateProxy(config)
+}
+
+// validateProxy checks `registry.config.proxy`
+func validateProxy(config *parser.Config) error {
+	proxy := config.Registry.Config.Proxy
+	if proxy.RemoteURL != "" {
+		if err := validateURL("registry.config.proxy.remoteurl", proxy.RemoteURL); err != nil {
+			return err
+		}
+	}
+	if (proxy.Username == "") != (proxy.Password == "") {
+		return fmt.Errorf("❌ registry.config.proxy: both username and password must be set")
+	}
+	if proxy.Username != "" && proxy.RemoteURL == "" {
+		return fmt.Errorf("❌ registry.config.proxy: remoteurl must be set")
+	}
+	return nil
+}
+
+func validateOneOf(key, value string, allowed []string) error {
+	if value == "" {
+		return nil
+	}
+	for _, v := range allowed {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("❌ %s must be one of %v, got %q", key, allowed, value)
+}
+
+func validateURL(key, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("❌ %s is not a valid URL: %w", key, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("❌ %s must be an http or https URL, got %q", key, value)
+	}
+	return nil
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
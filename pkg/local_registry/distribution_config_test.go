@@ -0,0 +1,81 @@
+package local_registry
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewDistributionConfig(t *testing.T) {
+	config, err := parser.LoadConfig(filepath.Join(getProjectRoot(), "test", "test_configs", "registry", "locreg_config.yaml"))
+	if err != nil {
+		t.Fatalf("❌ failed to load config: %v", err)
+	}
+	distributionConfig, err := NewDistributionConfig(config)
+	if err != nil {
+		t.Fatalf("❌ failed to build registry config: %v", err)
+	}
+	content, err := distributionConfig.Render()
+	if err != nil {
+		t.Fatalf("❌ failed to render registry config: %v", err)
+	}
+
+	var rendered map[string]any
+	if err := yaml.Unmarshal(content, &rendered); err != nil {
+		t.Fatalf("❌ rendered config is not valid YAML: %v", err)
+	}
+	storage := rendered["storage"].(map[string]any)
+	if storage["filesystem"].(map[string]any)["rootdirectory"] != distributionRootDirectory {
+		t.Errorf("❌ filesystem storage is not rendered: %v", storage)
+	}
+	if storage["delete"].(map[string]any)["enabled"] != true {
+		t.Errorf("❌ storage delete is not enabled: %v", storage)
+	}
+	if level := rendered["log"].(map[string]any)["level"]; level != "debug" {
+		t.Errorf("❌ expected log level debug, got %v", level)
+	}
+	if _, ok := distributionConfig.HTTP.Headers["access-control-allow-origin"]; !ok {
+		t.Errorf("❌ custom header is not rendered: %v", distributionConfig.HTTP.Headers)
+	}
+	if len(distributionConfig.HTTP.Headers["X-Content-Type-Options"]) == 0 {
+		t.Errorf("❌ default header is not rendered: %v", distributionConfig.HTTP.Headers)
+	}
+	if endpoints := distributionConfig.Notifications.Endpoints; len(endpoints) != 1 || endpoints[0].Timeout != "1s" {
+		t.Errorf("❌ unexpected notification endpoints: %v", endpoints)
+	}
+	if distributionConfig.Proxy == nil || distributionConfig.Proxy.RemoteURL != "https://registry-1.docker.io" {
+		t.Errorf("❌ proxy is not rendered: %v", distributionConfig.Proxy)
+	}
+	if distributionConfig.Auth.Htpasswd == nil || distributionConfig.Auth.Htpasswd.Path != distributionHtpasswdPath {
+		t.Errorf("❌ htpasswd auth is not rendered: %v", distributionConfig.Auth)
+	}
+}
+
+func TestValidateDistributionConfig(t *testing.T) {
+	for name, update := range map[string]func(config *parser.Config){
+		"log level":      func(config *parser.Config) { config.Registry.Config.Log.Level = "verbose" },
+		"storage driver": func(config *parser.Config) { config.Registry.Config.Storage.Driver = "ftp" },
+		"proxy url":      func(config *parser.Config) { config.Registry.Config.Proxy.RemoteURL = "registry-1.docker.io" },
+		"proxy password": func(config *parser.Config) {
+			config.Registry.Config.Proxy.RemoteURL = "https://registry-1.docker.io"
+			config.Registry.Config.Proxy.Username = "user"
+		},
+	} {
+		config := &parser.Config{}
+		update(config)
+		if _, err := NewDistributionConfig(config); err == nil {
+			t.Errorf("❌ invalid %s is accepted", name)
+		}
+	}
+
+	config, err := parser.LoadConfig(filepath.Join(getProjectRoot(), "test", "test_configs", "registry", "locreg_config.yaml"))
+	if err != nil {
+		t.Fatalf("❌ failed to load config: %v", err)
+	}
+	config.Registry.Config.Notifications.Endpoints[0].Timeout = "soon"
+	if _, err := NewDistributionConfig(config); err == nil {
+		t.Error("❌ invalid notification timeout is accepted")
+	}
+}
@@ -0,0 +1,318 @@
+package local_registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// EmbeddedBackend is the backend served by a locreg process instead of a registry container
+	EmbeddedBackend = "embedded"
+	// embeddedDaemonName is the name of the background process serving the embedded registry
+	embeddedDaemonName = "registry-embedded"
+	// embeddedHealthEndpoint answers with 200 or 401 once the embedded registry is serving requests
+	embeddedHealthEndpoint = "/v2/"
+)
+
+// EmbeddedDaemonArgs are the locreg arguments that run the embedded registry daemon, the storage directory is appended
+var EmbeddedDaemonArgs = []string{"registry", "serve", "--storage"}
+
+// isEmbedded checks if the registry is served by locreg itself
+func isEmbedded(config *parser.Config) bool {
+	return config.Registry.Backend == EmbeddedBackend
+}
+
+// runEmbeddedRegistry starts the embedded registry daemon with the configuration, Docker isn't needed
+func runEmbeddedRegistry(ctx context.Context, config *parser.Config) error {
+	if err := validateEmbedded(config); err != nil {
+		return err
+	}
+	if err := validateNotifications(config); err != nil {
+		return err
+	}
+	storagePath, persistent, err := embeddedStoragePath(config)
+	if err != nil {
+		return err
+	}
+	users, err := configuredUsers(config)
+	if err != nil {
+		return err
+	}
+	if err := writeEmbeddedHtpasswd(config.Registry.Username, config.Registry.Password); err != nil {
+		return err
+	}
+
+	localRegistry := &parser.LocalRegistry{
+		Username: config.Registry.Username,
+		Password: config.Registry.Password,
+		Users:    users,
+	}
+	if persistent {
+		localRegistry.DataPath = storagePath
+	}
+	gateway := config.IsRegistryGatewayEnabled()
+	if gateway {
+		// Registry port is taken by the gateway, the embedded registry listens on a random local port instead
+		if localRegistry.Upstream, err = freeLocalAddress(); err != nil {
+			return err
+		}
+	}
+	if err := writeProfileLocalRegistry(localRegistry); err != nil {
+		return fmt.Errorf("❌ failed to write profile: %w", err)
+	}
+
+	if err := startEmbedded(storagePath); err != nil {
+		return errors.Join(err, writeProfileLocalRegistry(nil))
+	}
+	logHint := daemonLogHint(embeddedDaemonName)
+	if gateway {
+		if err := startGateway(); err != nil {
+			return errors.Join(err, destroyFailedRegistry())
+		}
+		logHint += " and " + daemonLogHint(gatewayDaemonName)
+	}
+	if err := waitForHealthy(ctx, config, embeddedHealthEndpoint, config.Registry.Username, config.Registry.Password); err != nil {
+		return errors.Join(fmt.Errorf("%w, see %s", err, logHint), destroyFailedRegistry())
+	}
+	if config.IsRedeployOnPushEnabled() {
+		if err := startListener(); err != nil {
+			return errors.Join(err, destroyFailedRegistry())
+		}
+		fmt.Printf("✅ Pushes of %s redeploy cloud resources, see %s\n", config.GetRegistryImage(), daemonLogHint(listenerDaemonName))
+	}
+	fmt.Printf("✅ Embedded registry is serving images from %s\n", storagePath)
+	return nil
+}
+
+// RunEmbeddedRegistry serves the embedded registry from the storage directory until SIGTERM or SIGINT is received.
+// It listens on the registry port, or on the upstream address recorded in the profile when the gateway is in front of it
+func RunEmbeddedRegistry(config *parser.Config, storagePath string) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry is not found in profile")
+	}
+	address := fmt.Sprintf(":%d", config.Registry.Port)
+	if profile.LocalRegistry.Upstream != "" {
+		address = profile.LocalRegistry.Upstream
+	}
+	storage, err := embedded.NewStorage(storagePath)
+	if err != nil {
+		return err
+	}
+	htpasswdPath, err := embeddedHtpasswdPath()
+	if err != nil {
+		return err
+	}
+	htpasswd, err := embedded.NewHtpasswd(htpasswdPath)
+	if err != nil {
+		return err
+	}
+	handler := &embedded.Server{Storage: storage, Authenticate: htpasswd.Authenticate}
+	if config.IsRedeployOnPushEnabled() {
+		if handler.OnManifestPush, err = notifyListener(config); err != nil {
+			return err
+		}
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("✅ Embedded registry is listening on %s and serving images from %s", address, storagePath)
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		return fmt.Errorf("❌ embedded registry failed: %w", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// notifyListener returns the hook of the embedded registry posting pushes to the notification listener
+func notifyListener(config *parser.Config) (func(name, tag string, d digest.Digest, mediaType string), error) {
+	secret, err := notificationSecret()
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", config.Registry.Notifications.Port, notificationsPath)
+	return func(name, tag string, d digest.Digest, mediaType string) {
+		event := PushEvent{Repository: name, Tag: tag, Digest: d.String()}
+		// Push is answered without waiting for the listener, like distribution queues its events
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := postPushEvent(ctx, url, secret, event, mediaType); err != nil {
+				log.Printf("❌ failed to notify about push of %s:%s: %v", name, tag, err)
+			}
+		}()
+	}, nil
+}
+
+// startEmbedded runs the embedded registry daemon and records its PID in the profile
+func startEmbedded(storagePath string) error {
+	pid, err := daemon.Spawn(embeddedDaemonName, append(EmbeddedDaemonArgs, storagePath)...)
+	if err != nil {
+		return err
+	}
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		localRegistry.EmbeddedPID = pid
+		return nil
+	})
+	if err != nil {
+		_ = daemon.Stop(pid)
+		return err
+	}
+	return nil
+}
+
+// stopEmbedded stops the embedded registry daemon recorded in the profile. Registry data is removed
+// unless it is kept in `registry.storage`
+func stopEmbedded(localRegistry *parser.LocalRegistry) error {
+	if err := daemon.Stop(localRegistry.EmbeddedPID); err != nil {
+		return fmt.Errorf("❌ failed to stop embedded registry: %w", err)
+	}
+	fmt.Println("✅ Embedded registry stopped")
+	if localRegistry.DataPath != "" {
+		return nil
+	}
+	storagePath, err := defaultEmbeddedStoragePath()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(storagePath); err != nil {
+		return fmt.Errorf("❌ failed to remove registry data in %s: %w", storagePath, err)
+	}
+	return nil
+}
+
+// garbageCollectEmbedded stops the embedded registry, so nothing is pushed during the collection, collects garbage
+// in its storage directory and starts it again
+func garbageCollectEmbedded(config *parser.Config, localRegistry *parser.LocalRegistry, deleteUntagged bool) (string, error) {
+	storagePath, _, err := embeddedStoragePath(config)
+	if err != nil {
+		return "", err
+	}
+	storage, err := embedded.NewStorage(storagePath)
+	if err != nil {
+		return "", err
+	}
+	log.Println("Stopping embedded registry...")
+	if err := daemon.Stop(localRegistry.EmbeddedPID); err != nil {
+		return "", fmt.Errorf("❌ failed to stop embedded registry: %w", err)
+	}
+	removed, freed, err := storage.GarbageCollect(deleteUntagged)
+	output := fmt.Sprintf("%d blobs removed, %s freed\n", removed, FormatSize(freed))
+	log.Println("Starting embedded registry...")
+	if startErr := startEmbedded(storagePath); startErr != nil {
+		return output, fmt.Errorf("❌ embedded registry is not running: %w", startErr)
+	}
+	if err != nil {
+		return output, fmt.Errorf("❌ garbage collection failed: %w", err)
+	}
+	return output, waitForHealthy(context.Background(), config, embeddedHealthEndpoint, localRegistry.Username, localRegistry.Password)
+}
+
+// validateEmbedded checks that only features supported by the embedded registry are configured
+func validateEmbedded(config *parser.Config) error {
+	if config.IsTokenAuthEnabled() {
+		return fmt.Errorf("❌ token authentication is not supported by %s registry backend", EmbeddedBackend)
+	}
+	if config.Registry.Config.Proxy.RemoteURL != "" {
+		return fmt.Errorf("❌ registry.config.proxy is not supported by %s registry backend", EmbeddedBackend)
+	}
+	if driver := config.Registry.Config.Storage.Driver; driver != "" && driver != "filesystem" {
+		return fmt.Errorf("❌ %s registry backend stores images only on the filesystem, got %s driver", EmbeddedBackend, driver)
+	}
+	return nil
+}
+
+// embeddedStoragePath returns the directory the embedded registry stores images in and whether it is kept
+// on destroy, which is the case when `registry.storage` is set
+func embeddedStoragePath(config *parser.Config) (string, bool, error) {
+	storage := config.Registry.Storage
+	persistent := storage.Volume != "" || storage.Path != ""
+	if storage.Path == "" {
+		path, err := defaultEmbeddedStoragePath()
+		return path, persistent, err
+	}
+	path, err := filepath.Abs(storage.Path)
+	if err != nil {
+		return "", false, fmt.Errorf("❌ failed to resolve registry storage path: %w", err)
+	}
+	return path, persistent, nil
+}
+
+// defaultEmbeddedStoragePath is used when `registry.storage.path` is not set
+func defaultEmbeddedStoragePath() (string, error) {
+	dir, err := daemon.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registry-data"), nil
+}
+
+// embeddedHtpasswdPath returns the htpasswd file checked by the embedded registry
+func embeddedHtpasswdPath() (string, error) {
+	dir, err := daemon.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registry.htpasswd"), nil
+}
+
+// writeEmbeddedHtpasswd replaces credentials accepted by the embedded registry, the running registry picks them up
+func writeEmbeddedHtpasswd(username, password string) error {
+	path, err := embeddedHtpasswdPath()
+	if err != nil {
+		return err
+	}
+	file, err := htpasswd(path, username, password)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("❌ failed to create daemon directory: %w", err)
+	}
+	// Running registry reloads the file when it changes, so it must never see it partially written
+	if err := embedded.WriteFile(path, file.Content, 0600); err != nil {
+		return fmt.Errorf("❌ failed to write htpasswd file: %w", err)
+	}
+	return nil
+}
+
+// freeLocalAddress returns a loopback address with a port that is free at the moment
+func freeLocalAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
+
+// destroyFailedRegistry stops a registry that failed to start and removes it from the profile
+func destroyFailedRegistry() error {
+	return errors.Join(DestroyLocalRegistry(false), writeProfileLocalRegistry(nil))
+}
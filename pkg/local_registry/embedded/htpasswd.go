@@ -0,0 +1,88 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd checks credentials against an htpasswd file with bcrypt hashes. The file is read again
+// when it changes, so credentials are rotated without restarting the registry
+type Htpasswd struct {
+	path string
+
+	mu       sync.Mutex
+	file     os.FileInfo
+	users    map[string][]byte     // Password hashes by username
+	verified map[[32]byte]struct{} // Credentials that matched the bcrypt hash, so it isn't computed on every request
+}
+
+// NewHtpasswd returns the authenticator reading the htpasswd file
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	htpasswd := &Htpasswd{path: path}
+	if err := htpasswd.reload(); err != nil {
+		return nil, err
+	}
+	return htpasswd, nil
+}
+
+// Authenticate checks the username and the password, failures to read the file reject the credentials
+func (htpasswd *Htpasswd) Authenticate(username, password string) bool {
+	htpasswd.mu.Lock()
+	defer htpasswd.mu.Unlock()
+	if err := htpasswd.reload(); err != nil {
+		return false
+	}
+	hash, ok := htpasswd.users[username]
+	if !ok {
+		return false
+	}
+	// Only successful checks are cached, caching failures would let anyone grow the cache with random passwords
+	key := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + string(hash)))
+	if _, ok := htpasswd.verified[key]; ok {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	htpasswd.verified[key] = struct{}{}
+	return true
+}
+
+// reload reads the file if it was replaced or modified since it was read last time
+func (htpasswd *Htpasswd) reload() error {
+	info, err := os.Stat(htpasswd.path)
+	if err != nil {
+		return fmt.Errorf("❌ failed to read htpasswd file: %w", err)
+	}
+	if htpasswd.users != nil && os.SameFile(info, htpasswd.file) &&
+		info.ModTime().Equal(htpasswd.file.ModTime()) && info.Size() == htpasswd.file.Size() {
+		return nil
+	}
+	content, err := os.ReadFile(htpasswd.path)
+	if err != nil {
+		return fmt.Errorf("❌ failed to read htpasswd file: %w", err)
+	}
+	users := map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || !strings.HasPrefix(hash, "$2") {
+			return fmt.Errorf("❌ htpasswd file must contain username:bcrypt-hash lines")
+		}
+		users[username] = []byte(hash)
+	}
+	htpasswd.users, htpasswd.file = users, info
+	htpasswd.verified = map[[32]byte]struct{}{}
+	return nil
+}
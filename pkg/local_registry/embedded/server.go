@@ -0,0 +1,431 @@
+// Package embedded is a container registry serving the OCI distribution API from a directory,
+// it is run by locreg itself when `registry.backend` is set to embedded
+package embedded
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// maxManifestSize is the size of the largest manifest accepted by the registry
+const maxManifestSize = 4 << 20
+
+var (
+	// route matches the repository name, the endpoint and the reference of API paths under /v2/
+	route = regexp.MustCompile(`^(.+)/(manifests|blobs/uploads|blobs)/([^/]*)$`)
+	// repositoryName matches valid repository names, it also keeps names from escaping the storage directory
+	repositoryName = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	tagName        = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	uploadID       = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// Server serves the OCI distribution API from the storage
+type Server struct {
+	Storage *Storage
+	// Authenticate checks basic auth credentials, requests aren't authenticated if it is nil
+	Authenticate func(username, password string) bool
+	// OnManifestPush is called after a manifest is pushed by tag, pushes by digest aren't reported
+	OnManifestPush func(name, tag string, d digest.Digest, mediaType string)
+}
+
+// apiError is an error reported in the error format of the Registry HTTP API
+type apiError struct {
+	status int
+	code   string
+}
+
+// apiErrors maps errors of the storage to the error codes of the Registry HTTP API
+var apiErrors = map[error]apiError{
+	ErrBlobUnknown:         {http.StatusNotFound, "BLOB_UNKNOWN"},
+	ErrManifestUnknown:     {http.StatusNotFound, "MANIFEST_UNKNOWN"},
+	ErrNameUnknown:         {http.StatusNotFound, "NAME_UNKNOWN"},
+	ErrUploadUnknown:       {http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN"},
+	ErrManifestInvalid:     {http.StatusBadRequest, "MANIFEST_INVALID"},
+	ErrManifestBlobUnknown: {http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN"},
+	ErrDigestInvalid:       {http.StatusBadRequest, "DIGEST_INVALID"},
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if server.Authenticate != nil {
+		username, password, ok := r.BasicAuth()
+		if !ok || !server.Authenticate(username, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="locreg"`)
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case r.URL.Path == "/v2/" || r.URL.Path == "/v2":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+		return
+	case !strings.HasPrefix(r.URL.Path, "/v2/"):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	case path == "_catalog":
+		server.handle(w, r, map[string]handler{http.MethodGet: server.catalog}, "")
+		return
+	case strings.HasSuffix(path, "/tags/list"):
+		server.handle(w, r, map[string]handler{http.MethodGet: server.tags}, strings.TrimSuffix(path, "/tags/list"))
+		return
+	}
+
+	match := route.FindStringSubmatch(path)
+	if match == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	name, endpoint, reference := match[1], match[2], match[3]
+	var handlers map[string]handler
+	switch {
+	case endpoint == "manifests":
+		handlers = map[string]handler{
+			http.MethodGet:    server.manifest(reference),
+			http.MethodHead:   server.manifest(reference),
+			http.MethodPut:    server.putManifest(reference),
+			http.MethodDelete: server.deleteManifest(reference),
+		}
+	case endpoint == "blobs":
+		handlers = map[string]handler{
+			http.MethodGet:    server.blob(reference),
+			http.MethodHead:   server.blob(reference),
+			http.MethodDelete: server.deleteBlob(reference),
+		}
+	case reference == "":
+		handlers = map[string]handler{http.MethodPost: server.startUpload}
+	case !uploadID.MatchString(reference):
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	default:
+		handlers = map[string]handler{
+			http.MethodGet:    server.uploadStatus(reference),
+			http.MethodPatch:  server.patchUpload(reference),
+			http.MethodPut:    server.finishUpload(reference),
+			http.MethodDelete: server.cancelUpload(reference),
+		}
+	}
+	server.handle(w, r, handlers, name)
+}
+
+// handler serves a request to the repository, the returned error is written in the Registry HTTP API format
+type handler func(w http.ResponseWriter, r *http.Request, name string) error
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request, handlers map[string]handler, name string) {
+	h, ok := handlers[r.Method]
+	if !ok {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "the operation is unsupported")
+		return
+	}
+	if name != "" && !repositoryName.MatchString(name) {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", "invalid repository name")
+		return
+	}
+	err := h(w, r, name)
+	if err == nil {
+		return
+	}
+	for sentinel, apiErr := range apiErrors {
+		if errors.Is(err, sentinel) {
+			writeError(w, apiErr.status, apiErr.code, err.Error())
+			return
+		}
+	}
+	log.Printf("❌ %s %s failed: %v", r.Method, r.URL.Path, err)
+	writeError(w, http.StatusInternalServerError, "UNKNOWN", "unknown error")
+}
+
+func (server *Server) catalog(w http.ResponseWriter, r *http.Request, _ string) error {
+	repositories, err := server.Storage.Repositories()
+	if err != nil {
+		return err
+	}
+	page, next := paginate(r, repositories)
+	return writePage(w, next, map[string]any{"repositories": page})
+}
+
+func (server *Server) tags(w http.ResponseWriter, r *http.Request, name string) error {
+	tags, err := server.Storage.Tags(name)
+	if err != nil {
+		return err
+	}
+	page, next := paginate(r, tags)
+	return writePage(w, next, map[string]any{"name": name, "tags": page})
+}
+
+func (server *Server) manifest(reference string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		if err := validateReference(reference); err != nil {
+			return err
+		}
+		content, mediaType, d, err := server.Storage.GetManifest(name, reference)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, d))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+		return nil
+	}
+}
+
+func (server *Server) putManifest(reference string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		if err := validateReference(reference); err != nil {
+			return err
+		}
+		content, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+		if err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+		if len(content) > maxManifestSize {
+			return fmt.Errorf("%w: manifest is larger than %d bytes", ErrManifestInvalid, maxManifestSize)
+		}
+		mediaType := r.Header.Get("Content-Type")
+		d, err := server.Storage.PutManifest(name, reference, mediaType, content)
+		if err != nil {
+			return err
+		}
+		if server.OnManifestPush != nil && tagName.MatchString(reference) {
+			server.OnManifestPush(name, reference, d, mediaType)
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", name, d))
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	}
+}
+
+func (server *Server) deleteManifest(reference string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		if err := validateReference(reference); err != nil {
+			return err
+		}
+		if err := server.Storage.DeleteManifest(name, reference); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+func (server *Server) blob(reference string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		d, err := parseDigest(reference)
+		if err != nil {
+			return err
+		}
+		file, err := server.Storage.OpenBlob(name, d)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, d))
+		// ServeContent handles Range requests and skips the body of HEAD requests
+		http.ServeContent(w, r, "", time.Time{}, file)
+		return nil
+	}
+}
+
+func (server *Server) deleteBlob(reference string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		d, err := parseDigest(reference)
+		if err != nil {
+			return err
+		}
+		if err := server.Storage.DeleteBlob(name, d); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+// startUpload mounts the blob from another repository, uploads the whole blob in a single request
+// if its digest is set, or starts an upload the blob is sent to in chunks otherwise
+func (server *Server) startUpload(w http.ResponseWriter, r *http.Request, name string) error {
+	query := r.URL.Query()
+	if mount, from := query.Get("mount"), query.Get("from"); mount != "" && repositoryName.MatchString(from) {
+		if d, err := parseDigest(mount); err == nil && server.Storage.MountBlob(from, name, d) == nil {
+			return blobCreated(w, name, d)
+		}
+		// Client falls back to the upload if the blob can't be mounted
+	}
+	id, err := server.Storage.StartUpload()
+	if err != nil {
+		return err
+	}
+	if query.Get("digest") != "" {
+		return server.finishUpload(id)(w, r, name)
+	}
+	return uploadAccepted(w, name, id, 0)
+}
+
+func (server *Server) uploadStatus(id string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		size, err := server.Storage.UploadSize(id)
+		if err != nil {
+			return err
+		}
+		return uploadAccepted(w, name, id, size)
+	}
+}
+
+func (server *Server) patchUpload(id string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		size, err := server.Storage.UploadSize(id)
+		if err != nil {
+			return err
+		}
+		if start, ok := contentRangeStart(r.Header.Get("Content-Range")); ok && start != size {
+			w.Header().Set("Location", uploadLocation(name, id))
+			w.Header().Set("Range", uploadRange(size))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "chunk is out of order")
+			return nil
+		}
+		if size, err = server.Storage.AppendUpload(id, r.Body); err != nil {
+			return err
+		}
+		return uploadAccepted(w, name, id, size)
+	}
+}
+
+func (server *Server) finishUpload(id string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		d, err := parseDigest(r.URL.Query().Get("digest"))
+		if err != nil {
+			return err
+		}
+		// The last chunk may be sent with the request finishing the upload
+		if _, err := server.Storage.AppendUpload(id, r.Body); err != nil {
+			return err
+		}
+		if err := server.Storage.FinishUpload(name, id, d); err != nil {
+			if errors.Is(err, ErrDigestInvalid) {
+				_ = server.Storage.CancelUpload(id)
+			}
+			return err
+		}
+		return blobCreated(w, name, d)
+	}
+}
+
+func (server *Server) cancelUpload(id string) handler {
+	return func(w http.ResponseWriter, r *http.Request, name string) error {
+		if err := server.Storage.CancelUpload(id); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func blobCreated(w http.ResponseWriter, name string, d digest.Digest) error {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, d))
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func uploadAccepted(w http.ResponseWriter, name, id string, size int64) error {
+	w.Header().Set("Location", uploadLocation(name, id))
+	w.Header().Set("Range", uploadRange(size))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func uploadLocation(name, id string) string {
+	return fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, id)
+}
+
+// uploadRange returns the inclusive range of the uploaded bytes, distribution reports 0-0 for empty uploads
+func uploadRange(size int64) string {
+	if size == 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("0-%d", size-1)
+}
+
+// contentRangeStart returns the offset of the chunk from the `<start>-<end>` Content-Range header
+func contentRangeStart(contentRange string) (int64, bool) {
+	start, _, ok := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "-")
+	if !ok {
+		return 0, false
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	return offset, err == nil
+}
+
+// writePage writes the page of a list with the link to the next page
+func writePage(w http.ResponseWriter, next string, body map[string]any) error {
+	w.Header().Set("Content-Type", "application/json")
+	if next != "" {
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
+// paginate returns items after `last` limited to `n` and the URL of the next page if there are more items
+func paginate(r *http.Request, items []string) ([]string, string) {
+	query := r.URL.Query()
+	if last := query.Get("last"); last != "" {
+		items = items[sort.SearchStrings(items, last):]
+		if len(items) != 0 && items[0] == last {
+			items = items[1:]
+		}
+	}
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || n <= 0 || n >= len(items) {
+		return append([]string{}, items...), ""
+	}
+	page := items[:n]
+	next := url.Values{"n": {strconv.Itoa(n)}, "last": {page[n-1]}}
+	return page, r.URL.Path + "?" + next.Encode()
+}
+
+func validateReference(reference string) error {
+	if tagName.MatchString(reference) {
+		return nil
+	}
+	if _, err := parseDigest(reference); err != nil {
+		return fmt.Errorf("%w: invalid tag or digest %q", ErrManifestUnknown, reference)
+	}
+	return nil
+}
+
+func parseDigest(reference string) (digest.Digest, error) {
+	d, err := digest.Parse(reference)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDigestInvalid, err)
+	}
+	return d, nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
@@ -0,0 +1,273 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *Storage) {
+	storage, err := NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	server := httptest.NewServer(&Server{Storage: storage})
+	t.Cleanup(server.Close)
+	return server, storage
+}
+
+func request(t *testing.T, method, url string, body []byte, header http.Header) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("❌ failed to create request: %v", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("❌ %s %s failed: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("❌ %s %s: expected status %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, body)
+	}
+}
+
+// pushBlob uploads the blob in two chunks
+func pushBlob(t *testing.T, baseURL, name string, content []byte) ocispec.Descriptor {
+	t.Helper()
+	resp := request(t, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/", baseURL, name), nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	location := baseURL + resp.Header.Get("Location")
+
+	half := len(content) / 2
+	resp = request(t, http.MethodPatch, location, content[:half], http.Header{"Content-Range": {fmt.Sprintf("0-%d", half-1)}})
+	expectStatus(t, resp, http.StatusAccepted)
+	d := digest.FromBytes(content)
+	resp = request(t, http.MethodPut, fmt.Sprintf("%s?digest=%s", baseURL+resp.Header.Get("Location"), d), content[half:], nil)
+	expectStatus(t, resp, http.StatusCreated)
+	return ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: d, Size: int64(len(content))}
+}
+
+// pushImage pushes an image with a single layer and returns the manifest
+func pushImage(t *testing.T, baseURL, name, tag, layer string) []byte {
+	t.Helper()
+	config := pushBlob(t, baseURL, name, []byte(`{"architecture":"amd64","os":"linux"}`))
+	config.MediaType = ocispec.MediaTypeImageConfig
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{pushBlob(t, baseURL, name, []byte(layer))},
+	})
+	resp := request(t, http.MethodPut, fmt.Sprintf("%s/v2/%s/manifests/%s", baseURL, name, tag), manifest,
+		http.Header{"Content-Type": {ocispec.MediaTypeImageManifest}})
+	expectStatus(t, resp, http.StatusCreated)
+	return manifest
+}
+
+func TestPushAndPull(t *testing.T) {
+	server, _ := newTestServer(t)
+	manifest := pushImage(t, server.URL, "team/app", "v1", "layer content")
+	d := digest.FromBytes(manifest)
+
+	for _, reference := range []string{"v1", d.String()} {
+		resp := request(t, http.MethodGet, fmt.Sprintf("%s/v2/team/app/manifests/%s", server.URL, reference), nil, nil)
+		expectStatus(t, resp, http.StatusOK)
+		content, _ := io.ReadAll(resp.Body)
+		if !bytes.Equal(content, manifest) {
+			t.Errorf("❌ expected manifest %s, got %s", manifest, content)
+		}
+		if resp.Header.Get("Content-Type") != ocispec.MediaTypeImageManifest || resp.Header.Get("Docker-Content-Digest") != d.String() {
+			t.Errorf("❌ unexpected manifest headers %v", resp.Header)
+		}
+	}
+
+	layer := digest.FromString("layer content")
+	resp := request(t, http.MethodGet, fmt.Sprintf("%s/v2/team/app/blobs/%s", server.URL, layer), nil, http.Header{"Range": {"bytes=6-"}})
+	expectStatus(t, resp, http.StatusPartialContent)
+	if content, _ := io.ReadAll(resp.Body); string(content) != "content" {
+		t.Errorf("❌ expected range of the layer, got %q", content)
+	}
+	resp = request(t, http.MethodHead, fmt.Sprintf("%s/v2/other/blobs/%s", server.URL, layer), nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestMonolithicUploadAndMount(t *testing.T) {
+	server, _ := newTestServer(t)
+	content := []byte("monolithic")
+	d := digest.FromBytes(content)
+
+	resp := request(t, http.MethodPost, fmt.Sprintf("%s/v2/app/blobs/uploads/?digest=%s", server.URL, digest.FromString("other")), content, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = request(t, http.MethodPost, fmt.Sprintf("%s/v2/app/blobs/uploads/?digest=%s", server.URL, d), content, nil)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = request(t, http.MethodPost, fmt.Sprintf("%s/v2/copy/blobs/uploads/?mount=%s&from=app", server.URL, d), nil, nil)
+	expectStatus(t, resp, http.StatusCreated)
+	resp = request(t, http.MethodHead, fmt.Sprintf("%s/v2/copy/blobs/%s", server.URL, d), nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.ContentLength != int64(len(content)) {
+		t.Errorf("❌ expected blob size %d, got %d", len(content), resp.ContentLength)
+	}
+
+	// Blob that isn't in the source repository starts an upload instead
+	resp = request(t, http.MethodPost, fmt.Sprintf("%s/v2/copy/blobs/uploads/?mount=%s&from=missing", server.URL, d), nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+}
+
+func TestManifestValidation(t *testing.T) {
+	server, _ := newTestServer(t)
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{Digest: digest.FromString("missing")},
+	})
+	resp := request(t, http.MethodPut, server.URL+"/v2/app/manifests/v1", manifest, nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	var body struct {
+		Errors []struct{ Code string } `json:"errors"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Errors) != 1 || body.Errors[0].Code != "MANIFEST_BLOB_UNKNOWN" {
+		t.Errorf("❌ expected MANIFEST_BLOB_UNKNOWN error, got %+v", body)
+	}
+
+	resp = request(t, http.MethodGet, server.URL+"/v2/../../etc/manifests/v1", nil, nil)
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("❌ expected repository name escaping the storage to be rejected")
+	}
+	resp = request(t, http.MethodGet, server.URL+"/v2/app/manifests/..", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestTagsCatalogAndDelete(t *testing.T) {
+	server, _ := newTestServer(t)
+	pushImage(t, server.URL, "app", "v1", "one")
+	pushImage(t, server.URL, "app", "v2", "two")
+	manifest := pushImage(t, server.URL, "app", "latest", "two")
+	pushImage(t, server.URL, "team/tool", "v1", "tool")
+
+	resp := request(t, http.MethodGet, server.URL+"/v2/_catalog?n=1", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	var catalog struct{ Repositories []string }
+	_ = json.NewDecoder(resp.Body).Decode(&catalog)
+	if !reflect.DeepEqual(catalog.Repositories, []string{"app"}) || resp.Header.Get("Link") != `</v2/_catalog?last=app&n=1>; rel="next"` {
+		t.Errorf("❌ unexpected first catalog page %v, link %q", catalog.Repositories, resp.Header.Get("Link"))
+	}
+	resp = request(t, http.MethodGet, server.URL+"/v2/_catalog?n=1&last=app", nil, nil)
+	_ = json.NewDecoder(resp.Body).Decode(&catalog)
+	if !reflect.DeepEqual(catalog.Repositories, []string{"team/tool"}) || resp.Header.Get("Link") != "" {
+		t.Errorf("❌ unexpected last catalog page %v, link %q", catalog.Repositories, resp.Header.Get("Link"))
+	}
+
+	resp = request(t, http.MethodDelete, fmt.Sprintf("%s/v2/app/manifests/%s", server.URL, digest.FromBytes(manifest)), nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	resp = request(t, http.MethodGet, server.URL+"/v2/app/tags/list", nil, nil)
+	var tags struct{ Tags []string }
+	_ = json.NewDecoder(resp.Body).Decode(&tags)
+	if !reflect.DeepEqual(tags.Tags, []string{"v1"}) {
+		t.Errorf("❌ expected tags of the deleted image to be removed, got %v", tags.Tags)
+	}
+	resp = request(t, http.MethodGet, server.URL+"/v2/missing/tags/list", nil, nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestGarbageCollect(t *testing.T) {
+	server, storage := newTestServer(t)
+	pushImage(t, server.URL, "app", "v1", "kept")
+	old := pushImage(t, server.URL, "app", "v2", "deleted")
+	untagged := pushImage(t, server.URL, "app", "v2", "untagged")
+	resp := request(t, http.MethodDelete, fmt.Sprintf("%s/v2/app/manifests/%s", server.URL, digest.FromBytes(old)), nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	resp = request(t, http.MethodDelete, server.URL+"/v2/app/manifests/v2", nil, nil)
+	expectStatus(t, resp, http.StatusAccepted)
+
+	removed, _, err := storage.GarbageCollect(false)
+	if err != nil {
+		t.Fatalf("❌ garbage collection failed: %v", err)
+	}
+	// Manifest and layer of the deleted image
+	if removed != 2 {
+		t.Errorf("❌ expected 2 blobs to be removed, got %d", removed)
+	}
+	resp = request(t, http.MethodGet, fmt.Sprintf("%s/v2/app/manifests/%s", server.URL, digest.FromBytes(untagged)), nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if removed, _, err = storage.GarbageCollect(true); err != nil || removed != 2 {
+		t.Errorf("❌ expected manifest and layer of the untagged image to be removed, got %d: %v", removed, err)
+	}
+	resp = request(t, http.MethodGet, server.URL+"/v2/app/manifests/v1", nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+	resp = request(t, http.MethodGet, fmt.Sprintf("%s/v2/app/blobs/%s", server.URL, digest.FromString("kept")), nil, nil)
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestHtpasswdAuthentication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd := func(username, password string) {
+		hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("%s:%s\n", username, hash)), 0600); err != nil {
+			t.Fatalf("❌ failed to write htpasswd: %v", err)
+		}
+	}
+	writeHtpasswd("admin", "secret")
+	htpasswd, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatalf("❌ failed to load htpasswd: %v", err)
+	}
+	storage, _ := NewStorage(t.TempDir())
+	server := httptest.NewServer(&Server{Storage: storage, Authenticate: htpasswd.Authenticate})
+	defer server.Close()
+
+	resp := request(t, http.MethodGet, server.URL+"/v2/", nil, nil)
+	expectStatus(t, resp, http.StatusUnauthorized)
+	if !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("❌ expected basic auth challenge, got %q", resp.Header.Get("WWW-Authenticate"))
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v2/", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp, _ = http.DefaultClient.Do(req)
+	expectStatus(t, resp, http.StatusOK)
+	resp.Body.Close()
+
+	// Rotated credentials are picked up without a restart
+	writeHtpasswd("rotated", "new-secret")
+	if htpasswd.Authenticate("admin", "secret") || !htpasswd.Authenticate("rotated", "new-secret") {
+		t.Errorf("❌ expected rotated credentials to replace the old ones")
+	}
+
+	// Failed attempts aren't cached, so guessing passwords doesn't grow the memory of the registry
+	for i := 0; i < 10; i++ {
+		htpasswd.Authenticate("rotated", fmt.Sprintf("guess-%d", i))
+	}
+	if len(htpasswd.verified) != 1 {
+		t.Errorf("❌ expected only the successful check to be cached, got %d entries", len(htpasswd.verified))
+	}
+
+	// Files replaced atomically are reloaded as well
+	hash, _ := bcrypt.GenerateFromPassword([]byte("atomic-secret"), bcrypt.MinCost)
+	if err := WriteFile(path, []byte(fmt.Sprintf("atomic:%s\n", hash)), 0600); err != nil {
+		t.Fatalf("❌ failed to replace htpasswd: %v", err)
+	}
+	if htpasswd.Authenticate("rotated", "new-secret") || !htpasswd.Authenticate("atomic", "atomic-secret") {
+		t.Errorf("❌ expected replaced htpasswd file to be reloaded")
+	}
+}
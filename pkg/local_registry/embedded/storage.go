@@ -0,0 +1,574 @@
+package embedded
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Errors returned by the storage, the server reports them with the matching Registry HTTP API error codes
+var (
+	ErrBlobUnknown         = errors.New("blob unknown to registry")
+	ErrManifestUnknown     = errors.New("manifest unknown")
+	ErrManifestInvalid     = errors.New("manifest invalid")
+	ErrManifestBlobUnknown = errors.New("manifest references a manifest or blob unknown to registry")
+	ErrNameUnknown         = errors.New("repository name not known to registry")
+	ErrUploadUnknown       = errors.New("blob upload unknown to registry")
+	ErrDigestInvalid       = errors.New("provided digest did not match uploaded content")
+)
+
+// Storage keeps images in a directory laid out like the filesystem driver of distribution:
+//
+//	blobs/sha256/<hex>                                  content of blobs and manifests
+//	uploads/<id>                                        blobs being uploaded
+//	repositories/<name>/_layers/sha256/<hex>            blobs pushed to the repository
+//	repositories/<name>/_manifests/revisions/sha256/<hex> manifests of the repository, the file holds the media type
+//	repositories/<name>/_manifests/tags/<tag>           the file holds the digest of the tagged manifest
+type Storage struct {
+	root string
+	mu   sync.RWMutex // Guards manifests and tags, blobs are immutable once uploaded
+}
+
+// NewStorage returns the storage in the directory, the directory is created if it doesn't exist
+func NewStorage(root string) (*Storage, error) {
+	for _, dir := range []string{"blobs", "uploads", "repositories"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("❌ failed to create registry storage directory: %w", err)
+		}
+	}
+	return &Storage{root: root}, nil
+}
+
+func (storage *Storage) blobPath(d digest.Digest) string {
+	return filepath.Join(storage.root, "blobs", d.Algorithm().String(), d.Encoded())
+}
+
+func (storage *Storage) uploadPath(id string) string {
+	return filepath.Join(storage.root, "uploads", id)
+}
+
+func (storage *Storage) repositoryPath(name string, elem ...string) string {
+	return filepath.Join(append([]string{storage.root, "repositories", filepath.FromSlash(name)}, elem...)...)
+}
+
+func (storage *Storage) layerLinkPath(name string, d digest.Digest) string {
+	return storage.repositoryPath(name, "_layers", d.Algorithm().String(), d.Encoded())
+}
+
+func (storage *Storage) revisionPath(name string, d digest.Digest) string {
+	return storage.repositoryPath(name, "_manifests", "revisions", d.Algorithm().String(), d.Encoded())
+}
+
+func (storage *Storage) tagPath(name, tag string) string {
+	return storage.repositoryPath(name, "_manifests", "tags", tag)
+}
+
+// StatBlob returns the size of the blob pushed to the repository
+func (storage *Storage) StatBlob(name string, d digest.Digest) (int64, error) {
+	if _, err := os.Stat(storage.layerLinkPath(name, d)); err != nil {
+		return 0, notExist(err, ErrBlobUnknown)
+	}
+	info, err := os.Stat(storage.blobPath(d))
+	if err != nil {
+		return 0, notExist(err, ErrBlobUnknown)
+	}
+	return info.Size(), nil
+}
+
+// OpenBlob opens the blob pushed to the repository
+func (storage *Storage) OpenBlob(name string, d digest.Digest) (*os.File, error) {
+	if _, err := storage.StatBlob(name, d); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(storage.blobPath(d))
+	if err != nil {
+		return nil, notExist(err, ErrBlobUnknown)
+	}
+	return file, nil
+}
+
+// DeleteBlob removes the blob from the repository, the content is removed by the garbage collection
+func (storage *Storage) DeleteBlob(name string, d digest.Digest) error {
+	return notExist(os.Remove(storage.layerLinkPath(name, d)), ErrBlobUnknown)
+}
+
+// MountBlob adds the blob pushed to another repository to the repository without uploading it again
+func (storage *Storage) MountBlob(from, name string, d digest.Digest) error {
+	if _, err := storage.StatBlob(from, d); err != nil {
+		return err
+	}
+	return writeFile(storage.layerLinkPath(name, d), nil)
+}
+
+// StartUpload creates an empty upload and returns its ID
+func (storage *Storage) StartUpload() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	file, err := os.OpenFile(storage.uploadPath(hex.EncodeToString(id)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload: %w", err)
+	}
+	return hex.EncodeToString(id), file.Close()
+}
+
+// UploadSize returns the number of bytes uploaded so far
+func (storage *Storage) UploadSize(id string) (int64, error) {
+	info, err := os.Stat(storage.uploadPath(id))
+	if err != nil {
+		return 0, notExist(err, ErrUploadUnknown)
+	}
+	return info.Size(), nil
+}
+
+// AppendUpload appends the chunk to the upload and returns the size of the upload
+func (storage *Storage) AppendUpload(id string, chunk io.Reader) (int64, error) {
+	file, err := os.OpenFile(storage.uploadPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, notExist(err, ErrUploadUnknown)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, chunk); err != nil {
+		return 0, fmt.Errorf("failed to write upload: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat upload: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// FinishUpload verifies the digest of the upload and moves it to the blobs of the repository
+func (storage *Storage) FinishUpload(name, id string, expected digest.Digest) error {
+	if expected.Algorithm() != digest.SHA256 {
+		return fmt.Errorf("%w: only sha256 digests are supported", ErrDigestInvalid)
+	}
+	file, err := os.Open(storage.uploadPath(id))
+	if err != nil {
+		return notExist(err, ErrUploadUnknown)
+	}
+	actual, err := digest.SHA256.FromReader(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	if actual != expected {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestInvalid, expected, actual)
+	}
+	if err := os.MkdirAll(filepath.Dir(storage.blobPath(actual)), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(storage.uploadPath(id), storage.blobPath(actual)); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return writeFile(storage.layerLinkPath(name, actual), nil)
+}
+
+// CancelUpload removes the upload
+func (storage *Storage) CancelUpload(id string) error {
+	return notExist(os.Remove(storage.uploadPath(id)), ErrUploadUnknown)
+}
+
+// manifestReferences are the fields of image manifests and indexes pointing to other content
+type manifestReferences struct {
+	MediaType string               `json:"mediaType"`
+	Config    *ocispec.Descriptor  `json:"config"`
+	Layers    []ocispec.Descriptor `json:"layers"`
+	Manifests []ocispec.Descriptor `json:"manifests"`
+}
+
+// PutManifest stores the manifest under the tag or the digest and returns its digest. Blobs and manifests
+// it references must be pushed to the repository first. The media type is taken from the manifest if it is empty
+func (storage *Storage) PutManifest(name, reference, mediaType string, content []byte) (digest.Digest, error) {
+	var references manifestReferences
+	if err := json.Unmarshal(content, &references); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+	d := digest.FromBytes(content)
+	if referenceDigest, err := digest.Parse(reference); err == nil && referenceDigest != d {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrDigestInvalid, referenceDigest, d)
+	}
+	if mediaType == "" {
+		mediaType = references.MediaType
+	}
+	if mediaType == "" {
+		mediaType = ocispec.MediaTypeImageManifest
+		if references.Manifests != nil {
+			mediaType = ocispec.MediaTypeImageIndex
+		}
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	blobs := references.Layers
+	if references.Config != nil {
+		blobs = append(blobs, *references.Config)
+	}
+	for _, blob := range blobs {
+		if len(blob.URLs) != 0 {
+			continue // Foreign layers are pulled from their URLs
+		}
+		if _, err := storage.StatBlob(name, blob.Digest); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrManifestBlobUnknown, blob.Digest)
+		}
+	}
+	for _, manifest := range references.Manifests {
+		if _, err := os.Stat(storage.revisionPath(name, manifest.Digest)); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrManifestBlobUnknown, manifest.Digest)
+		}
+	}
+
+	if err := writeFile(storage.blobPath(d), content); err != nil {
+		return "", err
+	}
+	if err := writeFile(storage.revisionPath(name, d), []byte(mediaType)); err != nil {
+		return "", err
+	}
+	if _, err := digest.Parse(reference); err != nil {
+		if err := writeFile(storage.tagPath(name, reference), []byte(d)); err != nil {
+			return "", err
+		}
+	}
+	return d, nil
+}
+
+// GetManifest returns the content, the media type and the digest of the manifest the tag or the digest points to
+func (storage *Storage) GetManifest(name, reference string) ([]byte, string, digest.Digest, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	d, err := storage.resolve(name, reference)
+	if err != nil {
+		return nil, "", "", err
+	}
+	mediaType, err := os.ReadFile(storage.revisionPath(name, d))
+	if err != nil {
+		return nil, "", "", notExist(err, ErrManifestUnknown)
+	}
+	content, err := os.ReadFile(storage.blobPath(d))
+	if err != nil {
+		return nil, "", "", notExist(err, ErrManifestUnknown)
+	}
+	return content, string(mediaType), d, nil
+}
+
+// DeleteManifest deletes the tag, or the manifest with all tags pointing to it if the reference is a digest
+func (storage *Storage) DeleteManifest(name, reference string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	d, err := digest.Parse(reference)
+	if err != nil {
+		return notExist(os.Remove(storage.tagPath(name, reference)), ErrManifestUnknown)
+	}
+	if err := os.Remove(storage.revisionPath(name, d)); err != nil {
+		return notExist(err, ErrManifestUnknown)
+	}
+	tags, err := storage.tags(name)
+	if err != nil {
+		return err
+	}
+	for tag, tagged := range tags {
+		if tagged == d {
+			if err := os.Remove(storage.tagPath(name, tag)); err != nil {
+				return fmt.Errorf("failed to delete tag %s: %w", tag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Tags returns the sorted tags of the repository
+func (storage *Storage) Tags(name string) ([]string, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	if _, err := os.Stat(storage.repositoryPath(name, "_manifests")); err != nil {
+		return nil, notExist(err, ErrNameUnknown)
+	}
+	tags, err := storage.tags(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Repositories returns the sorted names of repositories with manifests pushed to them
+func (storage *Storage) Repositories() ([]string, error) {
+	root := filepath.Join(storage.root, "repositories")
+	var repositories []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		switch entry.Name() {
+		case "_manifests":
+			name, err := filepath.Rel(root, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			repositories = append(repositories, filepath.ToSlash(name))
+			return filepath.SkipDir
+		case "_layers":
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// GarbageCollect removes blobs that are not referenced by any manifest, and manifests that are neither tagged
+// nor part of a tagged index if deleteUntagged is set. It must not run while the registry serves requests.
+// The number of removed blobs and the freed space are returned
+func (storage *Storage) GarbageCollect(deleteUntagged bool) (int, int64, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	repositories, err := storage.Repositories()
+	if err != nil {
+		return 0, 0, err
+	}
+	marked := map[digest.Digest]bool{}
+	for _, name := range repositories {
+		if err := storage.markRepository(name, deleteUntagged, marked); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var removed int
+	var freed int64
+	blobs := filepath.Join(storage.root, "blobs")
+	err = filepath.WalkDir(blobs, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(blobs, path)
+		if err != nil {
+			return err
+		}
+		if marked[digest.Digest(strings.Replace(filepath.ToSlash(rel), "/", ":", 1))] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return removed, freed, fmt.Errorf("failed to remove blobs: %w", err)
+	}
+	// Uploads can't be resumed once the registry is stopped
+	if err := os.RemoveAll(filepath.Join(storage.root, "uploads")); err != nil {
+		return removed, freed, fmt.Errorf("failed to remove uploads: %w", err)
+	}
+	return removed, freed, os.MkdirAll(filepath.Join(storage.root, "uploads"), 0755)
+}
+
+// markRepository marks manifests of the repository and blobs they reference, links to unmarked blobs are removed
+func (storage *Storage) markRepository(name string, deleteUntagged bool, marked map[digest.Digest]bool) error {
+	revisions, err := listDigests(storage.repositoryPath(name, "_manifests", "revisions"))
+	if err != nil {
+		return err
+	}
+	if deleteUntagged {
+		if revisions, err = storage.removeUntagged(name, revisions); err != nil {
+			return err
+		}
+	}
+	referenced := map[digest.Digest]bool{}
+	for _, revision := range revisions {
+		marked[revision] = true
+		references, err := storage.readReferences(revision)
+		if err != nil {
+			return err
+		}
+		if references.Config != nil {
+			referenced[references.Config.Digest] = true
+		}
+		for _, layer := range references.Layers {
+			referenced[layer.Digest] = true
+		}
+	}
+	layers, err := listDigests(storage.repositoryPath(name, "_layers"))
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if referenced[layer] {
+			marked[layer] = true
+			continue
+		}
+		if err := os.Remove(storage.layerLinkPath(name, layer)); err != nil {
+			return fmt.Errorf("failed to unlink blob %s from %s: %w", layer, name, err)
+		}
+	}
+	return nil
+}
+
+// removeUntagged removes the manifests not reachable from tags and returns the remaining ones
+func (storage *Storage) removeUntagged(name string, revisions []digest.Digest) ([]digest.Digest, error) {
+	tags, err := storage.tags(name)
+	if err != nil {
+		return nil, err
+	}
+	reachable := map[digest.Digest]bool{}
+	var queue []digest.Digest
+	for _, d := range tags {
+		queue = append(queue, d)
+	}
+	for len(queue) != 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if reachable[d] {
+			continue
+		}
+		reachable[d] = true
+		references, err := storage.readReferences(d)
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range references.Manifests {
+			queue = append(queue, manifest.Digest)
+		}
+	}
+	var kept []digest.Digest
+	for _, revision := range revisions {
+		if reachable[revision] {
+			kept = append(kept, revision)
+			continue
+		}
+		if err := os.Remove(storage.revisionPath(name, revision)); err != nil {
+			return nil, fmt.Errorf("failed to delete manifest %s from %s: %w", revision, name, err)
+		}
+	}
+	return kept, nil
+}
+
+func (storage *Storage) readReferences(d digest.Digest) (manifestReferences, error) {
+	var references manifestReferences
+	content, err := os.ReadFile(storage.blobPath(d))
+	if err != nil {
+		return references, fmt.Errorf("failed to read manifest %s: %w", d, err)
+	}
+	// Content of manifests is validated when they are pushed
+	_ = json.Unmarshal(content, &references)
+	return references, nil
+}
+
+// resolve returns the digest the tag points to, digests are returned as is
+func (storage *Storage) resolve(name, reference string) (digest.Digest, error) {
+	if d, err := digest.Parse(reference); err == nil {
+		return d, nil
+	}
+	content, err := os.ReadFile(storage.tagPath(name, reference))
+	if err != nil {
+		return "", notExist(err, ErrManifestUnknown)
+	}
+	return digest.Parse(string(content))
+}
+
+// tags returns digests of the manifests by tag
+func (storage *Storage) tags(name string) (map[string]digest.Digest, error) {
+	entries, err := os.ReadDir(storage.repositoryPath(name, "_manifests", "tags"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", name, err)
+	}
+	tags := make(map[string]digest.Digest, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue // File being written
+		}
+		d, err := storage.resolve(name, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		tags[entry.Name()] = d
+	}
+	return tags, nil
+}
+
+// listDigests returns digests stored as <algorithm>/<hex> files in the directory
+func listDigests(dir string) ([]digest.Digest, error) {
+	var digests []digest.Digest
+	algorithms, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	for _, algorithm := range algorithms {
+		entries, err := os.ReadDir(filepath.Join(dir, algorithm.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue // File being written
+			}
+			digests = append(digests, digest.NewDigestFromEncoded(digest.Algorithm(algorithm.Name()), entry.Name()))
+		}
+	}
+	return digests, nil
+}
+
+// writeFile atomically replaces the file, so concurrent readers never see partial content
+func writeFile(path string, content []byte) error {
+	return WriteFile(path, content, 0644)
+}
+
+// WriteFile atomically replaces the file with the content and the permissions, files like htpasswd
+// read by a running registry are never seen truncated
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// notExist replaces missing file errors with the sentinel error
+func notExist(err, sentinel error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return sentinel
+	}
+	return err
+}
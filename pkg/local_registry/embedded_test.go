@@ -0,0 +1,116 @@
+package local_registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// pushToEmbedded pushes an image with a single layer to the embedded registry with monolithic uploads
+func pushToEmbedded(t *testing.T, client *Client, repository, tag string, created time.Time) {
+	ctx := context.Background()
+	upload := func(content []byte) ocispec.Descriptor {
+		d := digest.FromBytes(content)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("%s/v2/%s/blobs/uploads/?digest=%s", client.BaseURL, repository, d), bytes.NewReader(content))
+		resp, err := client.Do(req, "")
+		if err != nil || resp.StatusCode != http.StatusCreated {
+			t.Fatalf("❌ failed to upload blob: %v %v", resp, err)
+		}
+		resp.Body.Close()
+		return ocispec.Descriptor{Digest: d, Size: int64(len(content))}
+	}
+	config, _ := json.Marshal(ocispec.Image{Created: &created, Platform: ocispec.Platform{OS: "linux", Architecture: "amd64"}})
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    upload(config),
+		Layers:    []ocispec.Descriptor{upload([]byte(repository + tag))},
+	})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", client.BaseURL, repository, tag), bytes.NewReader(manifest))
+	req.Header.Set("Content-Type", ocispec.MediaTypeImageManifest)
+	resp, err := client.Do(req, "")
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("❌ failed to push manifest: %v %v", resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestEmbeddedRegistry(t *testing.T) {
+	storage, err := embedded.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	server := httptest.NewServer(&embedded.Server{
+		Storage:      storage,
+		Authenticate: func(username, password string) bool { return username == "admin" && password == "secret" },
+	})
+	defer server.Close()
+	ctx := context.Background()
+	client := NewClient(server.URL, "admin", "secret")
+
+	now := time.Now()
+	pushToEmbedded(t, client, "app", "v1", now.Add(-48*time.Hour))
+	pushToEmbedded(t, client, "app", "v2", now)
+	pushToEmbedded(t, client, "team/tool", "latest", now)
+
+	repositories, err := client.Catalog(ctx)
+	if err != nil || !reflect.DeepEqual(repositories, []string{"app", "team/tool"}) {
+		t.Fatalf("❌ unexpected catalog %v: %v", repositories, err)
+	}
+	details, err := InspectImage(ctx, client, "app:v2")
+	if err != nil {
+		t.Fatalf("❌ failed to inspect image: %v", err)
+	}
+	if details.Config.OS != "linux" || len(details.Layers) != 1 {
+		t.Errorf("❌ unexpected image details %+v", details)
+	}
+
+	config := &parser.Config{}
+	config.Image.Name, config.Image.Tag = "team/tool", "latest"
+	config.Registry.Retention.KeepLast = 1
+	deleted, err := ApplyRetention(ctx, client, config, nil)
+	if err != nil || !reflect.DeepEqual(deleted, []string{"app:v1"}) {
+		t.Errorf("❌ expected app:v1 to be deleted by retention, got %v: %v", deleted, err)
+	}
+	if tags, err := client.Tags(ctx, "app"); err != nil || !reflect.DeepEqual(tags, []string{"v2"}) {
+		t.Errorf("❌ expected only app:v2 to be left, got %v: %v", tags, err)
+	}
+
+	if _, _, err := NewClient(server.URL, "admin", "wrong").GetManifest(ctx, "app", "v2"); err == nil {
+		t.Error("❌ request with wrong credentials is accepted")
+	}
+}
+
+func TestEmbeddedConfig(t *testing.T) {
+	config := &parser.Config{}
+	config.Registry.Backend = EmbeddedBackend
+	config.Registry.Port = 5000
+	if address, err := ContainerAddress(config); err != nil || address != "host.docker.internal:5000" {
+		t.Errorf("❌ expected tunnels to reach embedded registry on the host, got %s: %v", address, err)
+	}
+	if _, err := GetBackend(EmbeddedBackend); err == nil {
+		t.Error("❌ embedded backend is returned as a container backend")
+	}
+	if err := validatePush(config); err != nil {
+		t.Errorf("❌ push to embedded registry is rejected: %v", err)
+	}
+	if err := validateEmbedded(config); err != nil {
+		t.Errorf("❌ default config is rejected: %v", err)
+	}
+	config.Registry.Config.Proxy.RemoteURL = "https://registry-1.docker.io"
+	if err := validateEmbedded(config); err == nil {
+		t.Error("❌ pull-through cache is accepted by embedded backend")
+	}
+}
@@ -0,0 +1,378 @@
+package local_registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// gatewayDaemonName is the name of the background process serving the gateway
+	gatewayDaemonName = "registry-gateway"
+	// gatewayHost is the address tunnel containers use to reach the gateway running on the host
+	gatewayHost = "host.docker.internal"
+)
+
+// GatewayDaemonArgs are the locreg arguments that run the gateway daemon
+var GatewayDaemonArgs = []string{"registry", "gateway"}
+
+// bearerRealm matches the realm of the token server in the challenge returned by the registry
+var bearerRealm = regexp.MustCompile(`realm="[^"]*"`)
+
+// Gateway is served on the registry port in front of the registry container when token authentication
+// is enabled or additional users are configured.
+//
+// With token authentication it issues registry tokens on /token and proxies everything else to the registry,
+// rewriting the realm in authentication challenges to the origin the client used, so the same token server
+// is reachable both locally and through the tunnel. Otherwise it checks basic auth of every request itself,
+// rejects writes of read-only users and forwards requests to the registry with the registry credentials
+type Gateway struct {
+	Upstream *url.URL
+	Issuer   *TokenIssuer // Token authentication is disabled if nil
+	TokenTTL time.Duration
+	// Registry returns the registry credentials and users, it is called on every request to pick up changes
+	Registry func() (*parser.LocalRegistry, error)
+
+	verified sync.Map // Credentials of users that matched the bcrypt hash, so it isn't computed on every request
+}
+
+// Handler returns the HTTP handler of the gateway
+func (gateway *Gateway) Handler() http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(gateway.Upstream)
+	if gateway.Issuer == nil {
+		return gateway.authenticateRequests(proxy)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if challenge := resp.Header.Get("WWW-Authenticate"); strings.HasPrefix(challenge, "Bearer ") {
+			realm := fmt.Sprintf(`realm="%s/token"`, requestOrigin(resp.Request))
+			resp.Header.Set("WWW-Authenticate", bearerRealm.ReplaceAllLiteralString(challenge, realm))
+		}
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", gateway.serveToken)
+	mux.Handle("/", proxy)
+	return mux
+}
+
+// serveToken implements the token endpoint of distribution token authentication,
+// see https://distribution.github.io/distribution/spec/auth/token/
+func (gateway *Gateway) serveToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="locreg"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	grant, err := gateway.authorize(username, password)
+	if err != nil {
+		log.Printf("❌ token request from %s is rejected: %v", r.RemoteAddr, err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="locreg"`)
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var access []Access
+	for _, scopes := range r.URL.Query()["scope"] {
+		for _, scope := range strings.Fields(scopes) {
+			requested, err := ParseScope(scope)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if granted := grant(requested); len(granted.Actions) != 0 {
+				access = append(access, granted)
+			}
+		}
+	}
+
+	token, err := gateway.Issuer.Issue(username, access, gateway.TokenTTL)
+	if err != nil {
+		log.Printf("❌ failed to issue token: %v", err)
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"token":        token,
+		"access_token": token,
+		"expires_in":   int(gateway.TokenTTL.Seconds()),
+		"issued_at":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// authorize checks the credentials and returns a function that filters requested access down to the granted one.
+// Registry credentials and users are granted everything, read-only users can only pull
+// and pull credentials can only pull their repositories
+func (gateway *Gateway) authorize(username, password string) (func(Access) Access, error) {
+	readOnly, _, err := gateway.authenticate(username, password)
+	if err == nil {
+		if readOnly {
+			return pullOnly(nil), nil
+		}
+		return func(requested Access) Access { return requested }, nil
+	}
+	if username != PullUsername {
+		return nil, err
+	}
+	localRegistry, err := gateway.Registry()
+	if err != nil {
+		return nil, err
+	}
+	repositories, err := gateway.Issuer.VerifyPullCredential(password, localRegistry.PullGeneration)
+	if err != nil {
+		return nil, err
+	}
+	return pullOnly(repositories), nil
+}
+
+// authenticate checks the registry credentials and users, it returns whether the account is read-only
+// and the registry record with the registry credentials
+func (gateway *Gateway) authenticate(username, password string) (bool, *parser.LocalRegistry, error) {
+	localRegistry, err := gateway.Registry()
+	if err != nil {
+		return false, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(username), []byte(localRegistry.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(localRegistry.Password)) == 1 {
+		return false, localRegistry, nil
+	}
+	for _, user := range localRegistry.Users {
+		if user.Username != username {
+			continue
+		}
+		// Hash is part of the key, so cached credentials are invalidated when the user is recreated
+		key := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + user.PasswordHash))
+		if _, ok := gateway.verified.Load(key); !ok {
+			if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+				return false, nil, fmt.Errorf("❌ invalid password of user %q", username)
+			}
+			gateway.verified.Store(key, struct{}{})
+		}
+		return user.ReadOnly, localRegistry, nil
+	}
+	return false, nil, fmt.Errorf("❌ unknown user %q", username)
+}
+
+// authenticateRequests checks basic auth of requests and forwards them with the registry credentials
+func (gateway *Gateway) authenticateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="locreg"`)
+			registryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+		readOnly, localRegistry, err := gateway.authenticate(username, password)
+		if err != nil {
+			log.Printf("❌ request from %s is rejected: %v", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Basic realm="locreg"`)
+			registryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+			return
+		}
+		if readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			registryError(w, http.StatusForbidden, "DENIED", fmt.Sprintf("user %s is read-only", username))
+			return
+		}
+		r.SetBasicAuth(localRegistry.Username, localRegistry.Password)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pullOnly returns a function that grants only pull on the repositories, on any repository if nil
+func pullOnly(repositories []string) func(Access) Access {
+	return func(requested Access) Access {
+		granted := Access{Type: requested.Type, Name: requested.Name}
+		if requested.Type != "repository" || (repositories != nil && !contains(repositories, requested.Name)) {
+			return granted
+		}
+		for _, action := range requested.Actions {
+			if action == "pull" {
+				granted.Actions = []string{"pull"}
+			}
+		}
+		return granted
+	}
+}
+
+// registryError writes an error in the format of the Registry HTTP API
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// RunGateway serves the gateway on the registry port and the mirror on its port until SIGTERM or SIGINT is received
+func RunGateway(config *parser.Config) error {
+	profile, profilePath := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil || profile.LocalRegistry.Upstream == "" {
+		return fmt.Errorf("❌ registry upstream is not found in profile")
+	}
+	gateway := &Gateway{
+		Upstream: &url.URL{Scheme: "http", Host: profile.LocalRegistry.Upstream},
+		Registry: (&profileRegistry{path: profilePath}).load,
+	}
+	if config.IsTokenAuthEnabled() {
+		issuer, err := LoadTokenIssuer(config)
+		if err != nil {
+			return err
+		}
+		ttl, err := time.ParseDuration(config.Registry.Auth.Token.Expiration)
+		if err != nil {
+			return fmt.Errorf("❌ invalid registry.auth.token.expiration: %w", err)
+		}
+		gateway.Issuer, gateway.TokenTTL = issuer, ttl
+	}
+
+	servers := []*http.Server{{
+		Addr:              fmt.Sprintf(":%d", config.Registry.Port),
+		Handler:           gateway.Handler(),
+		ReadHeaderTimeout: 30 * time.Second,
+	}}
+	if config.Registry.Mirror.Port != 0 {
+		// Mirror serves pulls without credentials, so it is never reachable through the tunnel
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf("127.0.0.1:%d", config.Registry.Mirror.Port),
+			Handler:           gateway.MirrorHandler(),
+			ReadHeaderTimeout: 30 * time.Second,
+		})
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Printf("✅ Registry gateway is listening on %s and forwarding to %s", server.Addr, gateway.Upstream.Host)
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("❌ registry gateway failed: %w", err)
+				return
+			}
+			errs <- nil
+		}(server)
+	}
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdownCtx)
+	}
+	return err
+}
+
+// startGateway runs the gateway daemon and records its PID in the profile
+func startGateway() error {
+	pid, err := daemon.Spawn(gatewayDaemonName, GatewayDaemonArgs...)
+	if err != nil {
+		return err
+	}
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		localRegistry.GatewayPID = pid
+		return nil
+	})
+	if err != nil {
+		_ = daemon.Stop(pid)
+		return err
+	}
+	return nil
+}
+
+// stopGateway stops the gateway daemon recorded in the profile
+func stopGateway(localRegistry *parser.LocalRegistry) error {
+	if localRegistry.GatewayPID == 0 {
+		return nil
+	}
+	if err := daemon.Stop(localRegistry.GatewayPID); err != nil {
+		return fmt.Errorf("❌ failed to stop registry gateway: %w", err)
+	}
+	return nil
+}
+
+// daemonLogHint returns where to look for the reason the daemon failed
+func daemonLogHint(name string) string {
+	logPath, err := daemon.LogPath(name)
+	if err != nil {
+		return name + " logs"
+	}
+	return logPath
+}
+
+// profileRegistry reads the registry credentials and users recorded in the profile. The record is cached
+// until the profile is saved again, which replaces the file, so it isn't parsed on every request
+type profileRegistry struct {
+	path string
+
+	mu       sync.Mutex
+	file     os.FileInfo
+	registry *parser.LocalRegistry
+}
+
+func (cache *profileRegistry) load() (*parser.LocalRegistry, error) {
+	file, err := os.Stat(cache.path)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to read profile: %w", err)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.registry != nil && os.SameFile(file, cache.file) &&
+		file.ModTime().Equal(cache.file.ModTime()) && file.Size() == cache.file.Size() {
+		return cache.registry, nil
+	}
+	profile, err := parser.LoadOrCreateProfile(cache.path)
+	if err != nil {
+		return nil, err
+	}
+	if profile.LocalRegistry == nil {
+		return nil, fmt.Errorf("❌ local registry is not found in profile")
+	}
+	cache.file, cache.registry = file, profile.LocalRegistry
+	return cache.registry, nil
+}
+
+// requestOrigin returns the scheme and host the client used to reach the gateway,
+// tunnels report the public ones in X-Forwarded headers
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme, _, _ = strings.Cut(proto, ",")
+	}
+	host := r.Host
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		host, _, _ = strings.Cut(forwardedHost, ",")
+	}
+	return fmt.Sprintf("%s://%s", strings.TrimSpace(scheme), strings.TrimSpace(host))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
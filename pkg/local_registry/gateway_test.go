@@ -0,0 +1,232 @@
+package local_registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestGateway(t *testing.T) (*Gateway, *httptest.Server) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://localhost:5000/token",service="locreg-registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamURL, _ := url.Parse(upstream.URL)
+	gateway := &Gateway{
+		Upstream: upstreamURL,
+		Issuer:   newTestIssuer(t),
+		TokenTTL: time.Minute,
+		Registry: testRegistry(t),
+	}
+	server := httptest.NewServer(gateway.Handler())
+	t.Cleanup(server.Close)
+	return gateway, server
+}
+
+// testRegistry returns registry record with `admin` credentials, `ci` user and read-only `reader` user
+func testRegistry(t *testing.T) func() (*parser.LocalRegistry, error) {
+	ci, err := newRegistryUser("ci", "ci-secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := newRegistryUser("reader", "reader-secret", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() (*parser.LocalRegistry, error) {
+		return &parser.LocalRegistry{Username: "admin", Password: "secret", Users: []parser.RegistryUser{ci, reader}}, nil
+	}
+}
+
+func requestToken(t *testing.T, server *httptest.Server, username, password, scope string) (int, []any) {
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/token?service=locreg-registry&scope="+url.QueryEscape(scope), nil)
+	req.SetBasicAuth(username, password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("❌ token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("❌ failed to decode token response: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body.Token, claims); err != nil {
+		t.Fatalf("❌ failed to parse token: %v", err)
+	}
+	access, _ := claims["access"].([]any)
+	return resp.StatusCode, access
+}
+
+func TestGatewayRewritesRealm(t *testing.T) {
+	_, server := newTestGateway(t)
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v2/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.ngrok.app")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("❌ request through gateway failed: %v", err)
+	}
+	resp.Body.Close()
+	expected := `Bearer realm="https://example.ngrok.app/token",service="locreg-registry"`
+	if challenge := resp.Header.Get("WWW-Authenticate"); challenge != expected {
+		t.Errorf("❌ expected challenge %s, got %s", expected, challenge)
+	}
+}
+
+func TestGatewayToken(t *testing.T) {
+	gateway, server := newTestGateway(t)
+
+	status, access := requestToken(t, server, "admin", "secret", "repository:app:pull,push")
+	if status != http.StatusOK || len(access) != 1 {
+		t.Fatalf("❌ registry credentials are not granted push, status %d, access %v", status, access)
+	}
+	if actions := access[0].(map[string]any)["actions"].([]any); len(actions) != 2 {
+		t.Errorf("❌ expected pull and push to be granted, got %v", actions)
+	}
+
+	if status, _ := requestToken(t, server, "admin", "wrong", "repository:app:pull"); status != http.StatusUnauthorized {
+		t.Errorf("❌ expected 401 for wrong password, got %d", status)
+	}
+
+	credential, err := gateway.Issuer.IssuePullCredential([]string{"app"}, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("❌ failed to issue pull credential: %v", err)
+	}
+	status, access = requestToken(t, server, PullUsername, credential, "repository:app:pull,push")
+	if status != http.StatusOK || len(access) != 1 {
+		t.Fatalf("❌ pull credential is not granted pull, status %d, access %v", status, access)
+	}
+	if actions := access[0].(map[string]any)["actions"].([]any); len(actions) != 1 || actions[0] != "pull" {
+		t.Errorf("❌ pull credential must be granted only pull, got %v", actions)
+	}
+	if _, access := requestToken(t, server, PullUsername, credential, "repository:other:pull"); len(access) != 0 {
+		t.Errorf("❌ pull credential is granted access to another repository: %v", access)
+	}
+}
+
+func TestGatewayPullCredentialRevoked(t *testing.T) {
+	gateway, server := newTestGateway(t)
+	localRegistry := &parser.LocalRegistry{Username: "admin", Password: "secret"}
+	gateway.Registry = func() (*parser.LocalRegistry, error) { return localRegistry, nil }
+
+	leaked, err := gateway.Issuer.IssuePullCredential([]string{"app"}, localRegistry.PullGeneration, time.Hour)
+	if err != nil {
+		t.Fatalf("❌ failed to issue pull credential: %v", err)
+	}
+	config := &parser.Config{}
+	config.Registry.Auth.Token.Issuer = "locreg"
+	if err := RotateCreds(context.Background(), config, localRegistry); err != nil {
+		t.Fatalf("❌ failed to rotate credentials: %v", err)
+	}
+	if status, _ := requestToken(t, server, PullUsername, leaked, "repository:app:pull"); status != http.StatusUnauthorized {
+		t.Errorf("❌ expected 401 for pull credential issued before rotation, got %d", status)
+	}
+
+	renewed, _ := gateway.Issuer.IssuePullCredential([]string{"app"}, localRegistry.PullGeneration, time.Hour)
+	if status, access := requestToken(t, server, PullUsername, renewed, "repository:app:pull"); status != http.StatusOK || len(access) != 1 {
+		t.Errorf("❌ pull credential issued after rotation is not granted pull, status %d, access %v", status, access)
+	}
+}
+
+func TestGatewayTokenUsers(t *testing.T) {
+	_, server := newTestGateway(t)
+
+	status, access := requestToken(t, server, "ci", "ci-secret", "repository:app:pull,push")
+	if status != http.StatusOK || len(access) != 1 || len(access[0].(map[string]any)["actions"].([]any)) != 2 {
+		t.Errorf("❌ user is not granted pull and push, status %d, access %v", status, access)
+	}
+	status, access = requestToken(t, server, "reader", "reader-secret", "repository:other:pull,push")
+	if status != http.StatusOK || len(access) != 1 {
+		t.Fatalf("❌ read-only user is not granted pull, status %d, access %v", status, access)
+	}
+	if actions := access[0].(map[string]any)["actions"].([]any); len(actions) != 1 || actions[0] != "pull" {
+		t.Errorf("❌ read-only user must be granted only pull, got %v", actions)
+	}
+	if status, _ := requestToken(t, server, "reader", "wrong", "repository:app:pull"); status != http.StatusUnauthorized {
+		t.Errorf("❌ expected 401 for wrong password of user, got %d", status)
+	}
+}
+
+func TestGatewayBasicAuth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	gateway := &Gateway{Upstream: upstreamURL, Registry: testRegistry(t)}
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		method, username, password string
+		expected                   int
+	}{
+		{http.MethodGet, "", "", http.StatusUnauthorized},
+		{http.MethodGet, "admin", "secret", http.StatusAccepted},
+		{http.MethodPost, "ci", "ci-secret", http.StatusAccepted},
+		{http.MethodGet, "reader", "reader-secret", http.StatusAccepted},
+		{http.MethodHead, "reader", "reader-secret", http.StatusAccepted},
+		{http.MethodPut, "reader", "reader-secret", http.StatusForbidden},
+		{http.MethodDelete, "reader", "reader-secret", http.StatusForbidden},
+		{http.MethodGet, "reader", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "unknown", "secret", http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest(tc.method, server.URL+"/v2/app/manifests/latest", nil)
+		if tc.username != "" {
+			req.SetBasicAuth(tc.username, tc.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("❌ request through gateway failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.expected {
+			t.Errorf("❌ %s by %q: expected %d, got %d", tc.method, tc.username, tc.expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestProfileRegistryReload(t *testing.T) {
+	profilePath := filepath.Join(t.TempDir(), ".locreg")
+	if err := parser.SaveProfile(&parser.Profile{LocalRegistry: &parser.LocalRegistry{Username: "admin"}}, profilePath); err != nil {
+		t.Fatal(err)
+	}
+	cache := &profileRegistry{path: profilePath}
+	first, err := cache.load()
+	if err != nil || first.Username != "admin" {
+		t.Fatalf("❌ failed to load registry: %+v, %v", first, err)
+	}
+	if cached, _ := cache.load(); cached != first {
+		t.Error("❌ unchanged profile is parsed again")
+	}
+
+	err = parser.UpdateProfile(profilePath, func(profile *parser.Profile) error {
+		profile.LocalRegistry.Users = append(profile.LocalRegistry.Users, parser.RegistryUser{Username: "ci"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := cache.load(); err != nil || len(reloaded.Users) != 1 {
+		t.Errorf("❌ saved profile is not reloaded: %+v, %v", reloaded, err)
+	}
+}
@@ -0,0 +1,109 @@
+package local_registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// GarbageCollect removes blobs that are not referenced by any manifest from the registry storage.
+// The registry is restarted in read-only mode for the collection, so layers of an image pushed meanwhile
+// aren't removed, and it is restarted with the normal config afterwards. Output of the collection is returned
+func GarbageCollect(config *parser.Config, deleteUntagged bool) (string, error) {
+	ctx := context.Background()
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return "", fmt.Errorf("❌ local registry is not found in profile")
+	}
+	if isEmbedded(config) {
+		return garbageCollectEmbedded(config, profile.LocalRegistry, deleteUntagged)
+	}
+	backend, err := GetBackend(config.Registry.Backend)
+	if err != nil {
+		return "", err
+	}
+	collector, ok := backend.(GarbageCollectingBackend)
+	if !ok {
+		return "", fmt.Errorf("❌ %s registry backend collects garbage on its own", config.Registry.Backend)
+	}
+	readOnlyConfig, err := collector.RenderReadOnlyConfig(config)
+	if err != nil {
+		return "", err
+	}
+	normalConfig, err := backend.RenderConfig(config)
+	if err != nil {
+		return "", err
+	}
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+
+	log.Println("Restarting registry in read-only mode...")
+	if err := reconfigure(dockerClient, ctx, config, backend, profile.LocalRegistry, []ConfigFile{readOnlyConfig}); err != nil {
+		return "", err
+	}
+	output, err := execInContainer(dockerClient, ctx, profile.LocalRegistry.RegistryID, collector.GarbageCollectCommand(deleteUntagged))
+	log.Println("Restarting registry in read-write mode...")
+	if restoreErr := reconfigure(dockerClient, ctx, config, backend, profile.LocalRegistry, normalConfig); restoreErr != nil {
+		return output, fmt.Errorf("❌ registry is left in read-only mode: %w", restoreErr)
+	}
+	if err != nil {
+		return output, fmt.Errorf("❌ garbage collection failed: %w", err)
+	}
+	return output, nil
+}
+
+// reconfigure writes the config files to the registry container and restarts it
+func reconfigure(
+	dockerClient *client.Client,
+	ctx context.Context,
+	config *parser.Config,
+	backend RegistryBackend,
+	localRegistry *parser.LocalRegistry,
+	configFiles []ConfigFile,
+) error {
+	if err := copyFilesToContainer(dockerClient, ctx, localRegistry.RegistryID, configFiles); err != nil {
+		return err
+	}
+	if err := dockerClient.ContainerRestart(ctx, localRegistry.RegistryID, container.StopOptions{}); err != nil {
+		return fmt.Errorf("❌ failed to restart container: %w", err)
+	}
+	return waitForHealthy(ctx, config, backend.HealthEndpoint(), localRegistry.Username, localRegistry.Password)
+}
+
+// execInContainer runs the command in the container and returns its combined output
+func execInContainer(dockerClient *client.Client, ctx context.Context, containerID string, cmd []string) (string, error) {
+	exec, err := dockerClient.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create exec: %w", err)
+	}
+	attach, err := dockerClient.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to attach to exec: %w", err)
+	}
+	defer attach.Close()
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attach.Reader); err != nil {
+		return "", fmt.Errorf("❌ failed to read exec output: %w", err)
+	}
+	inspect, err := dockerClient.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return output.String(), fmt.Errorf("❌ failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return output.String(), fmt.Errorf("%s exited with code %d", strings.Join(cmd, " "), inspect.ExitCode)
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,126 @@
+package local_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// defaultTag is used when the image reference has neither tag nor digest
+const defaultTag = "latest"
+
+// ImageDetails describes an image stored in the registry
+type ImageDetails struct {
+	Repository string
+	Reference  string
+	Digest     string
+	MediaType  string
+	// Platforms are the images of a multi-platform index, other fields below are empty for an index
+	Platforms []ocispec.Descriptor
+	Config    ocispec.Image
+	Layers    []ocispec.Descriptor
+	Size      int64 // Size of the config and the layers
+}
+
+// ParseReference splits `name:tag` or `name@digest` into the repository and the tag or digest,
+// `latest` tag is used if neither is set
+func ParseReference(ref string) (string, string, error) {
+	repository, reference := ref, defaultTag
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		repository, reference = name, digest
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repository, reference = ref[:i], ref[i+1:]
+	}
+	if repository == "" || reference == "" {
+		return "", "", fmt.Errorf("❌ invalid image reference %q, expected name:tag or name@digest", ref)
+	}
+	return repository, reference, nil
+}
+
+// FormatReference joins the repository with the tag or the digest
+func FormatReference(repository, reference string) string {
+	if strings.Contains(reference, ":") {
+		return repository + "@" + reference
+	}
+	return repository + ":" + reference
+}
+
+// InspectImage returns the manifest, the config and the layers of the image
+func InspectImage(ctx context.Context, client *Client, ref string) (*ImageDetails, error) {
+	repository, reference, err := ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := client.ManifestDigest(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	content, mediaType, err := client.GetManifest(ctx, repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	details := &ImageDetails{Repository: repository, Reference: reference, Digest: digest, MediaType: mediaType}
+
+	if isIndex(mediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("❌ failed to decode index of %s: %w", ref, err)
+		}
+		details.Platforms = index.Manifests
+		return details, nil
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("❌ failed to decode manifest of %s: %w", ref, err)
+	}
+	config, _, err := client.GetBlob(ctx, repository, manifest.Config.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	defer config.Close()
+	if err := json.NewDecoder(config).Decode(&details.Config); err != nil {
+		return nil, fmt.Errorf("❌ failed to decode config of %s: %w", ref, err)
+	}
+	details.Layers = manifest.Layers
+	details.Size = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		details.Size += layer.Size
+	}
+	return details, nil
+}
+
+// DeleteImage deletes the manifest the reference points to and returns its digest.
+// Blobs are left in the storage until the registry garbage collection is run
+func DeleteImage(ctx context.Context, client *Client, ref string) (string, error) {
+	repository, reference, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	digest, err := client.ManifestDigest(ctx, repository, reference)
+	if err != nil {
+		return "", err
+	}
+	return digest, client.DeleteManifest(ctx, repository, digest)
+}
+
+// FormatSize returns the size in human-readable units
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func isIndex(mediaType string) bool {
+	return mediaType == ocispec.MediaTypeImageIndex || mediaType == "application/vnd.docker.distribution.manifest.list.v2+json"
+}
@@ -0,0 +1,111 @@
+package local_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	for _, tc := range []struct {
+		ref, repository, reference string
+	}{
+		{"app", "app", "latest"},
+		{"app:v1", "app", "v1"},
+		{"team/app:v1", "team/app", "v1"},
+		{"app@sha256:abc", "app", "sha256:abc"},
+		{"localhost:5000/app", "localhost:5000/app", "latest"},
+	} {
+		repository, reference, err := ParseReference(tc.ref)
+		if err != nil || repository != tc.repository || reference != tc.reference {
+			t.Errorf("❌ %s: expected %s and %s, got %s and %s: %v", tc.ref, tc.repository, tc.reference, repository, reference, err)
+		}
+	}
+	for _, ref := range []string{"", "app:", "@sha256:abc"} {
+		if _, _, err := ParseReference(ref); err == nil {
+			t.Errorf("❌ invalid reference %q is parsed", ref)
+		}
+	}
+}
+
+// newTestRegistry serves repositories `a`, `b` and `c` with image `a:v1`, the catalog is paginated by two repositories
+func newTestRegistry(t *testing.T) (*httptest.Server, *[]string) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/_catalog" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/_catalog?last=b&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"repositories":["a","b"]}`)
+		case r.URL.Path == "/v2/_catalog":
+			fmt.Fprint(w, `{"repositories":["c"]}`)
+		case r.URL.Path == "/v2/a/tags/list":
+			fmt.Fprint(w, `{"name":"a","tags":["v1","v2"]}`)
+		case r.URL.Path == "/v2/a/manifests/v1" || r.URL.Path == "/v2/a/manifests/"+digest:
+			if r.Method == http.MethodDelete {
+				deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/a/manifests/"))
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", digest)
+			fmt.Fprint(w, `{"schemaVersion":2,"config":{"digest":"sha256:2222222222222222222222222222222222222222222222222222222222222222","size":100},
+				"layers":[{"digest":"sha256:3333333333333333333333333333333333333333333333333333333333333333","size":2048}]}`)
+		case strings.HasPrefix(r.URL.Path, "/v2/a/blobs/sha256:2222"):
+			fmt.Fprint(w, `{"architecture":"amd64","os":"linux"}`)
+		default:
+			http.Error(w, `{"errors":[{"code":"NAME_UNKNOWN"}]}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &deleted
+}
+
+func TestCatalogAndTags(t *testing.T) {
+	server, _ := newTestRegistry(t)
+	registryClient := NewClient(server.URL, "admin", "secret")
+
+	repositories, err := registryClient.Catalog(context.Background())
+	if err != nil || strings.Join(repositories, ",") != "a,b,c" {
+		t.Errorf("❌ expected all pages of the catalog, got %v: %v", repositories, err)
+	}
+	tags, err := registryClient.Tags(context.Background(), "a")
+	if err != nil || len(tags) != 2 {
+		t.Errorf("❌ expected two tags, got %v: %v", tags, err)
+	}
+	if _, err := registryClient.Tags(context.Background(), "unknown"); err == nil {
+		t.Error("❌ tags of unknown repository are returned")
+	}
+}
+
+func TestInspectAndDeleteImage(t *testing.T) {
+	server, deleted := newTestRegistry(t)
+	registryClient := NewClient(server.URL, "admin", "secret")
+
+	details, err := InspectImage(context.Background(), registryClient, "a:v1")
+	if err != nil {
+		t.Fatalf("❌ failed to inspect image: %v", err)
+	}
+	if details.Config.Architecture != "amd64" || len(details.Layers) != 1 || details.Size != 2148 {
+		t.Errorf("❌ unexpected image details: %+v", details)
+	}
+
+	digest, err := DeleteImage(context.Background(), registryClient, "a:v1")
+	if err != nil {
+		t.Fatalf("❌ failed to delete image: %v", err)
+	}
+	if len(*deleted) != 1 || (*deleted)[0] != digest {
+		t.Errorf("❌ expected manifest to be deleted by digest %s, deleted %v", digest, *deleted)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, expected := range map[int64]string{512: "512 B", 2048: "2.0 KiB", 5 << 20: "5.0 MiB"} {
+		if actual := FormatSize(size); actual != expected {
+			t.Errorf("❌ expected %s, got %s", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package local_registry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// dockerHubHosts are the upstream hosts Docker daemon `registry-mirrors` are used for
+var dockerHubHosts = []string{"registry-1.docker.io", "index.docker.io", "docker.io"}
+
+// repositoryPath matches the repository name in the path of a Registry HTTP API request
+var repositoryPath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|tags)/`)
+
+// MirrorHandler returns the handler of the mirror listener of the gateway. It serves pulls without credentials,
+// so Docker daemon can use the registry in `registry-mirrors`, therefore it must listen only on the loopback interface
+func (gateway *Gateway) MirrorHandler() http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(gateway.Upstream)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "mirror accepts only pulls")
+			return
+		}
+		if err := gateway.authorizeMirrorRequest(r); err != nil {
+			log.Printf("❌ failed to authorize mirror request: %v", err)
+			registryError(w, http.StatusInternalServerError, "UNKNOWN", "failed to authorize request")
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// authorizeMirrorRequest adds registry credentials to the request, or a token allowing to pull
+// the requested repository with token authentication
+func (gateway *Gateway) authorizeMirrorRequest(r *http.Request) error {
+	if gateway.Issuer == nil {
+		localRegistry, err := gateway.Registry()
+		if err != nil {
+			return err
+		}
+		r.SetBasicAuth(localRegistry.Username, localRegistry.Password)
+		return nil
+	}
+	var access []Access
+	if match := repositoryPath.FindStringSubmatch(r.URL.Path); match != nil {
+		access = []Access{{Type: "repository", Name: match[1], Actions: []string{"pull"}}}
+	}
+	token, err := gateway.Issuer.Issue("locreg-mirror", access, gateway.TokenTTL)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// validateMirror checks `registry.mirror` before the registry is started
+func validateMirror(config *parser.Config) error {
+	port := config.Registry.Mirror.Port
+	if port == 0 {
+		return nil
+	}
+	if config.Registry.Config.Proxy.RemoteURL == "" {
+		return fmt.Errorf("❌ registry.mirror requires registry.config.proxy.remoteurl to be set")
+	}
+	if port < 0 || port > 65535 || port == config.Registry.Port {
+		return fmt.Errorf("❌ registry.mirror.port must be a free port other than registry.port, got %d", port)
+	}
+	return nil
+}
+
+// validatePush checks that the registry accepts pushes, distribution rejects them when it is a pull-through cache
+func validatePush(config *parser.Config) error {
+	if isEmbedded(config) {
+		return nil
+	}
+	backend, err := GetBackend(config.Registry.Backend)
+	if err != nil {
+		return err
+	}
+	if _, ok := backend.(distributionBackend); ok && config.Registry.Config.Proxy.RemoteURL != "" {
+		return fmt.Errorf("❌ distribution registry doesn't accept pushes while it is a pull-through cache of %s, "+
+			"use zot backend to cache and push to the same registry", config.Registry.Config.Proxy.RemoteURL)
+	}
+	return nil
+}
+
+// MirrorHint returns how to pull images through the cache, it is empty if the registry isn't a pull-through cache
+func MirrorHint(config *parser.Config) string {
+	remoteURL := config.Registry.Config.Proxy.RemoteURL
+	if remoteURL == "" {
+		return ""
+	}
+	hint := fmt.Sprintf("Registry caches images of %s, pull them as localhost:%d/<image>", remoteURL, config.Registry.Port)
+	parsed, err := url.Parse(remoteURL)
+	if config.Registry.Mirror.Port == 0 || err != nil || !contains(dockerHubHosts, parsed.Hostname()) {
+		return hint
+	}
+	return hint + fmt.Sprintf(`
+To pull Docker Hub images through the cache during builds add the mirror to /etc/docker/daemon.json and restart Docker:
+  {"registry-mirrors": ["http://127.0.0.1:%d"]}`, config.Registry.Mirror.Port)
+}
@@ -0,0 +1,94 @@
+package local_registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMirrorHandler(t *testing.T) {
+	var authorization string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	gateway := &Gateway{Upstream: upstreamURL, Registry: testRegistry(t)}
+	mirror := httptest.NewServer(gateway.MirrorHandler())
+	defer mirror.Close()
+	resp, err := http.Get(mirror.URL + "/v2/library/redis/manifests/7")
+	if err != nil {
+		t.Fatalf("❌ request through mirror failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(authorization, "Basic ") {
+		t.Errorf("❌ expected pull to be forwarded with registry credentials, got %d and %q", resp.StatusCode, authorization)
+	}
+	req, _ := http.NewRequest(http.MethodPut, mirror.URL+"/v2/library/redis/manifests/7", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("❌ expected push through mirror to be rejected, got %v: %v", resp, err)
+	}
+
+	gateway.Issuer, gateway.TokenTTL = newTestIssuer(t), time.Minute
+	if resp, err := http.Get(mirror.URL + "/v2/library/redis/blobs/sha256:abc"); err == nil {
+		resp.Body.Close()
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(strings.TrimPrefix(authorization, "Bearer "), claims); err != nil {
+		t.Fatalf("❌ expected pull to be forwarded with token, got %q: %v", authorization, err)
+	}
+	access, _ := json.Marshal(claims["access"])
+	if string(access) != `[{"actions":["pull"],"name":"library/redis","type":"repository"}]` {
+		t.Errorf("❌ unexpected token access %s", access)
+	}
+}
+
+func TestZotProxyConfig(t *testing.T) {
+	config := &parser.Config{}
+	config.Registry.Config.Proxy.RemoteURL = "https://registry-1.docker.io"
+	config.Registry.Config.Proxy.Username = "user"
+	config.Registry.Config.Proxy.Password = "password"
+	files, err := zotBackend{}.RenderConfig(config)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("❌ expected config and sync credentials, got %d files: %v", len(files), err)
+	}
+	if !strings.Contains(string(files[0].Content), `"onDemand": true`) ||
+		!strings.Contains(string(files[0].Content), zotSyncCredentialsPath) {
+		t.Errorf("❌ sync is not rendered:\n%s", files[0].Content)
+	}
+	var credentials map[string]map[string]string
+	if err := json.Unmarshal(files[1].Content, &credentials); err != nil || credentials["registry-1.docker.io"]["username"] != "user" {
+		t.Errorf("❌ unexpected sync credentials %s: %v", files[1].Content, err)
+	}
+}
+
+func TestMirrorValidation(t *testing.T) {
+	config := &parser.Config{}
+	config.Registry.Port = 5000
+	config.Registry.Mirror.Port = 5001
+	if err := validateMirror(config); err == nil {
+		t.Error("❌ mirror without proxy is accepted")
+	}
+	config.Registry.Config.Proxy.RemoteURL = "https://registry-1.docker.io"
+	if err := validateMirror(config); err != nil {
+		t.Errorf("❌ valid mirror is rejected: %v", err)
+	}
+	if !strings.Contains(MirrorHint(config), `"registry-mirrors": ["http://127.0.0.1:5001"]`) {
+		t.Errorf("❌ Docker daemon hint is missing: %s", MirrorHint(config))
+	}
+	if err := validatePush(config); err == nil {
+		t.Error("❌ push to distribution pull-through cache is accepted")
+	}
+	config.Registry.Backend = "zot"
+	if err := validatePush(config); err != nil {
+		t.Errorf("❌ push to zot pull-through cache is rejected: %v", err)
+	}
+}
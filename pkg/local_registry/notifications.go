@@ -0,0 +1,316 @@
+package local_registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+const (
+	// listenerDaemonName is the name of the background process redeploying cloud resources on pushes
+	listenerDaemonName = "registry-listener"
+	// notificationsEndpointName is the name of the endpoint locreg adds to the distribution configuration
+	notificationsEndpointName = "locreg"
+	// notificationsPath is the path the registry posts events to
+	notificationsPath = "/events"
+	// notificationsMediaType is the media type of the envelope of events posted by distribution
+	notificationsMediaType = "application/vnd.docker.distribution.events.v1+json"
+	// maxNotificationSize is the size of the largest envelope accepted by the listener
+	maxNotificationSize = 1 << 20
+)
+
+// ListenerDaemonArgs are the locreg arguments that run the notification listener daemon
+var ListenerDaemonArgs = []string{"registry", "listen"}
+
+// PushEvent is a push of a tagged manifest reported by the registry
+type PushEvent struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// notificationEnvelope is the subset of the envelope of events posted by distribution that is used by the listener
+type notificationEnvelope struct {
+	Events []notificationEvent `json:"events"`
+}
+
+type notificationEvent struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Target    struct {
+		MediaType  string `json:"mediaType"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag,omitempty"`
+	} `json:"target"`
+}
+
+// NotificationListener receives events posted by the registry and calls OnPush for pushes of the image configured
+// under `image`. Pushes received while OnPush is running are coalesced into a single call made after it returns
+type NotificationListener struct {
+	// Secret is the bearer token the registry sends with events
+	Secret string
+	// LoadConfig is called for every event, so the image tag defaulting to the git SHA follows new commits
+	LoadConfig func() (*parser.Config, error)
+	OnPush     func(config *parser.Config, event PushEvent) error
+
+	once    sync.Once
+	pending chan PushEvent
+}
+
+// queue returns the channel holding the push waiting to be handled, at most one push waits at a time
+func (listener *NotificationListener) queue() chan PushEvent {
+	listener.once.Do(func() {
+		listener.pending = make(chan PushEvent, 1)
+	})
+	return listener.pending
+}
+
+// Handler returns the handler of the events posted by the registry
+func (listener *NotificationListener) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != notificationsPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+listener.Secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var envelope notificationEnvelope
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxNotificationSize)).Decode(&envelope); err != nil {
+			http.Error(w, "invalid events envelope", http.StatusBadRequest)
+			return
+		}
+		config, err := listener.LoadConfig()
+		if err != nil {
+			log.Printf("❌ failed to load config: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, event := range envelope.Events {
+			if event.Action != "push" || event.Target.Repository != config.Image.Name || event.Target.Tag != config.Image.Tag {
+				continue
+			}
+			push := PushEvent{Repository: event.Target.Repository, Tag: event.Target.Tag, Digest: event.Target.Digest}
+			select {
+			case listener.queue() <- push:
+				log.Printf("📦 %s:%s pushed (%s)", push.Repository, push.Tag, push.Digest)
+			default:
+				// A redeploy is already pending, it picks up the latest image anyway
+			}
+		}
+		// Registry retries events until it gets a 2xx, failures of redeploys are only logged
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// Run calls OnPush for received pushes until the context is done
+func (listener *NotificationListener) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case push := <-listener.queue():
+			config, err := listener.LoadConfig()
+			if err == nil {
+				err = listener.OnPush(config, push)
+			}
+			if err != nil {
+				log.Printf("❌ failed to redeploy %s:%s: %v", push.Repository, push.Tag, err)
+			}
+		}
+	}
+}
+
+// RunNotificationListener listens for events of the local registry until SIGTERM or SIGINT is received and calls onPush
+// when the image configured under `image` is pushed
+func RunNotificationListener(configFilePath string, onPush func(config *parser.Config, event PushEvent) error) error {
+	config, err := parser.LoadConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("❌ failed to load config: %w", err)
+	}
+	secret, err := notificationSecret()
+	if err != nil {
+		return err
+	}
+	listener := &NotificationListener{
+		Secret:     secret,
+		LoadConfig: func() (*parser.Config, error) { return parser.LoadConfig(configFilePath) },
+		OnPush:     onPush,
+	}
+	// Registry container reaches the host through the Docker gateway, the embedded registry posts from the host itself
+	address := fmt.Sprintf(":%d", config.Registry.Notifications.Port)
+	if isEmbedded(config) {
+		address = fmt.Sprintf("127.0.0.1:%d", config.Registry.Notifications.Port)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           listener.Handler(),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	go listener.Run(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("✅ Notification listener is listening on %s for pushes of %s", address, config.GetRegistryImage())
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		return fmt.Errorf("❌ notification listener failed: %w", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// postPushEvent posts the push to the listener in the envelope format of distribution, it is used by the embedded registry
+func postPushEvent(ctx context.Context, url, secret string, event PushEvent, mediaType string) error {
+	notification := notificationEvent{
+		ID:        parser.GenerateRandomString(16),
+		Timestamp: time.Now().UTC(),
+		Action:    "push",
+	}
+	notification.Target.MediaType = mediaType
+	notification.Target.Digest = event.Digest
+	notification.Target.Repository = event.Repository
+	notification.Target.Tag = event.Tag
+	body, err := json.Marshal(notificationEnvelope{Events: []notificationEvent{notification}})
+	if err != nil {
+		return fmt.Errorf("❌ failed to encode push event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("❌ failed to create push event request: %w", err)
+	}
+	req.Header.Set("Content-Type", notificationsMediaType)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("❌ failed to post push event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("❌ notification listener responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// notificationEndpoint returns the endpoint the registry container posts events to, pulls aren't posted
+func notificationEndpoint(config *parser.Config) (DistributionEndpoint, error) {
+	secret, err := notificationSecret()
+	if err != nil {
+		return DistributionEndpoint{}, err
+	}
+	return DistributionEndpoint{
+		Name:      notificationsEndpointName,
+		URL:       fmt.Sprintf("http://%s:%d%s", gatewayHost, config.Registry.Notifications.Port, notificationsPath),
+		Headers:   map[string][]string{"Authorization": {"Bearer " + secret}},
+		Timeout:   "5s",
+		Threshold: 5,
+		Backoff:   "1s",
+		Ignore:    &DistributionIgnore{Actions: []string{"pull"}},
+	}, nil
+}
+
+// notificationExtraHosts lets the registry container reach the listener running on the host
+func notificationExtraHosts(config *parser.Config) []string {
+	if !config.IsRedeployOnPushEnabled() {
+		return nil
+	}
+	return []string{gatewayHost + ":host-gateway"}
+}
+
+// validateNotifications checks `registry.notifications`
+func validateNotifications(config *parser.Config) error {
+	if !config.IsRedeployOnPushEnabled() {
+		return nil
+	}
+	if backend := config.Registry.Backend; backend != "" && backend != defaultBackend && backend != EmbeddedBackend {
+		return fmt.Errorf("❌ registry.notifications is not supported by %s registry backend", backend)
+	}
+	port := config.Registry.Notifications.Port
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("❌ registry.notifications.port must be between 1 and 65535, got %d", port)
+	}
+	if port == config.Registry.Port || port == config.Registry.Mirror.Port {
+		return fmt.Errorf("❌ registry.notifications.port %d is already used by the registry", port)
+	}
+	return nil
+}
+
+// startListener runs the notification listener daemon and records its PID in the profile
+func startListener() error {
+	pid, err := daemon.Spawn(listenerDaemonName, ListenerDaemonArgs...)
+	if err != nil {
+		return err
+	}
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		localRegistry.ListenerPID = pid
+		return nil
+	})
+	if err != nil {
+		_ = daemon.Stop(pid)
+		return err
+	}
+	return nil
+}
+
+// stopListener stops the notification listener daemon recorded in the profile
+func stopListener(localRegistry *parser.LocalRegistry) error {
+	if localRegistry.ListenerPID == 0 {
+		return nil
+	}
+	if err := daemon.Stop(localRegistry.ListenerPID); err != nil {
+		return fmt.Errorf("❌ failed to stop notification listener: %w", err)
+	}
+	return nil
+}
+
+// notificationSecret returns the token the registry authenticates to the listener with, it is generated once
+func notificationSecret() (string, error) {
+	dir, err := daemon.Dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "notifications.secret")
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		return string(secret), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("❌ failed to read notification secret: %w", err)
+	}
+	generated := parser.GenerateRandomString(32)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("❌ failed to create daemon directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(generated), 0600); err != nil {
+		return "", fmt.Errorf("❌ failed to write notification secret: %w", err)
+	}
+	return generated, nil
+}
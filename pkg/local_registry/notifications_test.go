@@ -0,0 +1,131 @@
+package local_registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/opencontainers/go-digest"
+)
+
+// notificationConfig returns a config pushing app:v2 with redeploy on push enabled
+func notificationConfig() *parser.Config {
+	config := &parser.Config{}
+	config.Image.Name, config.Image.Tag = "app", "v2"
+	config.Registry.Port = 5000
+	config.Registry.Notifications.Redeploy = true
+	config.Registry.Notifications.Port = 5010
+	return config
+}
+
+func TestNotificationListener(t *testing.T) {
+	pushes := make(chan PushEvent, 10)
+	listener := &NotificationListener{
+		Secret:     "secret",
+		LoadConfig: func() (*parser.Config, error) { return notificationConfig(), nil },
+		OnPush: func(config *parser.Config, event PushEvent) error {
+			pushes <- event
+			return nil
+		},
+	}
+	server := httptest.NewServer(listener.Handler())
+	defer server.Close()
+	ctx := context.Background()
+
+	if err := postPushEvent(ctx, server.URL+notificationsPath, "wrong", PushEvent{Repository: "app", Tag: "v2"}, ""); err == nil {
+		t.Error("❌ event with wrong secret is accepted")
+	}
+	for _, event := range []PushEvent{{Repository: "app", Tag: "v1"}, {Repository: "tool", Tag: "v2"}} {
+		if err := postPushEvent(ctx, server.URL+notificationsPath, "secret", event, ""); err != nil {
+			t.Fatalf("❌ failed to post event: %v", err)
+		}
+	}
+	// Pushes received before the listener runs are coalesced into one
+	for _, d := range []string{"sha256:1", "sha256:2"} {
+		if err := postPushEvent(ctx, server.URL+notificationsPath, "secret", PushEvent{Repository: "app", Tag: "v2", Digest: d}, ""); err != nil {
+			t.Fatalf("❌ failed to post event: %v", err)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go listener.Run(runCtx)
+	select {
+	case push := <-pushes:
+		if push.Repository != "app" || push.Tag != "v2" || push.Digest != "sha256:1" {
+			t.Errorf("❌ unexpected push %+v", push)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("❌ push of the configured image is not handled")
+	}
+	select {
+	case push := <-pushes:
+		t.Errorf("❌ push %+v is not coalesced or doesn't match the configured image", push)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotificationEndpoint(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config := notificationConfig()
+	distributionConfig, err := NewDistributionConfig(config)
+	if err != nil {
+		t.Fatalf("❌ failed to build registry config: %v", err)
+	}
+	secret, err := notificationSecret()
+	if err != nil {
+		t.Fatalf("❌ failed to read notification secret: %v", err)
+	}
+	if distributionConfig.Notifications == nil || len(distributionConfig.Notifications.Endpoints) != 1 {
+		t.Fatalf("❌ notification endpoint is not rendered: %v", distributionConfig.Notifications)
+	}
+	endpoint := distributionConfig.Notifications.Endpoints[0]
+	if endpoint.URL != "http://host.docker.internal:5010/events" || endpoint.Headers["Authorization"][0] != "Bearer "+secret {
+		t.Errorf("❌ unexpected notification endpoint %+v", endpoint)
+	}
+	if hosts := notificationExtraHosts(config); len(hosts) != 1 || !strings.HasPrefix(hosts[0], gatewayHost) {
+		t.Errorf("❌ registry container can't reach the listener, extra hosts %v", hosts)
+	}
+
+	if err := validateNotifications(config); err != nil {
+		t.Errorf("❌ valid config is rejected: %v", err)
+	}
+	config.Registry.Notifications.Port = config.Registry.Port
+	if err := validateNotifications(config); err == nil {
+		t.Error("❌ listener port equal to registry port is accepted")
+	}
+	config = notificationConfig()
+	config.Registry.Backend = "zot"
+	if err := validateNotifications(config); err == nil {
+		t.Error("❌ notifications are accepted by zot backend")
+	}
+}
+
+func TestEmbeddedPushNotification(t *testing.T) {
+	storage, err := embedded.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	pushes := make(chan [2]string, 10)
+	server := httptest.NewServer(&embedded.Server{
+		Storage: storage,
+		OnManifestPush: func(name, tag string, _ digest.Digest, _ string) {
+			pushes <- [2]string{name, tag}
+		},
+	})
+	defer server.Close()
+
+	pushToEmbedded(t, NewClient(server.URL, "", ""), "app", "v2", time.Now())
+	select {
+	case push := <-pushes:
+		if push != [2]string{"app", "v2"} {
+			t.Errorf("❌ unexpected push %v", push)
+		}
+	default:
+		t.Fatal("❌ push of a tag is not reported")
+	}
+}
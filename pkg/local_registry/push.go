@@ -6,20 +6,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
+	"os"
 	"time"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/archive"
 )
 
-func BuildCommand(configFilePath string, dir string) error {
+// BuildCommand builds the image from the directory, or from `image.build.context` if it is empty, with `image.build`
+// settings overridden by the options and pushes it
+func BuildCommand(configFilePath string, dir string, options BuildOptions) error {
 	config, err := parser.LoadConfig(configFilePath)
 	if err != nil {
 		return fmt.Errorf("❌ failed to load config: %w", err)
 	}
+	options.apply(config)
+
+	if err := validatePush(config); err != nil {
+		return err
+	}
+	if dir, err = buildContext(config, dir); err != nil {
+		return err
+	}
 
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
@@ -27,30 +36,85 @@ func BuildCommand(configFilePath string, dir string) error {
 	}
 	profile, _ := parser.LoadProfileData()
 
-	return imageBuildAndPush(cli, dir, config, profile)
+	if err := imageBuildAndPush(cli, dir, config, profile); err != nil {
+		return err
+	}
+	applyRetentionAfterPush(config)
+	return nil
 }
 
-func imageBuildAndPush(dockerClient *client.Client, dir string, config *parser.Config, profile *parser.Profile) error {
+// PushImageCommand tags the image from the local Docker daemon with the image name and tag from the config and pushes it,
+// so images built by other tools are pushed without building them again
+func PushImageCommand(configFilePath string, source string) error {
+	config, err := parser.LoadConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("❌ failed to load config: %w", err)
+	}
+	if err := validatePush(config); err != nil {
+		return err
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	profile, _ := parser.LoadProfileData()
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
 	defer cancel()
+	imageTag := localImageTag(config)
+	if err := cli.ImageTag(ctx, source, imageTag); err != nil {
+		return fmt.Errorf("❌ failed to tag image %s: %w", source, err)
+	}
+	if err := imagePush(ctx, cli, imageTag, config, profile); err != nil {
+		return err
+	}
+	applyRetentionAfterPush(config)
+	return nil
+}
 
-	ImageTagString := fmt.Sprintf("localhost:%d/%s:%s", config.Registry.Port, config.Image.Name, config.Image.Tag)
-	authConfig := registry.AuthConfig{
-		Username:      profile.LocalRegistry.Username,
-		Password:      profile.LocalRegistry.Password,
-		ServerAddress: fmt.Sprintf("http://127.0.0.1:%d", config.Registry.Port),
+// PushArchiveCommand pushes the image of the OCI layout archive, e.g. written by `docker save` or Bazel, with the image
+// name and tag from the config. It talks to the registry API directly, so Docker isn't needed
+func PushArchiveCommand(configFilePath string, archivePath string) error {
+	config, err := parser.LoadConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("❌ failed to load config: %w", err)
+	}
+	if err := validatePush(config); err != nil {
+		return err
 	}
 
-	tar, err := archive.TarWithOptions(dir, &archive.TarOptions{})
+	registryClient, err := NewLocalClient(config)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(archivePath)
 	if err != nil {
-		return fmt.Errorf("❌ failed to create tar archive: %w", err)
+		return fmt.Errorf("❌ failed to open archive: %w", err)
 	}
+	defer file.Close()
+	if _, err := ImportImages(context.Background(), registryClient, file, config.GetRegistryImage()); err != nil {
+		return err
+	}
+	applyRetentionAfterPush(config)
+	return nil
+}
 
-	buildOpts := types.ImageBuildOptions{
-		Dockerfile: "Dockerfile",
-		Tags:       []string{ImageTagString},
-		Remove:     true,
+func imageBuildAndPush(dockerClient *client.Client, dir string, config *parser.Config, profile *parser.Profile) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	ImageTagString := localImageTag(config)
+	buildOpts, err := imageBuildOptions(config, dir, ImageTagString)
+	if err != nil {
+		return err
+	}
+	tar, err := contextArchive(dir, buildOpts.Dockerfile)
+	if err != nil {
+		return err
 	}
+	defer tar.Close()
+
 	buildResponse, err := dockerClient.ImageBuild(ctx, tar, buildOpts)
 	if err != nil {
 		return fmt.Errorf("❌ failed to build image: %w", err)
@@ -61,13 +125,38 @@ func imageBuildAndPush(dockerClient *client.Client, dir string, config *parser.C
 		return fmt.Errorf("❌ error during image build: %w", err)
 	}
 
+	return imagePush(ctx, dockerClient, ImageTagString, config, profile)
+}
+
+// imagePush pushes the image tagged for the local registry with the credentials recorded in the profile
+func imagePush(ctx context.Context, dockerClient *client.Client, imageTag string, config *parser.Config, profile *parser.Profile) error {
+	if profile == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry is not found in profile")
+	}
+	authConfig := registry.AuthConfig{
+		Username:      profile.LocalRegistry.Username,
+		Password:      profile.LocalRegistry.Password,
+		ServerAddress: fmt.Sprintf("http://127.0.0.1:%d", config.Registry.Port),
+	}
+	if config.IsTokenAuthEnabled() {
+		// Token is scoped to the image repository, so the build can't touch other images
+		token, err := PushToken(config)
+		if err != nil {
+			return err
+		}
+		authConfig = registry.AuthConfig{
+			RegistryToken: token,
+			ServerAddress: authConfig.ServerAddress,
+		}
+	}
+
 	encodedJSON, err := json.Marshal(authConfig)
 	if err != nil {
 		return fmt.Errorf("❌ failed to encode auth config: %w", err)
 	}
 	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
 
-	pushResponse, err := dockerClient.ImagePush(ctx, ImageTagString, image.PushOptions{
+	pushResponse, err := dockerClient.ImagePush(ctx, imageTag, image.PushOptions{
 		RegistryAuth: authStr,
 	})
 	if err != nil {
@@ -81,3 +170,8 @@ func imageBuildAndPush(dockerClient *client.Client, dir string, config *parser.C
 
 	return nil
 }
+
+// localImageTag returns the image name and tag from the config on the local registry
+func localImageTag(config *parser.Config) string {
+	return fmt.Sprintf("localhost:%d/%s", config.Registry.Port, config.GetRegistryImage())
+}
@@ -0,0 +1,61 @@
+package local_registry
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry/embedded"
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestPushArchiveCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+	source := newEmbeddedClient(t)
+	pushToEmbedded(t, source, "bazel/app", "built", time.Now())
+	archivePath := filepath.Join(t.TempDir(), "app.tar")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("❌ failed to create archive: %v", err)
+	}
+	descriptor, err := ExportImage(ctx, source, "bazel/app:built", file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("❌ failed to export image: %v", err)
+	}
+
+	storage, err := embedded.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("❌ failed to create storage: %v", err)
+	}
+	server := httptest.NewServer(&embedded.Server{
+		Storage:      storage,
+		Authenticate: func(username, password string) bool { return username == "admin" && password == "secret" },
+	})
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	profile, profilePath := parser.LoadProfileData()
+	profile.LocalRegistry = &parser.LocalRegistry{Username: "admin", Password: "secret"}
+	if err := parser.SaveProfile(profile, profilePath); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(t.TempDir(), "locreg.yaml")
+	config := fmt.Sprintf("registry:\n  backend: embedded\n  port: %s\nimage:\n  name: app\n  tag: dev\n", serverURL.Port())
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PushArchiveCommand(configPath, archivePath); err != nil {
+		t.Fatalf("❌ failed to push archive: %v", err)
+	}
+	digest, err := NewClient(server.URL, "admin", "secret").ManifestDigest(ctx, "app", "dev")
+	if err != nil || digest != descriptor.Digest.String() {
+		t.Errorf("❌ expected app:dev to be the archived image %s, got %s: %v", descriptor.Digest, digest, err)
+	}
+}
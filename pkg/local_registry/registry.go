@@ -2,11 +2,13 @@ package local_registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
@@ -15,19 +17,62 @@ import (
 
 // RunRegistry runs a local Docker registry container with configuration
 func runRegistry(dockerClient *client.Client, ctx context.Context, config *parser.Config) error {
+	backend, err := GetBackend(config.Registry.Backend)
+	if err != nil {
+		return err
+	}
+	// Render config before anything is created so that invalid `registry.config` doesn't leave a broken container
+	configFiles, err := backend.RenderConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := validateMirror(config); err != nil {
+		return err
+	}
+	if err := validateNotifications(config); err != nil {
+		return err
+	}
+	mounts, err := storageMounts(config, backend)
+	if err != nil {
+		return err
+	}
+	authFiles, err := backend.SetupAuth(config.Registry.Username, config.Registry.Password)
+	if err != nil {
+		return err
+	}
+	users, err := configuredUsers(config)
+	if err != nil {
+		return err
+	}
 	// Use configuration values
-	registryPort := fmt.Sprintf("%d", config.Registry.Port)
-	imageVersion := fmt.Sprintf("docker.io/%s:%s", config.Registry.Image, config.Registry.Tag)
+	registryHostIP, registryPort := "0.0.0.0", fmt.Sprintf("%d", config.Registry.Port)
+	imageVersion := backend.Image(config)
+
+	if config.IsTokenAuthEnabled() {
+		if err := validateTokenAuth(config, backend); err != nil {
+			return err
+		}
+		issuer, err := LoadTokenIssuer(config)
+		if err != nil {
+			return err
+		}
+		authFiles = append(authFiles, backend.(TokenAuthBackend).SetupTokenAuth(issuer.CertificatePEM())...)
+	}
+	gateway := config.IsRegistryGatewayEnabled()
+	if gateway {
+		// Registry port is taken by the gateway, the container is published on a random local port instead
+		registryHostIP, registryPort = "127.0.0.1", ""
+	}
 
 	// Create specifically formatted string for port mapping
-	port, err := nat.NewPort("tcp", "5000")
+	port, err := nat.NewPort("tcp", fmt.Sprintf("%d", backend.Port()))
 	if err != nil {
 		return fmt.Errorf("❌ failed to run on port: %w", err)
 	}
 	portBindings := nat.PortMap{ // Container port bindings
 		port: []nat.PortBinding{
 			{
-				HostIP:   "0.0.0.0",
+				HostIP:   registryHostIP,
 				HostPort: registryPort,
 			},
 		},
@@ -35,7 +80,7 @@ func runRegistry(dockerClient *client.Client, ctx context.Context, config *parse
 
 	imagePuller, err := dockerClient.ImagePull(ctx, imageVersion, image.PullOptions{})
 	if err != nil {
-		return fmt.Errorf("❌ failed to pull distribution image: %w", err)
+		return fmt.Errorf("❌ failed to pull registry image: %w", err)
 	}
 	if err := PrintLog(imagePuller); err != nil {
 		log.Fatalf("❌ failed to pull image: %v", err)
@@ -48,20 +93,22 @@ func runRegistry(dockerClient *client.Client, ctx context.Context, config *parse
 	},
 		&container.HostConfig{
 			PortBindings: portBindings,
+			Mounts:       mounts,
+			ExtraHosts:   notificationExtraHosts(config),
 		},
 		&network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
-				getNetworkID(dockerClient, config.Tunnel.Provider.Ngrok.NetworkName): {}, // connect container to ngrok network os it can be tunneled
+				getNetworkID(dockerClient, config.TunnelNetworkName()): {}, // connect container to ngrok network os it can be tunneled
 			},
 		},
 		nil,
 		config.Registry.Name,
 	)
 	if err != nil {
-		return fmt.Errorf("❌ failed to create distribution container: %w", err)
+		return fmt.Errorf("❌ failed to create registry container: %w", err)
 	}
 
-	err = updateConfig(dockerClient, ctx, resp.ID, config.Registry.Username, config.Registry.Password)
+	err = copyFilesToContainer(dockerClient, ctx, resp.ID, append(configFiles, authFiles...))
 	if err != nil {
 		defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
 		return fmt.Errorf("❌ failed to update config: %w", err)
@@ -70,28 +117,95 @@ func runRegistry(dockerClient *client.Client, ctx context.Context, config *parse
 	err = dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{})
 	if err != nil {
 		defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
-		return fmt.Errorf("❌ failed to start distribution container: %w", err)
+		return fmt.Errorf("❌ failed to start registry container: %w", err)
 	}
 	fmt.Printf("✅ Container started with ID: %s\n", resp.ID)
 
-	err = writeProfileLocalRegistry(resp.ID, config.Registry.Username, config.Registry.Password)
+	localRegistry := &parser.LocalRegistry{
+		RegistryID: resp.ID,
+		Username:   config.Registry.Username,
+		Password:   config.Registry.Password,
+		Users:      users,
+	}
+	for _, m := range mounts {
+		if m.Type == mount.TypeVolume {
+			localRegistry.Volume = m.Source
+		} else {
+			localRegistry.DataPath = m.Source
+		}
+	}
+	if gateway {
+		localRegistry.Upstream, err = publishedAddress(dockerClient, ctx, resp.ID, port)
+		if err != nil {
+			defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
+			return err
+		}
+	}
+	err = writeProfileLocalRegistry(localRegistry)
 	if err != nil {
 		defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
 		return fmt.Errorf("❌ failed to write profile: %w", err)
 	}
+
+	if gateway {
+		err = startGateway()
+		if err != nil {
+			defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
+			return err
+		}
+	}
+	err = waitForHealthy(ctx, config, backend.HealthEndpoint(), config.Registry.Username, config.Registry.Password)
+	if err != nil {
+		defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
+		if gateway {
+			return fmt.Errorf("%w, see %s", err, daemonLogHint(gatewayDaemonName))
+		}
+		return err
+	}
+	if config.IsRedeployOnPushEnabled() {
+		err = startListener()
+		if err != nil {
+			defer errorCleanup(resp.ID, &err) // define postpone function to remove container if error occurs
+			return err
+		}
+		fmt.Printf("✅ Pushes of %s redeploy cloud resources, see %s\n", config.GetRegistryImage(), daemonLogHint(listenerDaemonName))
+	}
 	return nil
 }
 
+// publishedAddress returns the local address the container port is published on
+func publishedAddress(dockerClient *client.Client, ctx context.Context, containerID string, port nat.Port) (string, error) {
+	containerInfo, err := dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to inspect registry container: %w", err)
+	}
+	bindings := containerInfo.NetworkSettings.Ports[port]
+	if len(bindings) == 0 {
+		return "", fmt.Errorf("❌ registry container port %s is not published", port)
+	}
+	return fmt.Sprintf("127.0.0.1:%s", bindings[0].HostPort), nil
+}
+
 func errorCleanup(containerID string, err *error) {
 	if err == nil {
 		return
 	}
-	if errDestroy := DestroyLocalRegistry(); errDestroy != nil {
+	if errDestroy := DestroyLocalRegistry(false); errDestroy != nil {
 		cleanupErr := StopAndRemoveContainer(containerID)
 		if cleanupErr != nil {
 			log.Fatalf("❌ Failed to remove container: %v. You will need to do this manually", cleanupErr)
 		}
 	}
+	// Forget the registry so the next run does not report it as existing
+	cleanupErr := parser.Update(func(profile *parser.Profile) error {
+		if profile.LocalRegistry != nil && profile.LocalRegistry.RegistryID == containerID {
+			profile.LocalRegistry = nil
+		}
+		return nil
+	})
+	if cleanupErr != nil {
+		log.Printf("❌ Failed to remove registry from profile: %v", cleanupErr)
+	}
 }
 
 func InitCommand(configFilePath string) error {
@@ -101,25 +215,79 @@ func InitCommand(configFilePath string) error {
 		return fmt.Errorf("❌ failed to load config: %w", err)
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if isEmbedded(config) {
+		err = runEmbeddedRegistry(ctx, config)
+	} else {
+		var cli *client.Client
+		cli, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return fmt.Errorf("❌ failed to create Docker client: %w", err)
+		}
+		err = runRegistry(cli, ctx, config)
+	}
 	if err != nil {
-		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+		return err
+	}
+	if hint := MirrorHint(config); hint != "" {
+		fmt.Println(hint)
 	}
-	return runRegistry(cli, ctx, config)
+	return nil
 }
 
+// RotateCommand generates new credentials of the local registry, applies them to the registry
+// and records them in the profile. Deployed cloud resources are updated separately by their providers
 func RotateCommand(configFilePath string) error {
 	ctx := context.Background()
 	config, err := parser.LoadConfig(configFilePath)
 	if err != nil {
 		return fmt.Errorf("❌ failed to load config: %w", err)
 	}
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry is not found in profile")
+	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	rotated := *profile.LocalRegistry
+	rotated.Username = parser.GenerateRandomString(36)
+	rotated.Password = parser.GenerateRandomString(36)
+	if err := RotateCreds(ctx, config, &rotated); err != nil {
+		return err
+	}
+
+	// Only the credentials are updated, users may have been added while the registry was restarting
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		localRegistry.Username, localRegistry.Password = rotated.Username, rotated.Password
+		localRegistry.PullGeneration = max(localRegistry.PullGeneration, rotated.PullGeneration)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+		return fmt.Errorf("❌ failed to save profile, registry credentials are username %s and password %s: %w",
+			rotated.Username, rotated.Password, err)
 	}
-	return RotateCreds(cli, ctx, config.Registry.Username, config.Registry.Password, config.Registry.Name)
+	fmt.Println("✅ Registry credentials rotated")
+	return nil
+}
+
+// VerifyPull pulls the manifest of the configured image from the local registry with the credentials
+// handed to cloud runtimes, so broken credentials are noticed before the runtime tries to pull
+func VerifyPull(config *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	// Test credential isn't handed to cloud resources, so its expiration isn't recorded
+	username, password, _, err := runtimeCredentials(config, profile)
+	if err != nil {
+		return err
+	}
+	registryClient := NewClient(fmt.Sprintf("http://127.0.0.1:%d", config.Registry.Port), username, password)
+	_, _, err = registryClient.GetManifest(context.Background(), config.Image.Name, config.Image.Tag)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("✅ Credentials are accepted by the registry, image %s is not pushed yet", config.GetRegistryImage())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("❌ test pull of %s failed: %w", config.GetRegistryImage(), err)
+	}
+	log.Printf("✅ Test pull of %s succeeded", config.GetRegistryImage())
+	return nil
 }
 
 func getNetworkID(dockerClient *client.Client, networkName string) string {
@@ -142,26 +310,23 @@ func getNetworkID(dockerClient *client.Client, networkName string) string {
 	return resp[0].ID
 }
 
-func writeProfileLocalRegistry(containerID, username, password string) error {
-	profilePath, err := parser.GetProfilePath()
-	if err != nil {
-		return fmt.Errorf("❌ failed to get profile path: %w", err)
-	}
-
-	profile, err := parser.LoadOrCreateProfile(profilePath)
+func writeProfileLocalRegistry(localRegistry *parser.LocalRegistry) error {
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.LocalRegistry = localRegistry
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("❌ failed to load or create profile: %w", err)
-	}
-
-	profile.LocalRegistry = &parser.LocalRegistry{
-		RegistryID: containerID,
-		Username:   username,
-		Password:   password,
-	}
-
-	if err := parser.SaveProfile(profile, profilePath); err != nil {
 		return fmt.Errorf("❌ failed to save profile: %w", err)
 	}
-
 	return nil
 }
+
+// updateProfileRegistry applies the update to the registry recorded in the profile under the profile lock
+func updateProfileRegistry(update func(localRegistry *parser.LocalRegistry) error) error {
+	return parser.Update(func(profile *parser.Profile) error {
+		if profile.LocalRegistry == nil {
+			return fmt.Errorf("❌ local registry is not found in profile")
+		}
+		return update(profile.LocalRegistry)
+	})
+}
@@ -4,165 +4,92 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"io"
-	"log"
+	"strings"
 
+	"github.com/Uitware/locreg/pkg/parser"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func updateConfig(
-	dockerClient *client.Client,
-	ctx context.Context,
-	containerID, username, password string,
-) error {
-	// Prepare credentials
-	// Password configuration for registry should be hashed using bcrypt
-	credsTarBuffer := prepareCreds(username, password)
-	// Write password file to container
-	err := dockerClient.CopyToContainer(
-		ctx,
-		containerID,
-		"/",
-		credsTarBuffer,
-		container.CopyToContainerOptions{},
-	)
-	if err != nil {
-		return fmt.Errorf("❌ failed to copy to container: %w", err)
+// RotateCreds writes the credentials of the local registry recorded in the profile to its container and restarts it.
+// With token authentication credentials are checked by the gateway, so the container is left untouched
+// and pull-only credentials issued so far are revoked by moving to the next generation.
+// The embedded registry picks up the rewritten htpasswd file without a restart
+func RotateCreds(ctx context.Context, config *parser.Config, localRegistry *parser.LocalRegistry) error {
+	if config.IsTokenAuthEnabled() {
+		localRegistry.PullGeneration++
+		return nil
 	}
-	// Docker config variables
-	configUpdates := `
-auth:  
-  htpasswd:
-    realm: basic-realm    
-    path: /htpasswd
-` // May want to use structs later
-
-	//Read from config
-	reader, _, err := dockerClient.CopyFromContainer(
-		ctx,
-		containerID,
-		"/etc/docker/registry/config.yml",
-	)
-	if err != nil {
-		return fmt.Errorf("❌ copy from container: %w", err)
-	}
-	defer reader.Close()
-
-	tarReader := tar.NewReader(reader)
-	var yamlBytes []byte
-	// iterate through the tar archive to find the config file if EOF reached stops use to remove header
-	for {
-		header, err := tarReader.Next()
-		if errors.Is(err, io.EOF) {
-			break // End of archive
-		}
-		if err != nil {
-			return fmt.Errorf("❌ error reading tar file: %w", err)
-		}
-		if header.Name == "config.yml" {
-			yamlBytes, err = io.ReadAll(tarReader)
-			if err != nil {
-				return fmt.Errorf("❌ error reading config.yml: %w", err)
-			}
-			break
+	if isEmbedded(config) {
+		if err := writeEmbeddedHtpasswd(localRegistry.Username, localRegistry.Password); err != nil {
+			return err
 		}
+		return waitForHealthy(ctx, config, embeddedHealthEndpoint, localRegistry.Username, localRegistry.Password)
 	}
-	// May use structs instead of this string manipulation
-	configTarBuffer, err := prepareTar(string(yamlBytes)+configUpdates, "config.yml")
+	backend, err := GetBackend(config.Registry.Backend)
 	if err != nil {
-		return fmt.Errorf("❌ failed copy to tar file into container: %w", err)
+		return err
 	}
-	// Write config back to	container
-	err = dockerClient.CopyToContainer(
-		ctx,
-		containerID,
-		"/etc/docker/registry/",
-		configTarBuffer,
-		container.CopyToContainerOptions{},
-	)
+	authFiles, err := backend.SetupAuth(localRegistry.Username, localRegistry.Password)
 	if err != nil {
-		return fmt.Errorf("❌ copy to container: %w", err)
+		return err
 	}
-
-	return nil
-}
-
-func RotateCreds(
-	dockerClient *client.Client,
-	ctx context.Context,
-	username, password, containerName string,
-) error {
-	credsTarBuffer := prepareCreds(username, password)
-	// lookup container id from it's name
-	containers, err := dockerClient.ContainerList(ctx,
-		container.ListOptions{
-			Filters: filters.NewArgs(
-				filters.Arg("name", containerName),
-			),
-		})
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	if _, err := dockerClient.ContainerInspect(ctx, localRegistry.RegistryID); err != nil {
+		return fmt.Errorf("❌ failed to find registry container %s: %w", localRegistry.RegistryID, err)
 	}
-	fmt.Println(containers[0].ID)
 
 	// Write password file to container
-	err = dockerClient.CopyToContainer(
-		ctx,
-		containers[0].ID,
-		"/",
-		credsTarBuffer,
-		container.CopyToContainerOptions{},
-	)
-	if err != nil {
-		return fmt.Errorf("❌ failed to copy to container: %w", err)
+	if err := copyFilesToContainer(dockerClient, ctx, localRegistry.RegistryID, authFiles); err != nil {
+		return err
 	}
-
-	if err := dockerClient.ContainerRestart(ctx, containers[0].ID, container.StopOptions{}); err != nil {
+	if err := dockerClient.ContainerRestart(ctx, localRegistry.RegistryID, container.StopOptions{}); err != nil {
 		return fmt.Errorf("❌ failed to restart container: %w", err)
 	}
-
-	return nil
+	return waitForHealthy(ctx, config, backend.HealthEndpoint(), localRegistry.Username, localRegistry.Password)
 }
 
-func prepareCreds(username, password string) *bytes.Buffer {
-	// Prepare credentials
-	// Password configuration for registry should be hashed using bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// copyFilesToContainer writes the files to the container, missing parent directories are created by Docker
+func copyFilesToContainer(dockerClient *client.Client, ctx context.Context, containerID string, files []ConfigFile) error {
+	filesTarBuffer, err := prepareTar(files)
 	if err != nil {
-		log.Fatalf("❌ failed to hash password: %v", err)
+		return fmt.Errorf("❌ failed to prepare tar file: %w", err)
 	}
-	credsTarBuffer, err := prepareTar(
-		fmt.Sprintf("%s:%s\n", username, hashedPassword),
-		"htpasswd",
+	err = dockerClient.CopyToContainer(
+		ctx,
+		containerID,
+		"/",
+		filesTarBuffer,
+		container.CopyToContainerOptions{},
 	)
 	if err != nil {
-		log.Fatalf("❌ failed to prepare tar file: %v", err)
+		return fmt.Errorf("❌ failed to copy to container: %w", err)
 	}
-	return credsTarBuffer
+	return nil
 }
 
-// prepareTar creates a tar archive with the htpasswd file data inside it stored in same way as htpasswd -Bnb command does
-func prepareTar(fileContent, fileName string) (*bytes.Buffer, error) {
+// prepareTar creates a tar archive with the files stored relative to the container root
+func prepareTar(files []ConfigFile) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
 	// Create a tar writer
 	tw := tar.NewWriter(&buf)
 
-	// Add a file to the tar archive
-	hdr := &tar.Header{
-		Name: fileName,
-		Mode: 0600,
-		Size: int64(len(fileContent)),
-	}
-	if err := tw.WriteHeader(hdr); err != nil {
-		return nil, fmt.Errorf("❌ failed to write tar header: %w", err)
-	}
-	if _, err := tw.Write([]byte(fileContent)); err != nil {
-		return nil, fmt.Errorf("❌ failed to write file content to tar: %w", err)
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name: strings.TrimPrefix(file.Path, "/"),
+			Mode: 0644,
+			Size: int64(len(file.Content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("❌ failed to write tar header: %w", err)
+		}
+		if _, err := tw.Write(file.Content); err != nil {
+			return nil, fmt.Errorf("❌ failed to write file content to tar: %w", err)
+		}
 	}
 	if err := tw.Close(); err != nil {
 		return nil, fmt.Errorf("❌ failed to close tar writer: %w", err)
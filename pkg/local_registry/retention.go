@@ -0,0 +1,160 @@
+package local_registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// taggedImage is a tag of a repository with the image it points to
+type taggedImage struct {
+	Tag     string
+	Digest  string
+	Created time.Time
+}
+
+// ApplyRetention deletes tags of every repository that are not kept by `registry.retention`. The configured image
+// and the image deployed to the cloud are always kept. Images are deleted by digest, so an image is deleted
+// only if none of its tags is kept. References of the deleted tags are returned
+func ApplyRetention(ctx context.Context, registryClient *Client, config *parser.Config, profile *parser.Profile) ([]string, error) {
+	retention := config.Registry.Retention
+	var keepNewerThan time.Duration
+	if retention.KeepNewerThan != "" {
+		var err error
+		if keepNewerThan, err = time.ParseDuration(retention.KeepNewerThan); err != nil || keepNewerThan <= 0 {
+			return nil, fmt.Errorf("❌ registry.retention.keepNewerThan must be a positive duration, got %q", retention.KeepNewerThan)
+		}
+	}
+	if retention.KeepLast < 0 {
+		return nil, fmt.Errorf("❌ registry.retention.keepLast must not be negative, got %d", retention.KeepLast)
+	}
+	protected := map[string]bool{config.GetRegistryImage(): true}
+	if profile != nil && profile.DeployedImage != "" {
+		protected[profile.DeployedImage] = true
+	}
+
+	repositories, err := registryClient.Catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, repository := range repositories {
+		tags, err := registryClient.Tags(ctx, repository)
+		if err != nil {
+			return deleted, err
+		}
+		images := make([]taggedImage, 0, len(tags))
+		for _, tag := range tags {
+			image, err := describeTag(ctx, registryClient, repository, tag)
+			if err != nil {
+				return deleted, err
+			}
+			images = append(images, image)
+		}
+		for digest, tags := range expiredImages(repository, images, retention.KeepLast, keepNewerThan, protected, time.Now()) {
+			if err := registryClient.DeleteManifest(ctx, repository, digest); err != nil {
+				return deleted, err
+			}
+			for _, tag := range tags {
+				deleted = append(deleted, fmt.Sprintf("%s:%s", repository, tag))
+			}
+		}
+	}
+	sort.Strings(deleted)
+	return deleted, nil
+}
+
+// applyRetentionAfterPush applies retention if it is configured, failures don't fail the push
+func applyRetentionAfterPush(config *parser.Config) {
+	if !config.IsRetentionEnabled() {
+		return
+	}
+	registryClient, err := NewLocalClient(config)
+	if err != nil {
+		log.Printf("❌ failed to apply retention: %v", err)
+		return
+	}
+	profile, _ := parser.LoadProfileData()
+	deleted, err := ApplyRetention(context.Background(), registryClient, config, profile)
+	for _, ref := range deleted {
+		log.Printf("🗑️ Deleted %s according to retention", ref)
+	}
+	if err != nil {
+		log.Printf("❌ failed to apply retention: %v", err)
+		return
+	}
+	if len(deleted) != 0 {
+		log.Println("Run `locreg registry gc` to free disk space taken by the deleted images")
+	}
+}
+
+// expiredImages returns digests of images none of whose tags are kept, with their tags
+func expiredImages(
+	repository string,
+	images []taggedImage,
+	keepLast int,
+	keepNewerThan time.Duration,
+	protected map[string]bool,
+	now time.Time,
+) map[string][]string {
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].Created.Equal(images[j].Created) {
+			return images[i].Tag > images[j].Tag
+		}
+		return images[i].Created.After(images[j].Created)
+	})
+	kept := map[string]bool{}
+	expired := map[string][]string{}
+	for i, image := range images {
+		if i < keepLast || (keepNewerThan > 0 && now.Sub(image.Created) < keepNewerThan) ||
+			protected[fmt.Sprintf("%s:%s", repository, image.Tag)] {
+			kept[image.Digest] = true
+			continue
+		}
+		expired[image.Digest] = append(expired[image.Digest], image.Tag)
+	}
+	for digest := range kept {
+		delete(expired, digest)
+	}
+	return expired
+}
+
+// describeTag returns the digest of the tag and the creation time of its image, the time of the first platform
+// is used for multi-platform images. Images without creation time are treated as the oldest
+func describeTag(ctx context.Context, registryClient *Client, repository, tag string) (taggedImage, error) {
+	content, mediaType, err := registryClient.GetManifest(ctx, repository, tag)
+	if err != nil {
+		return taggedImage{}, err
+	}
+	image := taggedImage{Tag: tag, Digest: digest.FromBytes(content).String()}
+	if isIndex(mediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(content, &index); err != nil || len(index.Manifests) == 0 {
+			return image, nil
+		}
+		if content, _, err = registryClient.GetManifest(ctx, repository, index.Manifests[0].Digest.String()); err != nil {
+			return taggedImage{}, err
+		}
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.Config.Digest == "" {
+		return image, nil
+	}
+	blob, _, err := registryClient.GetBlob(ctx, repository, manifest.Config.Digest.String())
+	if err != nil {
+		return taggedImage{}, err
+	}
+	defer blob.Close()
+	var imageConfig ocispec.Image
+	if err := json.NewDecoder(blob).Decode(&imageConfig); err == nil && imageConfig.Created != nil {
+		image.Created = *imageConfig.Created
+	}
+	return image, nil
+}
@@ -0,0 +1,66 @@
+package local_registry
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestExpiredImages(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	images := []taggedImage{
+		{Tag: "a", Digest: "sha256:a", Created: now.Add(-1 * time.Hour)},
+		{Tag: "b", Digest: "sha256:b", Created: now.Add(-48 * time.Hour)},
+		{Tag: "c", Digest: "sha256:c", Created: now.Add(-72 * time.Hour)},
+		{Tag: "c-alias", Digest: "sha256:c", Created: now.Add(-72 * time.Hour)},
+		{Tag: "deployed", Digest: "sha256:d", Created: now.Add(-96 * time.Hour)},
+		{Tag: "shared", Digest: "sha256:a", Created: now.Add(-1 * time.Hour)},
+		{Tag: "unknown", Digest: "sha256:u"},
+	}
+	protected := map[string]bool{"app:deployed": true}
+
+	for _, tc := range []struct {
+		name          string
+		keepLast      int
+		keepNewerThan time.Duration
+		expected      string
+	}{
+		{"keep last", 2, 0, "sha256:b=b sha256:c=c,c-alias sha256:u=unknown"},
+		{"keep newer than", 0, 50 * time.Hour, "sha256:c=c,c-alias sha256:u=unknown"},
+		{"both", 3, 2 * time.Hour, "sha256:c=c,c-alias sha256:u=unknown"},
+	} {
+		expired := expiredImages("app", append([]taggedImage(nil), images...), tc.keepLast, tc.keepNewerThan, protected, now)
+		var actual []string
+		for digest, tags := range expired {
+			sort.Strings(tags)
+			actual = append(actual, digest+"="+strings.Join(tags, ","))
+		}
+		sort.Strings(actual)
+		if strings.Join(actual, " ") != tc.expected {
+			t.Errorf("❌ %s: expected %s, got %s", tc.name, tc.expected, strings.Join(actual, " "))
+		}
+	}
+}
+
+func TestRenderReadOnlyConfig(t *testing.T) {
+	config := &parser.Config{}
+	config.Registry.Retention.KeepLast = 5
+	distributionConfig, err := NewDistributionConfig(config)
+	if err != nil {
+		t.Fatalf("❌ failed to build registry config: %v", err)
+	}
+	if distributionConfig.Storage.Delete == nil || !distributionConfig.Storage.Delete.Enabled {
+		t.Error("❌ deletes must be enabled when retention is set")
+	}
+
+	file, err := distributionBackend{}.RenderReadOnlyConfig(config)
+	if err != nil {
+		t.Fatalf("❌ failed to render read-only config: %v", err)
+	}
+	if file.Path != distributionConfigPath || !strings.Contains(string(file.Content), "readonly:\n            enabled: true") {
+		t.Errorf("❌ read-only mode is not rendered:\n%s", file.Content)
+	}
+}
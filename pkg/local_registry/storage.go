@@ -0,0 +1,56 @@
+package local_registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// storageMounts returns the mount keeping registry data outside the container, so it survives `locreg destroy registry`.
+// Bind mount of `registry.storage.path` takes precedence over the named volume
+func storageMounts(config *parser.Config, backend RegistryBackend) ([]mount.Mount, error) {
+	storage := config.Registry.Storage
+	if storage.Volume == "" && storage.Path == "" {
+		return nil, nil
+	}
+	driver := config.Registry.Config.Storage.Driver
+	if driver != "" && driver != "filesystem" {
+		return nil, fmt.Errorf("❌ registry.storage can be used only with filesystem storage driver, got %s", driver)
+	}
+
+	target := backend.DataDirectory(config)
+	if storage.Path != "" {
+		path, err := filepath.Abs(storage.Path)
+		if err != nil {
+			return nil, fmt.Errorf("❌ failed to resolve registry storage path: %w", err)
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("❌ failed to create registry storage directory: %w", err)
+		}
+		return []mount.Mount{{Type: mount.TypeBind, Source: path, Target: target}}, nil
+	}
+	return []mount.Mount{{Type: mount.TypeVolume, Source: storage.Volume, Target: target}}, nil
+}
+
+// purgeStorage removes the registry data recorded in the profile
+func purgeStorage(dockerClient *client.Client, ctx context.Context, localRegistry *parser.LocalRegistry) error {
+	if localRegistry.Volume != "" {
+		if err := dockerClient.VolumeRemove(ctx, localRegistry.Volume, true); err != nil {
+			return fmt.Errorf("❌ failed to remove registry volume %s: %w", localRegistry.Volume, err)
+		}
+		fmt.Printf("✅ Registry volume %s removed\n", localRegistry.Volume)
+	}
+	if localRegistry.DataPath != "" {
+		// Files are created by the registry process in the container, so they may be owned by root
+		if err := os.RemoveAll(localRegistry.DataPath); err != nil {
+			return fmt.Errorf("❌ failed to remove registry data in %s, you will need to do this manually: %w", localRegistry.DataPath, err)
+		}
+		fmt.Printf("✅ Registry data in %s removed\n", localRegistry.DataPath)
+	}
+	return nil
+}
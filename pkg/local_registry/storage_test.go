@@ -0,0 +1,58 @@
+package local_registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestStorageMounts(t *testing.T) {
+	backend, _ := GetBackend("distribution")
+	config := &parser.Config{}
+	if mounts, err := storageMounts(config, backend); err != nil || mounts != nil {
+		t.Errorf("❌ expected no mounts without registry.storage, got %v, %v", mounts, err)
+	}
+
+	config.Registry.Storage.Volume = "locreg-registry-data"
+	mounts, err := storageMounts(config, backend)
+	if err != nil {
+		t.Fatalf("❌ failed to get mounts: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0].Type != mount.TypeVolume || mounts[0].Target != distributionRootDirectory {
+		t.Errorf("❌ unexpected volume mount: %v", mounts)
+	}
+
+	config.Registry.Storage.Path = filepath.Join(t.TempDir(), "registry")
+	mounts, err = storageMounts(config, backend)
+	if err != nil {
+		t.Fatalf("❌ failed to get mounts: %v", err)
+	}
+	if len(mounts) != 1 || mounts[0].Type != mount.TypeBind || mounts[0].Source != config.Registry.Storage.Path {
+		t.Errorf("❌ storage path doesn't take precedence over volume: %v", mounts)
+	}
+	if _, err := os.Stat(config.Registry.Storage.Path); err != nil {
+		t.Errorf("❌ storage directory is not created: %v", err)
+	}
+
+	config.Registry.Config.Storage.Driver = "s3"
+	if _, err := storageMounts(config, backend); err == nil {
+		t.Error("❌ storage is mounted for s3 driver")
+	}
+}
+
+func TestRegistryStorageDefaults(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "locreg.yaml")
+	if err := os.WriteFile(configPath, []byte("registry:\n  storage:\n"), 0644); err != nil {
+		t.Fatalf("❌ failed to write config: %v", err)
+	}
+	config, err := parser.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("❌ failed to load config: %v", err)
+	}
+	if config.Registry.Storage.Volume != "locreg-registry-data" {
+		t.Errorf("❌ expected default storage volume, got %q", config.Registry.Storage.Volume)
+	}
+}
@@ -0,0 +1,322 @@
+package local_registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// PullUsername is the username of pull-only credentials issued to cloud runtimes
+	PullUsername = "locreg-pull"
+	// pullAudience is the audience of pull-only credentials, so they can't be used as registry tokens
+	pullAudience = "locreg-pull"
+	// certificateLifetime is the validity of the self-signed certificate used to verify tokens
+	certificateLifetime = 10 * 365 * 24 * time.Hour
+)
+
+// Access is a set of actions granted on a resource of the registry, see
+// https://distribution.github.io/distribution/spec/auth/jwt/
+type Access struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// ParseScope parses a scope requested from the token server in `type:name:actions` format
+func ParseScope(scope string) (Access, error) {
+	typeEnd := strings.Index(scope, ":")
+	actionsStart := strings.LastIndex(scope, ":")
+	if typeEnd == -1 || typeEnd == actionsStart {
+		return Access{}, fmt.Errorf("❌ invalid scope %q", scope)
+	}
+	return Access{
+		Type:    scope[:typeEnd],
+		Name:    scope[typeEnd+1 : actionsStart],
+		Actions: strings.Split(scope[actionsStart+1:], ","),
+	}, nil
+}
+
+// TokenIssuer signs tokens accepted by the registry configured with `auth.token`
+type TokenIssuer struct {
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+	issuer      string
+	service     string
+}
+
+// LoadTokenIssuer loads the signing key from the locreg directory, the key is created on the first use,
+// so tokens issued before the registry is recreated remain valid
+func LoadTokenIssuer(config *parser.Config) (*TokenIssuer, error) {
+	dir, err := daemon.Dir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "token")
+	keyPath, certPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")
+
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	certPEM, certErr := os.ReadFile(certPath)
+	if errors.Is(keyErr, os.ErrNotExist) || errors.Is(certErr, os.ErrNotExist) {
+		keyPEM, certPEM, err = generateSigningKey(config.Registry.Auth.Token.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("❌ failed to create token directory: %w", err)
+		}
+		if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, fmt.Errorf("❌ failed to write token signing key: %w", err)
+		}
+		if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+			return nil, fmt.Errorf("❌ failed to write token certificate: %w", err)
+		}
+	} else if keyErr != nil || certErr != nil {
+		return nil, fmt.Errorf("❌ failed to read token signing key: %w", errors.Join(keyErr, certErr))
+	}
+	return NewTokenIssuer(keyPEM, certPEM, config.Registry.Auth.Token.Issuer, config.Registry.Auth.Token.Service)
+}
+
+// NewTokenIssuer creates a token issuer from PEM encoded EC private key and its certificate
+func NewTokenIssuer(keyPEM, certPEM []byte, issuer, service string) (*TokenIssuer, error) {
+	keyBlock, _ := pem.Decode(keyPEM)
+	certBlock, _ := pem.Decode(certPEM)
+	if keyBlock == nil || certBlock == nil {
+		return nil, fmt.Errorf("❌ token signing key or certificate is not PEM encoded")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to parse token signing key: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to parse token certificate: %w", err)
+	}
+	return &TokenIssuer{key: key, certificate: certificate, issuer: issuer, service: service}, nil
+}
+
+// CertificatePEM returns the certificate the registry uses to verify tokens
+func (issuer *TokenIssuer) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.certificate.Raw})
+}
+
+// Issue returns a registry token granting access to the subject
+func (issuer *TokenIssuer) Issue(subject string, access []Access, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if access == nil {
+		access = []Access{}
+	}
+	// Audience is a single string as older registry versions don't accept an array
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":    issuer.issuer,
+		"sub":    subject,
+		"aud":    issuer.service,
+		"exp":    now.Add(ttl).Unix(),
+		"nbf":    now.Add(-time.Minute).Unix(),
+		"iat":    now.Unix(),
+		"jti":    randomID(),
+		"access": access,
+	})
+	// Registry verifies the signing key with the certificate chain in x5c header against its root certificate bundle
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(issuer.certificate.Raw)}
+	signed, err := token.SignedString(issuer.key)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// IssuePullCredential returns a password of PullUsername that can only pull the repositories until it expires
+// or the generation recorded in the profile is incremented by rotation
+func (issuer *TokenIssuer) IssuePullCredential(repositories []string, generation int, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":          issuer.issuer,
+		"sub":          PullUsername,
+		"aud":          pullAudience,
+		"exp":          now.Add(ttl).Unix(),
+		"iat":          now.Unix(),
+		"jti":          randomID(),
+		"repositories": repositories,
+		"generation":   generation,
+	})
+	signed, err := token.SignedString(issuer.key)
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to sign pull credential: %w", err)
+	}
+	return signed, nil
+}
+
+// VerifyPullCredential returns the repositories that can be pulled with the credential,
+// credentials issued before the generation are rejected as revoked
+func (issuer *TokenIssuer) VerifyPullCredential(credential string, generation int) ([]string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(credential, claims, func(*jwt.Token) (any, error) {
+		return &issuer.key.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithAudience(pullAudience),
+		jwt.WithIssuer(issuer.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("❌ invalid pull credential: %w", err)
+	}
+	// Numbers are decoded as float64, credentials issued before generations were introduced have none
+	if issued, _ := claims["generation"].(float64); int(issued) < generation {
+		return nil, fmt.Errorf("❌ pull credential is revoked by rotation")
+	}
+	values, _ := claims["repositories"].([]any)
+	repositories := make([]string, 0, len(values))
+	for _, value := range values {
+		if repository, ok := value.(string); ok {
+			repositories = append(repositories, repository)
+		}
+	}
+	return repositories, nil
+}
+
+// PushToken returns a token allowing to push the image configured in `image` for `locreg push`
+func PushToken(config *parser.Config) (string, error) {
+	issuer, err := LoadTokenIssuer(config)
+	if err != nil {
+		return "", err
+	}
+	ttl, err := time.ParseDuration(config.Registry.Auth.Token.Expiration)
+	if err != nil {
+		return "", fmt.Errorf("❌ invalid registry.auth.token.expiration: %w", err)
+	}
+	return issuer.Issue("locreg-push", []Access{{
+		Type:    "repository",
+		Name:    config.Image.Name,
+		Actions: []string{"pull", "push"},
+	}}, ttl)
+}
+
+// RuntimeCredentials returns credentials cloud runtimes use to pull the image. With token authentication
+// these are pull-only credentials scoped to the repository of the image, otherwise the registry credentials.
+// Expiration of pull-only credentials is recorded in the profile, so they are renewed before it
+func RuntimeCredentials(config *parser.Config, profile *parser.Profile) (string, string, error) {
+	username, password, expiresAt, err := runtimeCredentials(config, profile)
+	if err != nil || expiresAt.IsZero() {
+		return username, password, err
+	}
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		localRegistry.PullExpiresAt = expiresAt
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("❌ failed to record pull credential expiration: %w", err)
+	}
+	profile.LocalRegistry.PullExpiresAt = expiresAt
+	return username, password, nil
+}
+
+// runtimeCredentials returns the runtime credentials and the expiration of pull-only ones, zero for registry credentials
+func runtimeCredentials(config *parser.Config, profile *parser.Profile) (string, string, time.Time, error) {
+	if profile == nil || profile.LocalRegistry == nil {
+		return "", "", time.Time{}, fmt.Errorf("❌ local registry is not found in profile")
+	}
+	if !config.IsTokenAuthEnabled() {
+		return profile.LocalRegistry.Username, profile.LocalRegistry.Password, time.Time{}, nil
+	}
+	issuer, err := LoadTokenIssuer(config)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	ttl, err := time.ParseDuration(config.Registry.Auth.Token.PullExpiration)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("❌ invalid registry.auth.token.pullExpiration: %w", err)
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	password, err := issuer.IssuePullCredential([]string{config.Image.Name}, profile.LocalRegistry.PullGeneration, ttl)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return PullUsername, password, expiresAt, nil
+}
+
+// PullCredentialsExpiring reports whether the pull-only credential handed to cloud resources has less than
+// a quarter of its lifetime left, or its expiration is unknown. Registry credentials don't expire
+func PullCredentialsExpiring(config *parser.Config, profile *parser.Profile) bool {
+	if !config.IsTokenAuthEnabled() || profile == nil || profile.LocalRegistry == nil || !profile.HasCloudResource() {
+		return false
+	}
+	ttl, err := time.ParseDuration(config.Registry.Auth.Token.PullExpiration)
+	if err != nil {
+		return true
+	}
+	return time.Until(profile.LocalRegistry.PullExpiresAt) < ttl/4
+}
+
+// validateTokenAuth checks `registry.auth.token` before the registry is started
+func validateTokenAuth(config *parser.Config, backend RegistryBackend) error {
+	if _, ok := backend.(TokenAuthBackend); !ok {
+		return fmt.Errorf("❌ token authentication is not supported by %s registry backend", config.Registry.Backend)
+	}
+	tokenConfig := config.Registry.Auth.Token
+	if tokenConfig.Service == "" {
+		return fmt.Errorf("❌ registry.auth.token.service must be set")
+	}
+	for key, value := range map[string]string{"expiration": tokenConfig.Expiration, "pullExpiration": tokenConfig.PullExpiration} {
+		if ttl, err := time.ParseDuration(value); err != nil || ttl <= 0 {
+			return fmt.Errorf("❌ registry.auth.token.%s must be a positive duration, got %q", key, value)
+		}
+	}
+	return nil
+}
+
+// generateSigningKey returns PEM encoded EC P-256 key and a self-signed certificate for it
+func generateSigningKey(commonName string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("❌ failed to generate token signing key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("❌ failed to generate certificate serial number: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certificateLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("❌ failed to create token certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("❌ failed to encode token signing key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), nil
+}
+
+func randomID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,145 @@
+package local_registry
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestIssuer(t *testing.T) *TokenIssuer {
+	keyPEM, certPEM, err := generateSigningKey("locreg")
+	if err != nil {
+		t.Fatalf("❌ failed to generate signing key: %v", err)
+	}
+	issuer, err := NewTokenIssuer(keyPEM, certPEM, "locreg", "locreg-registry")
+	if err != nil {
+		t.Fatalf("❌ failed to create token issuer: %v", err)
+	}
+	return issuer
+}
+
+func TestParseScope(t *testing.T) {
+	access, err := ParseScope("repository:team/app:pull,push")
+	if err != nil {
+		t.Fatalf("❌ failed to parse scope: %v", err)
+	}
+	expected := Access{Type: "repository", Name: "team/app", Actions: []string{"pull", "push"}}
+	if !reflect.DeepEqual(access, expected) {
+		t.Errorf("❌ expected %v, got %v", expected, access)
+	}
+	if _, err := ParseScope("repository"); err == nil {
+		t.Error("❌ invalid scope is parsed")
+	}
+}
+
+func TestIssue(t *testing.T) {
+	issuer := newTestIssuer(t)
+	signed, err := issuer.Issue("user", []Access{{Type: "repository", Name: "app", Actions: []string{"pull"}}}, time.Minute)
+	if err != nil {
+		t.Fatalf("❌ failed to issue token: %v", err)
+	}
+
+	// Verify the token the same way the registry does, with the certificate from x5c header checked against the bundle
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(issuer.CertificatePEM()) {
+		t.Fatal("❌ failed to parse certificate PEM")
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (any, error) {
+		chain, _ := token.Header["x5c"].([]any)
+		if len(chain) != 1 {
+			t.Fatalf("❌ unexpected x5c header: %v", token.Header["x5c"])
+		}
+		der, err := base64.StdEncoding.DecodeString(chain[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			return nil, err
+		}
+		return leaf.PublicKey, nil
+	}, jwt.WithAudience("locreg-registry"), jwt.WithIssuer("locreg"))
+	if err != nil {
+		t.Fatalf("❌ issued token is not valid: %v", err)
+	}
+	if aud, ok := claims["aud"].(string); !ok || aud != "locreg-registry" {
+		t.Errorf("❌ audience must be a single string, got %v", claims["aud"])
+	}
+	access, _ := claims["access"].([]any)
+	if len(access) != 1 {
+		t.Errorf("❌ unexpected access claim: %v", claims["access"])
+	}
+}
+
+func TestPullCredential(t *testing.T) {
+	issuer := newTestIssuer(t)
+	credential, err := issuer.IssuePullCredential([]string{"app"}, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("❌ failed to issue pull credential: %v", err)
+	}
+	repositories, err := issuer.VerifyPullCredential(credential, 0)
+	if err != nil {
+		t.Fatalf("❌ pull credential is not valid: %v", err)
+	}
+	if !reflect.DeepEqual(repositories, []string{"app"}) {
+		t.Errorf("❌ unexpected repositories: %v", repositories)
+	}
+
+	expired, _ := issuer.IssuePullCredential([]string{"app"}, 0, -time.Minute)
+	if _, err := issuer.VerifyPullCredential(expired, 0); err == nil {
+		t.Error("❌ expired pull credential is accepted")
+	}
+	registryToken, _ := issuer.Issue("user", nil, time.Minute)
+	if _, err := issuer.VerifyPullCredential(registryToken, 0); err == nil {
+		t.Error("❌ registry token is accepted as pull credential")
+	}
+	if _, err := newTestIssuer(t).VerifyPullCredential(credential, 0); err == nil {
+		t.Error("❌ pull credential signed by another key is accepted")
+	}
+}
+
+func TestRuntimeCredentialsExpiration(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config := &parser.Config{}
+	config.Image.Name = "app"
+	config.Registry.Auth.Token.Issuer = "locreg"
+	config.Registry.Auth.Token.PullExpiration = "720h"
+	profile, profilePath := parser.LoadProfileData()
+	profile.LocalRegistry = &parser.LocalRegistry{Username: "admin", Password: "secret"}
+	profile.AWSCloudResource = &parser.AWSCloudResource{}
+	if err := parser.SaveProfile(profile, profilePath); err != nil {
+		t.Fatal(err)
+	}
+	if !PullCredentialsExpiring(config, profile) {
+		t.Error("❌ credentials with unknown expiration aren't renewed")
+	}
+
+	if _, _, err := RuntimeCredentials(config, profile); err != nil {
+		t.Fatalf("❌ failed to issue runtime credentials: %v", err)
+	}
+	saved, _ := parser.LoadProfileData()
+	if until := time.Until(saved.LocalRegistry.PullExpiresAt); until < 719*time.Hour || until > 720*time.Hour {
+		t.Errorf("❌ expected expiration in 720h to be recorded, got %s", saved.LocalRegistry.PullExpiresAt)
+	}
+	if PullCredentialsExpiring(config, saved) {
+		t.Error("❌ fresh credentials are renewed")
+	}
+
+	saved.LocalRegistry.PullExpiresAt = time.Now().Add(100 * time.Hour)
+	if !PullCredentialsExpiring(config, saved) {
+		t.Error("❌ credentials expiring in 100h aren't renewed")
+	}
+	saved.AWSCloudResource = nil
+	if PullCredentialsExpiring(config, saved) {
+		t.Error("❌ credentials are renewed while nothing is deployed")
+	}
+}
@@ -0,0 +1,104 @@
+package local_registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// configuredUsers returns users under `registry.users` with hashed passwords,
+// passwords that are not set are generated and printed as they can't be recovered from the profile
+func configuredUsers(config *parser.Config) ([]parser.RegistryUser, error) {
+	var users []parser.RegistryUser
+	for _, configured := range config.Registry.Users {
+		if err := validateUsername(config.Registry.Username, users, configured.Username); err != nil {
+			return nil, err
+		}
+		password := configured.Password
+		if password == "" {
+			password = parser.GenerateRandomString(18)
+			fmt.Printf("🔑 Password of registry user %s: %s\n", configured.Username, password)
+		}
+		user, err := newRegistryUser(configured.Username, password, configured.ReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// AddUser adds the user to the registry recorded in the profile, the gateway picks it up on the next request.
+// Password is generated if empty, the password of the user is returned
+func AddUser(username, password string, readOnly bool) (string, error) {
+	if password == "" {
+		password = parser.GenerateRandomString(18)
+	}
+	user, err := newRegistryUser(username, password, readOnly)
+	if err != nil {
+		return "", err
+	}
+	err = updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		if localRegistry.GatewayPID == 0 {
+			return fmt.Errorf("❌ registry gateway is not running, set registry.users in the config and recreate the registry")
+		}
+		if err := validateUsername(localRegistry.Username, localRegistry.Users, username); err != nil {
+			return err
+		}
+		localRegistry.Users = append(localRegistry.Users, user)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// RemoveUser removes the user from the registry recorded in the profile
+func RemoveUser(username string) error {
+	return updateProfileRegistry(func(localRegistry *parser.LocalRegistry) error {
+		users := localRegistry.Users
+		for i, user := range users {
+			if user.Username == username {
+				localRegistry.Users = append(users[:i:i], users[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("❌ user %q is not found", username)
+	})
+}
+
+// ListUsers returns users of the registry recorded in the profile
+func ListUsers() ([]parser.RegistryUser, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return nil, fmt.Errorf("❌ local registry is not found in profile")
+	}
+	return profile.LocalRegistry.Users, nil
+}
+
+// validateUsername checks that the username can be used in basic auth and doesn't clash with other accounts
+func validateUsername(registryUsername string, users []parser.RegistryUser, username string) error {
+	if username == "" || strings.ContainsAny(username, ": \t") {
+		return fmt.Errorf("❌ invalid username %q, it must be non-empty and must not contain colons or spaces", username)
+	}
+	if username == registryUsername || username == PullUsername {
+		return fmt.Errorf("❌ username %q is reserved", username)
+	}
+	for _, user := range users {
+		if user.Username == username {
+			return fmt.Errorf("❌ user %q already exists", username)
+		}
+	}
+	return nil
+}
+
+func newRegistryUser(username, password string, readOnly bool) (parser.RegistryUser, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return parser.RegistryUser{}, fmt.Errorf("❌ failed to hash password: %w", err)
+	}
+	return parser.RegistryUser{Username: username, PasswordHash: string(hash), ReadOnly: readOnly}, nil
+}
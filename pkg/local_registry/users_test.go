@@ -0,0 +1,47 @@
+package local_registry
+
+import (
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestAddAndRemoveUser(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	profile, profilePath := parser.LoadProfileData()
+	profile.LocalRegistry = &parser.LocalRegistry{Username: "admin", Password: "secret"}
+	if err := parser.SaveProfile(profile, profilePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddUser("ci", "", false); err == nil {
+		t.Error("❌ user is added without running gateway")
+	}
+	profile.LocalRegistry.GatewayPID = 1
+	if err := parser.SaveProfile(profile, profilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := AddUser("ci", "", true)
+	if err != nil || password == "" {
+		t.Fatalf("❌ failed to add user: %v", err)
+	}
+	for _, username := range []string{"ci", "admin", PullUsername, "with:colon", ""} {
+		if _, err := AddUser(username, "password", false); err == nil {
+			t.Errorf("❌ user %q is added", username)
+		}
+	}
+	users, err := ListUsers()
+	if err != nil || len(users) != 1 || users[0].Username != "ci" || !users[0].ReadOnly || users[0].PasswordHash == password {
+		t.Fatalf("❌ unexpected users %+v: %v", users, err)
+	}
+
+	if err := RemoveUser("ci"); err != nil {
+		t.Fatalf("❌ failed to remove user: %v", err)
+	}
+	if err := RemoveUser("ci"); err == nil {
+		t.Error("❌ removing unknown user succeeded")
+	}
+	if users, _ := ListUsers(); len(users) != 0 {
+		t.Errorf("❌ user is not removed: %+v", users)
+	}
+}
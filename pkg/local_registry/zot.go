@@ -0,0 +1,137 @@
+package local_registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+const (
+	zotPort                = 5000
+	zotHtpasswdPath        = "/etc/zot/htpasswd"
+	zotRootDirectory       = "/var/lib/registry"
+	zotSyncCredentialsPath = "/etc/zot/sync-credentials.json"
+)
+
+// zotBackend runs zot, an OCI-native registry with built-in garbage collection, search
+// and support of OCI artifacts like SBOMs and signatures
+type zotBackend struct{}
+
+func (zotBackend) Image(config *parser.Config) string {
+	return imageRef(config, "ghcr.io/project-zot/zot", "v2.1.1")
+}
+
+func (zotBackend) Port() int {
+	return zotPort
+}
+
+// RenderConfig renders zot configuration, only log level, filesystem storage and proxy from `registry.config`
+// are supported. Proxy is rendered as on-demand sync, so images missing locally are fetched from the upstream
+// while pushes are still accepted
+func (zotBackend) RenderConfig(config *parser.Config) ([]ConfigFile, error) {
+	registryConfig := config.Registry.Config
+	if err := validateOneOf("registry.config.log.level", registryConfig.Log.Level, distributionLogLevels); err != nil {
+		return nil, err
+	}
+	if registryConfig.Storage.Driver != "" && registryConfig.Storage.Driver != "filesystem" {
+		return nil, fmt.Errorf("❌ zot backend supports only filesystem storage driver")
+	}
+	if len(registryConfig.Notifications.Endpoints) != 0 {
+		return nil, fmt.Errorf("❌ registry.config notifications are supported only by distribution backend")
+	}
+	if err := validateProxy(config); err != nil {
+		return nil, err
+	}
+
+	zotConfig := map[string]any{
+		"distSpecVersion": "1.1.0",
+		"storage": map[string]any{
+			"rootDirectory": zotRootDirectory,
+			"gc":            true,
+			"dedupe":        true,
+		},
+		"http": map[string]any{
+			"address": "0.0.0.0",
+			"port":    strconv.Itoa(zotPort),
+			"auth": map[string]any{
+				"htpasswd": map[string]any{
+					"path": zotHtpasswdPath,
+				},
+			},
+		},
+		"log": map[string]any{
+			"level": valueOrDefault(registryConfig.Log.Level, "info"),
+		},
+	}
+	extensions := map[string]any{
+		"search": map[string]any{
+			"enable": true,
+		},
+	}
+	var files []ConfigFile
+	if proxy := registryConfig.Proxy; proxy.RemoteURL != "" {
+		sync := map[string]any{
+			"enable": true,
+			"registries": []map[string]any{{
+				"urls":      []string{proxy.RemoteURL},
+				"onDemand":  true,
+				"tlsVerify": true,
+				"content":   []map[string]any{{"prefix": "**"}},
+			}},
+		}
+		if proxy.Username != "" {
+			credentials, err := zotSyncCredentials(proxy.RemoteURL, proxy.Username, proxy.Password)
+			if err != nil {
+				return nil, err
+			}
+			sync["credentialsFile"] = credentials.Path
+			files = append(files, credentials)
+		}
+		extensions["sync"] = sync
+	}
+	zotConfig["extensions"] = extensions
+
+	content, err := json.MarshalIndent(zotConfig, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to render zot config: %w", err)
+	}
+	return append([]ConfigFile{{
+		Path:    "/etc/zot/config.json",
+		Content: content,
+	}}, files...), nil
+}
+
+// zotSyncCredentials returns the credentials file of sync extension, credentials are keyed by the upstream host
+func zotSyncCredentials(remoteURL, username, password string) (ConfigFile, error) {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("❌ registry.config.proxy.remoteurl is not a valid URL: %w", err)
+	}
+	content, err := json.MarshalIndent(map[string]any{
+		parsed.Host: map[string]string{"username": username, "password": password},
+	}, "", "  ")
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("❌ failed to render zot sync credentials: %w", err)
+	}
+	return ConfigFile{Path: zotSyncCredentialsPath, Content: content}, nil
+}
+
+func (zotBackend) SetupAuth(username, password string) ([]ConfigFile, error) {
+	file, err := htpasswd(zotHtpasswdPath, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return []ConfigFile{file}, nil
+}
+
+func (zotBackend) DataDirectory(_ *parser.Config) string {
+	return zotRootDirectory
+}
+
+// HealthEndpoint returns the liveness probe of zot, it is served without authentication
+func (zotBackend) HealthEndpoint() string {
+	return "/livez"
+}
@@ -12,18 +12,90 @@ import (
 	"github.com/spf13/viper"
 )
 
+// defaultTunnelNetworkName is used when the selected tunnel provider doesn't run in a container
+const defaultTunnelNetworkName = "locreg-ngrok"
+
 type Config struct {
 	Registry struct {
 		Port     int    `mapstructure:"port" default:"5000"`
-		Tag      string `mapstructure:"tag" default:"2"`
+		Backend  string `mapstructure:"backend" default:"distribution"` // distribution, zot or embedded
+		Tag      string `mapstructure:"tag"`                            // Defaults to the tag pinned by the backend
 		Name     string `mapstructure:"name" default:"locreg-registry"`
-		Image    string `mapstructure:"image" default:"registry"`
+		Image    string `mapstructure:"image"`    // Defaults to the image of the backend
 		Username string `mapstructure:"username"` // Set separately as should be unique each time
 		Password string `mapstructure:"password"` // Set separately as should be unique each time
+		Storage  struct {
+			Volume string `mapstructure:"volume" default:"locreg-registry-data"` // Named volume kept on destroy
+			Path   string `mapstructure:"path"`                                  // Host directory bind mounted instead of the volume
+		} `mapstructure:"storage"` // Registry data is removed with the container if not set
+		Auth struct {
+			Token struct {
+				Issuer         string `mapstructure:"issuer" default:"locreg"`
+				Service        string `mapstructure:"service" default:"locreg-registry"`
+				Expiration     string `mapstructure:"expiration" default:"5m"`       // Lifetime of tokens issued to registry clients
+				PullExpiration string `mapstructure:"pullExpiration" default:"720h"` // Lifetime of pull-only credentials issued to cloud runtimes
+			} `mapstructure:"token"`
+		} `mapstructure:"auth"` // htpasswd auth with the registry username and password is used if token is not set
+		Users []struct {
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password"` // Generated and printed when the registry is created if not set
+			ReadOnly bool   `mapstructure:"readOnly"` // Allows only pulling images
+		} `mapstructure:"users"` // Additional accounts, they are checked by the gateway run in front of the registry
+		Mirror struct {
+			Port int `mapstructure:"port"` // Port on 127.0.0.1 Docker daemon pulls through without credentials
+		} `mapstructure:"mirror"` // Requires registry.config.proxy, served by the gateway
+		Retention struct {
+			KeepLast      int    `mapstructure:"keepLast"`      // Number of the most recently created tags kept in every repository
+			KeepNewerThan string `mapstructure:"keepNewerThan"` // Duration like 168h, tags of images created within it are kept
+		} `mapstructure:"retention"` // Other tags are deleted after every push if set
+		Notifications struct {
+			Redeploy bool `mapstructure:"redeploy"`            // Redeploys the active cloud resource when the configured image is pushed
+			Port     int  `mapstructure:"port" default:"5010"` // Port of the listener receiving push events from the registry
+		} `mapstructure:"notifications"`
+		Config struct {
+			Log struct {
+				Level     string `mapstructure:"level"`     // error, warn, info or debug, defaults to info
+				Formatter string `mapstructure:"formatter"` // text, json or logstash
+			} `mapstructure:"log"`
+			Storage struct {
+				Driver     string            `mapstructure:"driver"`     // filesystem, inmemory, s3, azure or gcs, defaults to filesystem
+				Parameters map[string]string `mapstructure:"parameters"` // Parameters of the storage driver
+				Delete     bool              `mapstructure:"delete"`     // Allows deleting images by digest
+			} `mapstructure:"storage"`
+			HTTP struct {
+				Headers map[string][]string `mapstructure:"headers"` // Headers added to every response
+			} `mapstructure:"http"`
+			Notifications struct {
+				Endpoints []struct {
+					Name      string              `mapstructure:"name"`
+					URL       string              `mapstructure:"url"`
+					Headers   map[string][]string `mapstructure:"headers"`
+					Timeout   string              `mapstructure:"timeout"` // Duration like 1s
+					Threshold int                 `mapstructure:"threshold"`
+					Backoff   string              `mapstructure:"backoff"` // Duration like 1s
+				} `mapstructure:"endpoints"`
+			} `mapstructure:"notifications"`
+			Proxy struct {
+				RemoteURL string `mapstructure:"remoteurl"` // Upstream registry to mirror
+				Username  string `mapstructure:"username"`
+				Password  string `mapstructure:"password"`
+			} `mapstructure:"proxy"`
+		} `mapstructure:"config"` // Configuration of the registry, see https://distribution.github.io/distribution/about/configuration/
 	} `mapstructure:"registry"`
 	Image struct {
 		Name string `mapstructure:"name" default:"locreg-built-image"`
 		Tag  string `mapstructure:"tag"` // Set a git SHA if not peresent default to latest
+		// Build args and labels are lists in KEY=value format, as map keys in the config are lowercased
+		Build struct {
+			Dockerfile string   `mapstructure:"dockerfile"` // Path relative to the context, defaults to Dockerfile
+			Context    string   `mapstructure:"context"`    // Directory the image is built from if it isn't passed to locreg push
+			Target     string   `mapstructure:"target"`     // Stage of a multi-stage Dockerfile
+			Args       []string `mapstructure:"args"`       // KEY=value, or KEY to take the value from the environment
+			Labels     []string `mapstructure:"labels"`     // key=value
+			Platform   string   `mapstructure:"platform"`   // Platform like linux/amd64, defaults to the platform of the Docker daemon
+			NoCache    bool     `mapstructure:"noCache"`
+			Pull       bool     `mapstructure:"pull"` // Always pull base images
+		} `mapstructure:"build"`
 	} `mapstructure:"image"`
 	Tunnel struct {
 		Provider struct {
@@ -33,7 +105,51 @@ type Config struct {
 				Tag         string `mapstructure:"tag" default:"latest"`
 				Port        int    `mapstructure:"port" default:"4040"`
 				NetworkName string `mapstructure:"networkName" default:"locreg-ngrok"`
+				Mode        string `mapstructure:"mode" default:"container"` // container or sdk to run ngrok-go in a background locreg process
+				Domain      string `mapstructure:"domain"`                   // Reserved domain, random domain is used if not set
+				Region      string `mapstructure:"region"`                   // Region of ngrok edge, the closest one is used if not set
+				Policy      struct {
+					AllowCIDR []string `mapstructure:"allowCidr"`
+					DenyCIDR  []string `mapstructure:"denyCidr"`
+				} `mapstructure:"policy"`
 			} `mapstructure:"ngrok"`
+			Cloudflared struct {
+				Name        string `mapstructure:"name" default:"locreg-cloudflared"`
+				Image       string `mapstructure:"image" default:"cloudflare/cloudflared"`
+				Tag         string `mapstructure:"tag" default:"latest"`
+				NetworkName string `mapstructure:"networkName" default:"locreg-ngrok"`
+				Token       string `mapstructure:"token"`    // Named tunnel token, TUNNEL_TOKEN env variable is used if not set
+				Hostname    string `mapstructure:"hostname"` // Public hostname routed to the named tunnel
+			} `mapstructure:"cloudflared"`
+			MicrosoftDevTunnels struct {
+				Name        string `mapstructure:"name" default:"locreg-devtunnel"`
+				Image       string `mapstructure:"image" default:"mcr.microsoft.com/devcontainers/base"`
+				Tag         string `mapstructure:"tag" default:"ubuntu-22.04"`
+				NetworkName string `mapstructure:"networkName" default:"locreg-ngrok"`
+				LoginVolume string `mapstructure:"loginVolume" default:"locreg-devtunnels"` // Keeps devtunnel login between runs
+				CLIURL      string `mapstructure:"cliUrl"`                                  // Download URL of the Linux x64 devtunnel CLI release
+				CLISHA256   string `mapstructure:"cliSha256"`                               // SHA-256 of the CLI, it is verified on every start
+			} `mapstructure:"microsoftDevTunnels"`
+			SSH struct {
+				Host                  string `mapstructure:"host"`
+				Port                  int    `mapstructure:"port" default:"22"`
+				User                  string `mapstructure:"user"`
+				KeyPath               string `mapstructure:"keyPath" default:"~/.ssh/id_ed25519"`
+				KnownHostsPath        string `mapstructure:"knownHostsPath" default:"~/.ssh/known_hosts"`
+				InsecureIgnoreHostKey bool   `mapstructure:"insecureIgnoreHostKey" default:"false"`
+				RemoteBindAddress     string `mapstructure:"remoteBindAddress" default:"localhost"`
+				RemotePort            int    `mapstructure:"remotePort" default:"5000"`
+				PublicHostname        string `mapstructure:"publicHostname"` // Hostname the remote port is exposed at
+			} `mapstructure:"ssh"`
+			Bore struct {
+				Name        string `mapstructure:"name" default:"locreg-bore"`
+				Image       string `mapstructure:"image" default:"ekzhang/bore"`
+				Tag         string `mapstructure:"tag" default:"latest"`
+				NetworkName string `mapstructure:"networkName" default:"locreg-ngrok"`
+				Server      string `mapstructure:"server"` // Address of the bore server
+				Port        int    `mapstructure:"port"`   // Remote port, allocated by the server if not set
+				Secret      string `mapstructure:"secret"` // Server secret, BORE_SECRET env variable is used if not set
+			} `mapstructure:"bore"`
 		} `mapstructure:"provider"`
 	} `mapstructure:"tunnel"`
 	Deploy struct {
@@ -110,6 +226,8 @@ type Config struct {
 }
 
 func LoadConfig(filePath string) (*Config, error) {
+	// Defaults are set only for providers present in the config, so they must not leak from previously loaded configs
+	viper.Reset()
 	viper.SetConfigFile(filePath)
 	viper.SetConfigType("yaml")
 
@@ -232,6 +350,7 @@ func (config *Config) GetRegistryImage() string {
 	return fmt.Sprintf("%s:%s", config.Image.Name, config.Image.Tag)
 }
 
+// IsNgrokConfigured checks that all ngrok settings with default values are set, optional settings are skipped
 func (config *Config) IsNgrokConfigured() bool {
 	ngrokConfig := config.Tunnel.Provider.Ngrok
 	v := reflect.ValueOf(ngrokConfig)
@@ -239,6 +358,9 @@ func (config *Config) IsNgrokConfigured() bool {
 
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
+		if _, ok := typeOfS.Field(i).Tag.Lookup("default"); !ok {
+			continue
+		}
 		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
 			fmt.Printf("Field %s is not set\n", typeOfS.Field(i).Name)
 			return false
@@ -247,6 +369,61 @@ func (config *Config) IsNgrokConfigured() bool {
 	return true
 }
 
+// TunnelProviderName returns the name of the tunnel provider specified under `tunnel.provider` in the config.
+// Defaults are only set for providers present in the config, so the one with non-zero values is selected
+func (config *Config) TunnelProviderName() (string, error) {
+	v := reflect.ValueOf(config.Tunnel.Provider)
+	typeOfS := v.Type()
+
+	var configured []string
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Field(i).IsZero() {
+			configured = append(configured, typeOfS.Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	switch len(configured) {
+	case 0:
+		return "", fmt.Errorf("❌ no tunnel provider specified under 'tunnel.provider' in the config file")
+	case 1:
+		return configured[0], nil
+	default:
+		return "", fmt.Errorf("❌ only one tunnel provider can be specified, got: %s", strings.Join(configured, ", "))
+	}
+}
+
+// TunnelNetworkName returns the name of the Docker network shared by the registry and the tunnel container
+func (config *Config) TunnelNetworkName() string {
+	v := reflect.ValueOf(config.Tunnel.Provider)
+	for i := 0; i < v.NumField(); i++ {
+		networkName := v.Field(i).FieldByName("NetworkName")
+		if networkName.IsValid() && networkName.String() != "" {
+			return networkName.String()
+		}
+	}
+	return defaultTunnelNetworkName
+}
+
+// IsTokenAuthEnabled checks if token authentication is set under `registry.auth.token` in the config
+func (config *Config) IsTokenAuthEnabled() bool {
+	return config.Registry.Auth.Token.Issuer != ""
+}
+
+// IsRegistryGatewayEnabled checks if the registry is served through the gateway, which is required
+// by token authentication, by additional users under `registry.users` and by `registry.mirror`
+func (config *Config) IsRegistryGatewayEnabled() bool {
+	return config.IsTokenAuthEnabled() || len(config.Registry.Users) > 0 || config.Registry.Mirror.Port != 0
+}
+
+// IsRetentionEnabled checks if old tags are deleted according to `registry.retention`
+func (config *Config) IsRetentionEnabled() bool {
+	return config.Registry.Retention.KeepLast > 0 || config.Registry.Retention.KeepNewerThan != ""
+}
+
+// IsRedeployOnPushEnabled checks if pushes of the configured image redeploy the active cloud resource
+func (config *Config) IsRedeployOnPushEnabled() bool {
+	return config.Registry.Notifications.Redeploy
+}
+
 // IsAppServiceSet checks if the App Service configuration is set in the config.
 // If it is set returns true if not returns false
 func (config *Config) IsAppServiceSet() bool {
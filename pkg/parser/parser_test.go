@@ -70,3 +70,39 @@ func TestDefaultForOnlyOneValue(t *testing.T) {
 		t.Errorf("Password is not retrieved")
 	}
 }
+
+func TestTunnelProviderName(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(getProjectRoot(), "test", "test_configs", "parser", "locreg_with_creds.yaml"))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	name, err := config.TunnelProviderName()
+	if err != nil {
+		t.Fatalf("Tunnel provider is not found: %v", err)
+	}
+	if name != "ngrok" {
+		t.Errorf("Wrong tunnel provider selected: %s", name)
+	}
+}
+
+func TestCloudflaredConfigDefaults(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(getProjectRoot(), "test", "test_configs", "parser", "locreg_cloudflared.yaml"))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	name, err := config.TunnelProviderName()
+	if err != nil {
+		t.Fatalf("Tunnel provider is not found: %v", err)
+	}
+	if name != "cloudflared" {
+		t.Errorf("Wrong tunnel provider selected: %s", name)
+	}
+	if config.Tunnel.Provider.Cloudflared.Image != "cloudflare/cloudflared" {
+		t.Errorf("Wrong cloudflared image: %s", config.Tunnel.Provider.Cloudflared.Image)
+	}
+	if config.TunnelNetworkName() != "locreg-ngrok" {
+		t.Errorf("Wrong tunnel network name: %s", config.TunnelNetworkName())
+	}
+}
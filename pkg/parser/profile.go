@@ -5,19 +5,43 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/pelletier/go-toml"
 )
 
 type LocalRegistry struct {
-	RegistryID string `toml:"registry_id"`
-	Username   string `toml:"username"`
-	Password   string `toml:"password"`
+	RegistryID  string `toml:"registry_id"`
+	Username    string `toml:"username"`
+	Password    string `toml:"password"`
+	Volume      string `toml:"volume,omitempty"`       // Named volume with registry data
+	DataPath    string `toml:"data_path,omitempty"`    // Host directory with registry data
+	Upstream    string `toml:"upstream,omitempty"`     // Address of the registry container served through the gateway
+	GatewayPID  int    `toml:"gateway_pid,omitempty"`  // PID of the locreg process serving token auth in front of the registry
+	EmbeddedPID int    `toml:"embedded_pid,omitempty"` // PID of the locreg process serving the embedded registry
+	ListenerPID int    `toml:"listener_pid,omitempty"` // PID of the locreg process redeploying cloud resources on pushes
+
+	PullExpiresAt  time.Time `toml:"pull_expires_at,omitempty"` // Expiration of the pull-only credential handed to cloud resources
+	PullGeneration int       `toml:"pull_generation,omitempty"` // Incremented by rotation, pull-only credentials of earlier generations are rejected
+
+	Users []RegistryUser `toml:"users,omitempty"` // Additional accounts checked by the gateway
+}
+
+// RegistryUser is an additional account of the local registry, the password is stored as a bcrypt hash
+type RegistryUser struct {
+	Username     string `toml:"username"`
+	PasswordHash string `toml:"password_hash"`
+	ReadOnly     bool   `toml:"read_only,omitempty"`
 }
 
 type Tunnel struct {
+	Provider    string `toml:"provider,omitempty"` // Name of the tunnel provider that created the tunnel
 	URL         string `toml:"tunnel_url"`
 	ContainerID string `toml:"tunnel_container_id"`
+	TunnelID    string `toml:"tunnel_id,omitempty"`    // ID of the tunnel for providers that manage tunnels remotely
+	PID         int    `toml:"tunnel_pid,omitempty"`   // PID of the locreg process supervising the tunnel
+	State       string `toml:"tunnel_state,omitempty"` // State reported by the locreg process supervising the tunnel
 }
 
 type AppService struct {
@@ -61,6 +85,7 @@ type Profile struct {
 	Tunnel             *Tunnel             `toml:"tunnel,omitempty"`
 	AzureCloudResource *AzureCloudResource `toml:"cloud_resource,omitempty"`
 	AWSCloudResource   *AWSCloudResource   `toml:"aws_cloud_resource,omitempty"`
+	DeployedImage      string              `toml:"deployed_image,omitempty"` // Image run by cloud resources, kept by retention
 }
 
 // GetProfilePath returns the path to the profile file in the user's home directory
@@ -91,36 +116,89 @@ func LoadOrCreateProfile(profilePath string) (*Profile, error) {
 	return &profile, nil
 }
 
-// SaveProfile saves the profile to the specified path
+// SaveProfile saves the profile to the specified path. The profile is written to a temporary file renamed over
+// the previous one, so registry and tunnel daemons reading the profile never see a partially written file
 func SaveProfile(profile *Profile, profilePath string) error {
-	file, err := os.OpenFile(profilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	file, err := os.CreateTemp(filepath.Dir(profilePath), filepath.Base(profilePath)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("❌ failed to open profile file: %w", err)
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Printf("❌ failed to close profile file: %v", err)
-		}
-	}(file)
+	defer os.Remove(file.Name())
 
 	if err := toml.NewEncoder(file).Encode(profile); err != nil {
+		file.Close()
+		return fmt.Errorf("❌ failed to write to profile file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("❌ failed to close profile file: %w", err)
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("❌ failed to write to profile file: %w", err)
+	}
+	if err := os.Rename(file.Name(), profilePath); err != nil {
 		return fmt.Errorf("❌ failed to write to profile file: %w", err)
 	}
-
 	return nil
 }
 
-// Save saves the profile to the user's home directory
-// Newer version of SaveProfile function that avoids need of passing profilePath and profile as arguments
-func (profile *Profile) Save() {
+// lockProfile takes an exclusive lock of the profile shared by all locreg processes and returns the function releasing it.
+// The lock is taken on a separate file, as the profile itself is replaced on every save
+func lockProfile(profilePath string) (func(), error) {
+	file, err := os.OpenFile(profilePath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to open profile lock: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("❌ failed to lock profile: %w", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// UpdateProfile loads the profile, applies the update to it and saves it while holding the profile lock,
+// so concurrent updates of locreg commands and daemons don't overwrite each other.
+// The profile isn't saved if the update returns an error
+func UpdateProfile(profilePath string, update func(profile *Profile) error) error {
+	unlock, err := lockProfile(profilePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	profile, err := LoadOrCreateProfile(profilePath)
+	if err != nil {
+		return err
+	}
+	if err := update(profile); err != nil {
+		return err
+	}
+	return SaveProfile(profile, profilePath)
+}
+
+// Update applies the update to the profile in the user's home directory under the profile lock,
+// the same way as UpdateProfile
+func Update(update func(profile *Profile) error) error {
 	profilePath, err := GetProfilePath()
 	if err != nil {
-		log.Fatal("❌ failed to get profile path: %w", err)
+		return err
 	}
-	err = SaveProfile(profile, profilePath)
+	return UpdateProfile(profilePath, update)
+}
+
+// Save records the cloud resources of the profile in the user's home directory.
+// Provider deployments hold the profile for minutes, so the registry and tunnel parts written
+// by other locreg processes in the meantime are kept as they are in the file
+func (profile *Profile) Save() {
+	err := Update(func(saved *Profile) error {
+		saved.AzureCloudResource = profile.AzureCloudResource
+		saved.AWSCloudResource = profile.AWSCloudResource
+		saved.DeployedImage = profile.DeployedImage
+		return nil
+	})
 	if err != nil {
-		log.Fatal("❌ failed to save profile: %w", err)
+		log.Fatalf("❌ failed to save profile: %v", err)
 	}
 }
 
@@ -143,6 +221,11 @@ func LoadProfileData() (*Profile, string) {
 	return profile, profilePath
 }
 
+// HasCloudResource reports whether any cloud provider resources are recorded in the profile
+func (profile *Profile) HasCloudResource() bool {
+	return profile.AzureCloudResource != nil || profile.AWSCloudResource != nil
+}
+
 func (profile *Profile) GetTunnelURL() string {
 	if profile.Tunnel == nil {
 		log.Fatalf("❌ Tunnel does not exist")
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	profilePath := filepath.Join(t.TempDir(), ".locreg")
+	if err := SaveProfile(&Profile{LocalRegistry: &LocalRegistry{Username: "admin"}}, profilePath); err != nil {
+		t.Fatalf("❌ failed to save profile: %v", err)
+	}
+
+	// Users added concurrently by several processes must all be kept
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := UpdateProfile(profilePath, func(profile *Profile) error {
+				profile.LocalRegistry.Users = append(profile.LocalRegistry.Users, RegistryUser{Username: fmt.Sprintf("user%d", i)})
+				return nil
+			})
+			if err != nil {
+				t.Errorf("❌ failed to update profile: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	profile, err := LoadOrCreateProfile(profilePath)
+	if err != nil || profile.LocalRegistry.Username != "admin" || len(profile.LocalRegistry.Users) != 20 {
+		t.Fatalf("❌ expected 20 users to be added, got %+v: %v", profile.LocalRegistry, err)
+	}
+
+	err = UpdateProfile(profilePath, func(profile *Profile) error {
+		profile.LocalRegistry = nil
+		return fmt.Errorf("❌ update failed")
+	})
+	if err == nil {
+		t.Error("❌ error of the update is not returned")
+	}
+	if profile, _ := LoadOrCreateProfile(profilePath); profile.LocalRegistry == nil {
+		t.Error("❌ profile is saved after the update failed")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(profilePath))
+	for _, entry := range entries {
+		if entry.Name() != ".locreg" && entry.Name() != ".locreg.lock" {
+			t.Errorf("❌ temporary file %s is left behind", entry.Name())
+		}
+	}
+}
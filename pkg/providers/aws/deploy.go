@@ -2,17 +2,18 @@ package aws
 
 import (
 	"context"
+	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
-	"log"
 )
 
-func Deploy(locregCfg *parser.Config, envVars map[string]string) {
+func Deploy(locregCfg *parser.Config, envVars map[string]string) error {
 	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(locregCfg.Deploy.Provider.AWS.Region))
+	cfg, err := loadAWSConfig(ctx, locregCfg)
 	if err != nil {
-		log.Fatal("configuration error, " + err.Error())
+		return err
 	}
 	ecsClient := ecs.NewFromConfig(cfg)
 	ecsInstance := EcsClient{
@@ -20,5 +21,17 @@ func Deploy(locregCfg *parser.Config, envVars map[string]string) {
 		locregConfig: locregCfg,
 	}
 	subnetId := ecsInstance.deployECS(ctx, cfg, envVars)
-	ecsInstance.runService(ctx, subnetId)
+	if subnetId == "" {
+		return fmt.Errorf("❌ failed to create ECS cluster and its network")
+	}
+	return ecsInstance.runService(ctx, subnetId)
+}
+
+// loadAWSConfig loads AWS SDK configuration for the region specified in locreg config
+func loadAWSConfig(ctx context.Context, locregCfg *parser.Config) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(locregCfg.Deploy.Provider.AWS.Region))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("❌ configuration error: %w", err)
+	}
+	return cfg, nil
 }
@@ -3,20 +3,22 @@ package aws
 import (
 	"context"
 	"github.com/Uitware/locreg/pkg/parser"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/Uitware/locreg/pkg/providers"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	"log"
 )
 
-func Destroy(locregCfg *parser.Config) {
+func Destroy(locregCfg *parser.Config) error {
 	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx)
 	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.AWSCloudResource == nil {
+		return providers.ErrNotDeployed
+	}
+	cfg, err := loadAWSConfig(ctx, locregCfg)
 	if err != nil {
-		log.Fatal("configuration error, " + err.Error())
+		return err
 	}
 
 	ecsClient := ecs.NewFromConfig(cfg)
@@ -31,4 +33,8 @@ func Destroy(locregCfg *parser.Config) {
 	iamInstance.destroyRole(ctx, profile)
 	ecsInstance.destroyECS(ctx, profile)
 	vpcInstance.destroyVpc(ctx, profile)
+
+	profile.AWSCloudResource = nil
+	profile.Save()
+	return nil
 }
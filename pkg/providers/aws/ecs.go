@@ -113,7 +113,7 @@ func (ecsClient EcsClient) createTaskDefinition(ctx context.Context, profile *pa
 	profile.Save()
 }
 
-func (ecsClient EcsClient) runService(ctx context.Context, subnetId string) {
+func (ecsClient EcsClient) runService(ctx context.Context, subnetId string) error {
 	profile, _ := parser.LoadProfileData()
 	resp, err := ecsClient.client.CreateService(ctx, &ecs.CreateServiceInput{
 		ServiceName:    aws.String(ecsClient.locregConfig.Deploy.Provider.AWS.ECS.ServiceName),
@@ -131,11 +131,11 @@ func (ecsClient EcsClient) runService(ctx context.Context, subnetId string) {
 	})
 	if err != nil {
 		defer Destroy(ecsClient.locregConfig)
-		log.Print("failed to run task, " + err.Error())
-		return
+		return fmt.Errorf("❌ failed to run task: %w", err)
 	}
 	profile.AWSCloudResource.ECS.ServiceARN = *resp.Service.ServiceArn
 	profile.Save()
+	return nil
 }
 
 // destroyTaskDefinition destroys the task definition
@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// maxServiceEvents is the number of the most recent ECS service events returned as logs
+const maxServiceEvents = 20
+
+// Provider deploys the image from the local registry to Amazon ECS on Fargate
+type Provider struct{}
+
+func init() {
+	providers.Register("aws", Provider{})
+}
+
+func (Provider) Validate(config *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry does not exist, run `locreg registry` first")
+	}
+	if profile.Tunnel == nil {
+		return fmt.Errorf("❌ tunnel does not exist, run `locreg registry` first")
+	}
+	if config.Deploy.Provider.AWS.Region == "" {
+		return fmt.Errorf("❌ AWS region is not set")
+	}
+	if len(config.Deploy.Provider.AWS.ECS.TaskDefinition.ContainerDefinition.PortMappings) == 0 {
+		return fmt.Errorf("❌ no port mappings specified for ECS container definition")
+	}
+	return nil
+}
+
+func (Provider) Deploy(config *parser.Config, envVars map[string]string) error {
+	return Deploy(config, envVars)
+}
+
+func (Provider) Destroy(config *parser.Config) error {
+	return Destroy(config)
+}
+
+// Status returns the state of the ECS service and the number of running tasks
+func (Provider) Status(config *parser.Config) (string, error) {
+	ctx := context.Background()
+	ecsClient, profile, err := newDeployedEcsClient(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ecsClient.client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(profile.AWSCloudResource.ECS.ECSClusterARN),
+		Services: []string{profile.AWSCloudResource.ECS.ServiceARN},
+	})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to describe ECS service: %w", err)
+	}
+	if len(resp.Services) == 0 {
+		return "", fmt.Errorf("❌ ECS service %s not found", profile.AWSCloudResource.ECS.ServiceARN)
+	}
+	service := resp.Services[0]
+	return fmt.Sprintf("ECS service %s is %s, %d/%d tasks running",
+		aws.ToString(service.ServiceName),
+		aws.ToString(service.Status),
+		service.RunningCount,
+		service.DesiredCount,
+	), nil
+}
+
+// Logs returns the most recent ECS service events, as container logs are not shipped to CloudWatch
+func (Provider) Logs(config *parser.Config) ([]string, error) {
+	ctx := context.Background()
+	ecsClient, profile, err := newDeployedEcsClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ecsClient.client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(profile.AWSCloudResource.ECS.ECSClusterARN),
+		Services: []string{profile.AWSCloudResource.ECS.ServiceARN},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to describe ECS service: %w", err)
+	}
+	if len(resp.Services) == 0 {
+		return nil, fmt.Errorf("❌ ECS service %s not found", profile.AWSCloudResource.ECS.ServiceARN)
+	}
+	events := resp.Services[0].Events
+	if len(events) > maxServiceEvents {
+		events = events[:maxServiceEvents]
+	}
+	lines := make([]string, 0, len(events))
+	// Events are returned newest first, print them in chronological order
+	for i := len(events) - 1; i >= 0; i-- {
+		lines = append(lines, fmt.Sprintf("%s %s", aws.ToTime(events[i].CreatedAt).Format("2006-01-02 15:04:05"), aws.ToString(events[i].Message)))
+	}
+	return lines, nil
+}
+
+// newDeployedEcsClient returns ECS client and profile if the ECS service is recorded in the profile
+func newDeployedEcsClient(ctx context.Context, config *parser.Config) (EcsClient, *parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.AWSCloudResource == nil || profile.AWSCloudResource.ECS == nil ||
+		profile.AWSCloudResource.ECS.ServiceARN == "" {
+		return EcsClient{}, nil, providers.ErrNotDeployed
+	}
+	cfg, err := loadAWSConfig(ctx, config)
+	if err != nil {
+		return EcsClient{}, nil, err
+	}
+	return EcsClient{client: ecs.NewFromConfig(cfg), locregConfig: config}, profile, nil
+}
@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Redeploy registers a new revision of the task definition pulling the image through the current tunnel URL
+// and rolls the ECS service out to it. The previous revision is deregistered once the service is updated
+func (Provider) Redeploy(config *parser.Config) error {
+	return rollOut(config, providers.ReplaceRegistryHost)
+}
+
+// UpdateImage rolls the ECS service out to a new revision of the task definition running the configured image.
+// ECS pulls the image when tasks are started, so a pushed image is picked up even if its tag is unchanged
+func (Provider) UpdateImage(config *parser.Config) error {
+	return rollOut(config, func(_, registryURL string) string {
+		return providers.RegistryImage(config.GetRegistryImage(), registryURL)
+	})
+}
+
+// rollOut registers a new revision of the task definition with images returned by image for the current image
+// and the tunnel URL, and forces a new deployment of the ECS service with it
+func rollOut(config *parser.Config, image func(imageRef, registryURL string) string) error {
+	ctx := context.Background()
+	ecsClient, profile, err := newDeployedEcsClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	if profile.Tunnel == nil {
+		return fmt.Errorf("❌ tunnel does not exist")
+	}
+
+	current, err := ecsClient.client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(profile.AWSCloudResource.ECS.TaskDefARN),
+		Include:        []types.TaskDefinitionField{types.TaskDefinitionFieldTags},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to describe task definition: %w", err)
+	}
+	taskDef := current.TaskDefinition
+	containerDefinitions := make([]types.ContainerDefinition, len(taskDef.ContainerDefinitions))
+	for i, containerDefinition := range taskDef.ContainerDefinitions {
+		containerDefinition.Image = aws.String(image(aws.ToString(containerDefinition.Image), profile.Tunnel.URL))
+		containerDefinitions[i] = containerDefinition
+	}
+
+	resp, err := ecsClient.client.RegisterTaskDefinition(ctx, &ecs.RegisterTaskDefinitionInput{
+		Family:                  taskDef.Family,
+		ContainerDefinitions:    containerDefinitions,
+		Cpu:                     taskDef.Cpu,
+		Memory:                  taskDef.Memory,
+		NetworkMode:             taskDef.NetworkMode,
+		ExecutionRoleArn:        taskDef.ExecutionRoleArn,
+		TaskRoleArn:             taskDef.TaskRoleArn,
+		RequiresCompatibilities: taskDef.RequiresCompatibilities,
+		RuntimePlatform:         taskDef.RuntimePlatform,
+		Tags:                    current.Tags,
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to register task definition: %w", err)
+	}
+	newTaskDefARN := aws.ToString(resp.TaskDefinition.TaskDefinitionArn)
+
+	_, err = ecsClient.client.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:            aws.String(profile.AWSCloudResource.ECS.ECSClusterARN),
+		Service:            aws.String(profile.AWSCloudResource.ECS.ServiceARN),
+		TaskDefinition:     aws.String(newTaskDefARN),
+		ForceNewDeployment: true,
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to update ECS service: %w", err)
+	}
+
+	oldTaskDefARN := profile.AWSCloudResource.ECS.TaskDefARN
+	profile.AWSCloudResource.ECS.TaskDefARN = newTaskDefARN
+	profile.Save()
+	if _, err := ecsClient.client.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{
+		TaskDefinition: aws.String(oldTaskDefARN),
+	}); err != nil {
+		log.Printf("❌ failed to deregister previous task definition %s: %v", oldTaskDefARN, err)
+	}
+	log.Printf("✅ ECS service updated to task definition %s", newTaskDefARN)
+	return nil
+}
@@ -0,0 +1,30 @@
+package aws
+
+import (
+	"context"
+	"log"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// RotateRegistryCredentials updates the Secrets Manager secret ECS pulls the image with
+func (Provider) RotateRegistryCredentials(config *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.AWSCloudResource == nil || profile.AWSCloudResource.ECS == nil ||
+		profile.AWSCloudResource.ECS.SecretARN == "" {
+		return providers.ErrNotDeployed
+	}
+	ctx := context.Background()
+	cfg, err := loadAWSConfig(ctx, config)
+	if err != nil {
+		return err
+	}
+	secretM := SecretsManagerClient{client: secretsmanager.NewFromConfig(cfg), locregConfig: config}
+	if err := secretM.updateSecret(ctx, profile); err != nil {
+		return err
+	}
+	log.Printf("✅ Secret %s updated with new registry credentials", profile.AWSCloudResource.ECS.SecretARN)
+	return nil
+}
@@ -3,6 +3,8 @@ package aws
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/Uitware/locreg/pkg/local_registry"
 	"github.com/Uitware/locreg/pkg/parser"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
@@ -20,19 +22,14 @@ type Secret struct {
 }
 
 func (secretM *SecretsManagerClient) createSecret(ctx context.Context, profile *parser.Profile) {
-	secretData := Secret{
-		Username: profile.LocalRegistry.Username,
-		Password: profile.LocalRegistry.Password,
-	}
-
-	secretString, err := json.Marshal(secretData)
+	secretString, err := secretM.secretString(profile)
 	if err != nil {
-		log.Fatalf("Failed to marshal secret data")
+		log.Fatalf("❌ failed to prepare secret: %v", err)
 	}
 
 	resp, err := secretM.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
 		Name:                        aws.String("LocregRegistrySecret" + parser.GenerateRandomString(5)),
-		SecretString:                aws.String(string(secretString)),
+		SecretString:                aws.String(secretString),
 		ForceOverwriteReplicaSecret: true,
 		Tags:                        secretM.locregConfig.GenerateSecretTags(),
 	})
@@ -61,3 +58,36 @@ func (secretM *SecretsManagerClient) destroySecret(ctx context.Context, profile
 	profile.AWSCloudResource.ECS.SecretARN = ""
 	profile.Save()
 }
+
+// updateSecret writes the current registry credentials to the secret recorded in the profile,
+// ECS reads the secret when it pulls the image, so running tasks don't need to be restarted
+func (secretM *SecretsManagerClient) updateSecret(ctx context.Context, profile *parser.Profile) error {
+	secretString, err := secretM.secretString(profile)
+	if err != nil {
+		return err
+	}
+	_, err = secretM.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(profile.AWSCloudResource.ECS.SecretARN),
+		SecretString: aws.String(secretString),
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to update secret: %w", err)
+	}
+	return nil
+}
+
+// secretString returns the registry credentials in the format ECS expects for private registry authentication
+func (secretM *SecretsManagerClient) secretString(profile *parser.Profile) (string, error) {
+	username, password, err := local_registry.RuntimeCredentials(secretM.locregConfig, profile)
+	if err != nil {
+		return "", err
+	}
+	secretString, err := json.Marshal(Secret{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to marshal secret data: %w", err)
+	}
+	return string(secretString), nil
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Uitware/locreg/pkg/local_registry"
 	"github.com/Uitware/locreg/pkg/parser"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -42,65 +43,87 @@ type ResourceTracker struct {
 var tracker = &ResourceTracker{}
 
 // Deploy initiates the deployment of resources in Azure
-func Deploy(azureConfig *parser.Config, envVars map[string]string) {
+func Deploy(azureConfig *parser.Config, envVars map[string]string) error {
 	log.Println("Starting deployment...")
 
 	// Fetch the tunnel URL from the profile
 	profilePath, err := parser.GetProfilePath()
 	if err != nil {
-		log.Fatalf("❌ Failed to get profile path: %v", err)
+		return fmt.Errorf("❌ failed to get profile path: %w", err)
 	}
 
 	profile, err := parser.LoadOrCreateProfile(profilePath)
 	if err != nil {
-		log.Fatalf("❌ Failed to load or create profile: %v", err)
+		return fmt.Errorf("❌ failed to load or create profile: %w", err)
 	}
 	tunnelURL := strings.TrimPrefix(profile.Tunnel.URL, "https://")
 
 	err = checkTunnelURLValidity(tunnelURL)
 	if err != nil {
-		log.Fatalf("❌ Failed to check tunnel URL validity: %v", err)
+		return fmt.Errorf("❌ failed to check tunnel URL validity: %w", err)
 	}
+	if err := initClients(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	// Create a resource group
+	resourceGroup, err := createResourceGroup(ctx, azureConfig)
+	if err != nil {
+		handleAzureError(err)
+	} else {
+		tracker.ResourceGroup = azureConfig.Deploy.Provider.Azure.ResourceGroup
+		log.Println("✅ Resource group created:", *resourceGroup.ID)
+	}
+
+	//Determine the deployment type and call the appropriate deployment function
+	if azureConfig.IsAppServiceSet() {
+		DeployAppService(ctx, azureConfig, tunnelURL, envVars)
+	} else if azureConfig.IsContainerInstanceSet() {
+		DeployACI(ctx, azureConfig, tunnelURL, envVars)
+	} else {
+		return fmt.Errorf("❌ no valid deployment configuration found")
+	}
+	return nil
+}
+
+// initClients authenticates with Azure and initializes resource clients for the current subscription
+func initClients() error {
 	// Get the Azure subscription ID
 	subscriptionID, err := getSubscriptionID()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("❌ failed to get subscription ID: %w", err)
 	}
 	if len(subscriptionID) == 0 {
-		log.Fatal("❌ AZURE_SUBSCRIPTION_ID is not set.")
+		return fmt.Errorf("❌ AZURE_SUBSCRIPTION_ID is not set")
 	}
 
 	// Authenticate using Azure credentials
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("❌ failed to authenticate: %w", err)
 	}
-	ctx := context.Background()
 
 	// Initialize Azure resource clients
 	resourcesClientFactory, err = armresources.NewClientFactory(subscriptionID, cred, nil)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("❌ failed to create resources client: %w", err)
 	}
 	resourceGroupClient = resourcesClientFactory.NewResourceGroupsClient()
 
-	// Create a resource group
-	resourceGroup, err := createResourceGroup(ctx, azureConfig)
+	appserviceClientFactory, err = armappservice.NewClientFactory(subscriptionID, cred, nil)
 	if err != nil {
-		handleAzureError(err)
-	} else {
-		tracker.ResourceGroup = azureConfig.Deploy.Provider.Azure.ResourceGroup
-		log.Println("✅ Resource group created:", *resourceGroup.ID)
+		return fmt.Errorf("❌ failed to create app service client: %w", err)
 	}
+	plansClient = appserviceClientFactory.NewPlansClient()
+	webAppsClient = appserviceClientFactory.NewWebAppsClient()
 
-	//Determine the deployment type and call the appropriate deployment function
-	if azureConfig.IsAppServiceSet() {
-		DeployAppService(ctx, azureConfig, tunnelURL, envVars)
-	} else if azureConfig.IsContainerInstanceSet() {
-		DeployACI(ctx, azureConfig, tunnelURL, envVars)
-	} else {
-		log.Fatal("❌ No valid deployment configuration found.")
+	aciClientFactory, err = armcontainerinstance.NewClientFactory(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create container instance client: %w", err)
 	}
+	aciClient = aciClientFactory.NewContainerGroupsClient()
+	return nil
 }
 
 // createResourceGroup creates a new resource group in Azure
@@ -240,3 +263,14 @@ func cleanupResources(ctx context.Context, tracker *ResourceTracker) {
 		}
 	}
 }
+
+// registryCredentials returns credentials the deployed resource pulls the image with. Credentials recorded
+// in the profile are preferred, as they are the ones the registry runs with after rotation.
+// With token authentication these are pull-only credentials issued for the image repository
+func registryCredentials(azureConfig *parser.Config) (string, string, error) {
+	profile, _ := parser.LoadProfileData()
+	if !azureConfig.IsTokenAuthEnabled() && (profile == nil || profile.LocalRegistry == nil) {
+		return azureConfig.Registry.Username, azureConfig.Registry.Password, nil
+	}
+	return local_registry.RuntimeCredentials(azureConfig, profile)
+}
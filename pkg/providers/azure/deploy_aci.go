@@ -52,6 +52,10 @@ func DeployACI(ctx context.Context, azureConfig *parser.Config, tunnelURL string
 
 // createACI creates a new Azure Container Instance
 func createACI(ctx context.Context, azureConfig *parser.Config, tunnelURL string, envVars map[string]string) (*armcontainerinstance.ContainerGroup, error) {
+	username, password, err := registryCredentials(azureConfig)
+	if err != nil {
+		return nil, err
+	}
 	containerConfig := azureConfig.Deploy.Provider.Azure.ContainerInstance
 	imageConfig := azureConfig.Image
 
@@ -101,8 +105,8 @@ func createACI(ctx context.Context, azureConfig *parser.Config, tunnelURL string
 			ImageRegistryCredentials: []*armcontainerinstance.ImageRegistryCredential{
 				{
 					Server:   to.Ptr(tunnelURL),
-					Username: to.Ptr(azureConfig.Registry.Username),
-					Password: to.Ptr(azureConfig.Registry.Password),
+					Username: to.Ptr(username),
+					Password: to.Ptr(password),
 				},
 			},
 		},
@@ -125,26 +129,17 @@ func createACI(ctx context.Context, azureConfig *parser.Config, tunnelURL string
 }
 
 func writeProfileContainerInstance(resourceGroupName, containerInstanceName string) error {
-	profilePath, err := parser.GetProfilePath()
-	if err != nil {
-		return fmt.Errorf("❌ failed to get profile path: %w", err)
-	}
-
-	profile, err := parser.LoadOrCreateProfile(profilePath)
+	err := parser.Update(func(profile *parser.Profile) error {
+		if profile.AzureCloudResource == nil {
+			profile.AzureCloudResource = &parser.AzureCloudResource{}
+		}
+		profile.AzureCloudResource.ContainerInstance = &parser.ContainerInstance{
+			ResourceGroupName:     resourceGroupName,
+			ContainerInstanceName: containerInstanceName,
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("❌ failed to load or create profile: %w", err)
-	}
-
-	if profile.AzureCloudResource == nil {
-		profile.AzureCloudResource = &parser.AzureCloudResource{}
-	}
-
-	profile.AzureCloudResource.ContainerInstance = &parser.ContainerInstance{
-		ResourceGroupName:     resourceGroupName,
-		ContainerInstanceName: containerInstanceName,
-	}
-
-	if err := parser.SaveProfile(profile, profilePath); err != nil {
 		return fmt.Errorf("❌ failed to save profile: %w", err)
 	}
 	return nil
@@ -98,6 +98,10 @@ func createAppServicePlan(ctx context.Context, azureConfig *parser.Config) (*arm
 func createWebApp(ctx context.Context, azureConfig *parser.Config, appServicePlanID, tunnelURL string, envVars map[string]string) (*armappservice.Site, error) {
 	log.Println("Creating Web App...")
 
+	username, password, err := registryCredentials(azureConfig)
+	if err != nil {
+		return nil, err
+	}
 	siteConfig := azureConfig.Deploy.Provider.Azure.AppService.SiteConfig
 	imageConfig := azureConfig.Image
 
@@ -109,11 +113,11 @@ func createWebApp(ctx context.Context, azureConfig *parser.Config, appServicePla
 		},
 		{
 			Name:  to.Ptr("DOCKER_REGISTRY_SERVER_USERNAME"),
-			Value: to.Ptr(azureConfig.Registry.Username),
+			Value: to.Ptr(username),
 		},
 		{
 			Name:  to.Ptr("DOCKER_REGISTRY_SERVER_PASSWORD"),
-			Value: to.Ptr(azureConfig.Registry.Password),
+			Value: to.Ptr(password),
 		},
 	}
 
@@ -155,29 +159,19 @@ func createWebApp(ctx context.Context, azureConfig *parser.Config, appServicePla
 	return &resp.Site, nil
 }
 func writeProfileAppService(resourceGroupName, appServicePlanName, appServiceName string) error {
-	// Get the profile path
-	profilePath, err := parser.GetProfilePath()
-	if err != nil {
-		return fmt.Errorf("❌ failed to get profile path: %w", err)
-	}
-
-	// Load or create a new profile
-	profile, err := parser.LoadOrCreateProfile(profilePath)
+	err := parser.Update(func(profile *parser.Profile) error {
+		if profile.AzureCloudResource == nil {
+			profile.AzureCloudResource = &parser.AzureCloudResource{}
+		}
+		// Update the profile with the new resource details
+		profile.AzureCloudResource.AppService = &parser.AppService{
+			ResourceGroupName:  resourceGroupName,
+			AppServicePlanName: appServicePlanName,
+			AppServiceName:     appServiceName,
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("❌ failed to load or create profile: %w", err)
-	}
-
-	if profile.AzureCloudResource == nil {
-		profile.AzureCloudResource = &parser.AzureCloudResource{}
-	}
-	// Update the profile with the new resource details
-	profile.AzureCloudResource.AppService = &parser.AppService{
-		ResourceGroupName:  resourceGroupName,
-		AppServicePlanName: appServicePlanName,
-		AppServiceName:     appServiceName,
-	}
-
-	if err := parser.SaveProfile(profile, profilePath); err != nil {
 		return fmt.Errorf("❌ failed to save profile: %w", err)
 	}
 	return nil
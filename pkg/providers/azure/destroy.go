@@ -2,58 +2,31 @@ package azure
 
 import (
 	"context"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/appservice/armappservice/v2"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerinstance/armcontainerinstance/v2"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"fmt"
 	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
 	"log"
 )
 
-func Destroy() {
+func Destroy() error {
 	log.Println("Starting destruction...")
-	subscriptionID, err := getSubscriptionID()
-	if err != nil {
-		log.Fatal(err)
-	}
-	if len(subscriptionID) == 0 {
-		log.Fatal("❌ AZURE_SUBSCRIPTION_ID is not set.")
-	}
-
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	ctx := context.Background()
-
-	resourcesClientFactory, err = armresources.NewClientFactory(subscriptionID, cred, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	resourceGroupClient = resourcesClientFactory.NewResourceGroupsClient()
-
-	appserviceClientFactory, err = armappservice.NewClientFactory(subscriptionID, cred, nil)
+	profilePath, err := parser.GetProfilePath()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("❌ failed to get profile path: %w", err)
 	}
-	plansClient = appserviceClientFactory.NewPlansClient()
-	webAppsClient = appserviceClientFactory.NewWebAppsClient()
 
-	aciClientFactory, err = armcontainerinstance.NewClientFactory(subscriptionID, cred, nil)
+	profile, err := parser.LoadOrCreateProfile(profilePath)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("❌ failed to load or create profile: %w", err)
 	}
-	aciClient = aciClientFactory.NewContainerGroupsClient()
-
-	profilePath, err := parser.GetProfilePath()
-	if err != nil {
-		log.Fatal(err)
+	if profile.AzureCloudResource == nil {
+		return providers.ErrNotDeployed
 	}
 
-	profile, err := parser.LoadOrCreateProfile(profilePath)
-	if err != nil {
-		log.Fatal(err)
+	if err := initClients(); err != nil {
+		return err
 	}
+	ctx := context.Background()
 
 	if profile.AzureCloudResource.AppService != nil {
 		if profile.AzureCloudResource.AppService.AppServiceName != "" {
@@ -97,6 +70,15 @@ func Destroy() {
 			}
 		}
 	}
+
+	err = parser.UpdateProfile(profilePath, func(profile *parser.Profile) error {
+		profile.AzureCloudResource = nil
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return nil
 }
 
 func deleteResourceGroup(ctx context.Context, resourceGroupName string) error {
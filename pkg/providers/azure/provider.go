@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+)
+
+// Provider deploys the image from the local registry to Azure App Service or Azure Container Instances
+type Provider struct{}
+
+func init() {
+	providers.Register("azure", Provider{})
+}
+
+func (Provider) Validate(config *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry does not exist, run `locreg registry` first")
+	}
+	if profile.Tunnel == nil {
+		return fmt.Errorf("❌ tunnel does not exist, run `locreg registry` first")
+	}
+	if !config.IsAppServiceSet() && !config.IsContainerInstanceSet() {
+		return fmt.Errorf("❌ either appService and appServicePlan or containerInstance must be specified")
+	}
+	return nil
+}
+
+func (Provider) Deploy(config *parser.Config, envVars map[string]string) error {
+	return Deploy(config, envVars)
+}
+
+func (Provider) Destroy(_ *parser.Config) error {
+	return Destroy()
+}
+
+// Status returns the state of the deployed App Service or Container Instance
+func (Provider) Status(_ *parser.Config) (string, error) {
+	profile, err := loadDeployedProfile()
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+
+	var statuses []string
+	if appService := profile.AzureCloudResource.AppService; appService != nil {
+		resp, err := webAppsClient.Get(ctx, appService.ResourceGroupName, appService.AppServiceName, nil)
+		if err != nil {
+			return "", fmt.Errorf("❌ failed to get app service: %w", err)
+		}
+		statuses = append(statuses, fmt.Sprintf("App Service %s is %s, https://%s",
+			appService.AppServiceName,
+			valueOrUnknown(resp.Properties.State),
+			valueOrUnknown(resp.Properties.DefaultHostName),
+		))
+	}
+	if containerInstance := profile.AzureCloudResource.ContainerInstance; containerInstance != nil {
+		resp, err := aciClient.Get(ctx, containerInstance.ResourceGroupName, containerInstance.ContainerInstanceName, nil)
+		if err != nil {
+			return "", fmt.Errorf("❌ failed to get container instance: %w", err)
+		}
+		state := "Unknown"
+		if resp.Properties.InstanceView != nil {
+			state = valueOrUnknown(resp.Properties.InstanceView.State)
+		}
+		statuses = append(statuses, fmt.Sprintf("Container Instance %s is %s",
+			containerInstance.ContainerInstanceName,
+			state,
+		))
+	}
+	return strings.Join(statuses, "\n"), nil
+}
+
+// Logs returns logs of the container running in Azure Container Instances.
+// App Service logs are not supported as they are only available as a zip archive
+func (Provider) Logs(_ *parser.Config) ([]string, error) {
+	profile, err := loadDeployedProfile()
+	if err != nil {
+		return nil, err
+	}
+	containerInstance := profile.AzureCloudResource.ContainerInstance
+	if containerInstance == nil {
+		return nil, providers.ErrNotSupported
+	}
+	// Container inside the container group is created with the same name as the group itself
+	resp, err := aciClientFactory.NewContainersClient().ListLogs(
+		context.Background(),
+		containerInstance.ResourceGroupName,
+		containerInstance.ContainerInstanceName,
+		containerInstance.ContainerInstanceName,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("❌ failed to get container instance logs: %w", err)
+	}
+	if resp.Content == nil {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimRight(*resp.Content, "\n"), "\n"), nil
+}
+
+// loadDeployedProfile loads profile and initializes Azure clients if Azure resources are recorded in the profile
+func loadDeployedProfile() (*parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.AzureCloudResource == nil {
+		return nil, providers.ErrNotDeployed
+	}
+	if err := initClients(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func valueOrUnknown(value *string) string {
+	if value == nil {
+		return "Unknown"
+	}
+	return *value
+}
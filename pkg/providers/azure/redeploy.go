@@ -0,0 +1,181 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/appservice/armappservice/v2"
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+)
+
+// dockerImagePrefix is the prefix of App Service LinuxFxVersion for custom container images
+const dockerImagePrefix = "DOCKER|"
+
+// Redeploy points the deployed App Service or Container Instance to the tunnel URL recorded in the profile
+func (Provider) Redeploy(config *parser.Config) error {
+	profile, err := loadDeployedProfile()
+	if err != nil {
+		return err
+	}
+	if profile.Tunnel == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry or tunnel does not exist")
+	}
+	ctx := context.Background()
+	if appService := profile.AzureCloudResource.AppService; appService != nil {
+		if err := redeployAppService(ctx, appService, profile.Tunnel.URL, providers.ReplaceRegistryHost); err != nil {
+			return err
+		}
+	}
+	if containerInstance := profile.AzureCloudResource.ContainerInstance; containerInstance != nil {
+		if _, err := redeployACI(ctx, config, containerInstance, profile, providers.ReplaceRegistryHost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateImage points the deployed App Service or Container Instance to the configured image and restarts it,
+// so the image is pulled again even if its tag is unchanged
+func (Provider) UpdateImage(config *parser.Config) error {
+	profile, err := loadDeployedProfile()
+	if err != nil {
+		return err
+	}
+	if profile.Tunnel == nil || profile.LocalRegistry == nil {
+		return fmt.Errorf("❌ local registry or tunnel does not exist")
+	}
+	configuredImage := func(_, registryURL string) string {
+		return providers.RegistryImage(config.GetRegistryImage(), registryURL)
+	}
+	ctx := context.Background()
+	if appService := profile.AzureCloudResource.AppService; appService != nil {
+		if err := redeployAppService(ctx, appService, profile.Tunnel.URL, configuredImage); err != nil {
+			return err
+		}
+	}
+	if containerInstance := profile.AzureCloudResource.ContainerInstance; containerInstance != nil {
+		changed, err := redeployACI(ctx, config, containerInstance, profile, configuredImage)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			if err := restartACI(ctx, containerInstance); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redeployAppService updates LinuxFxVersion to the image returned by image for the current image and the tunnel URL,
+// points registry URL app setting to the tunnel and restarts the App Service
+func redeployAppService(
+	ctx context.Context,
+	appService *parser.AppService,
+	tunnelURL string,
+	image func(imageRef, registryURL string) string,
+) error {
+	configResp, err := webAppsClient.GetConfiguration(ctx, appService.ResourceGroupName, appService.AppServiceName, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to get app service configuration: %w", err)
+	}
+	siteConfig := configResp.SiteConfigResource
+	if siteConfig.Properties == nil || siteConfig.Properties.LinuxFxVersion == nil {
+		return fmt.Errorf("❌ app service %s doesn't run a container image", appService.AppServiceName)
+	}
+	imageRef := strings.TrimPrefix(*siteConfig.Properties.LinuxFxVersion, dockerImagePrefix)
+	// Configuration is patched, so only the image is changed
+	_, err = webAppsClient.UpdateConfiguration(ctx, appService.ResourceGroupName, appService.AppServiceName, armappservice.SiteConfigResource{
+		Properties: &armappservice.SiteConfig{
+			LinuxFxVersion: to.Ptr(dockerImagePrefix + image(imageRef, tunnelURL)),
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to update app service configuration: %w", err)
+	}
+
+	settingsResp, err := webAppsClient.ListApplicationSettings(ctx, appService.ResourceGroupName, appService.AppServiceName, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to get app service settings: %w", err)
+	}
+	settings := settingsResp.StringDictionary
+	if settings.Properties == nil {
+		settings.Properties = map[string]*string{}
+	}
+	settings.Properties["DOCKER_REGISTRY_SERVER_URL"] = to.Ptr("https://" + strings.TrimPrefix(tunnelURL, "https://"))
+	if _, err := webAppsClient.UpdateApplicationSettings(ctx, appService.ResourceGroupName, appService.AppServiceName, settings, nil); err != nil {
+		return fmt.Errorf("❌ failed to update app service settings: %w", err)
+	}
+
+	if _, err := webAppsClient.Restart(ctx, appService.ResourceGroupName, appService.AppServiceName, nil); err != nil {
+		return fmt.Errorf("❌ failed to restart app service: %w", err)
+	}
+	log.Printf("✅ App Service %s updated to pull from %s", appService.AppServiceName, tunnelURL)
+	return nil
+}
+
+// redeployACI updates images of the container group to the ones returned by image for the current image and
+// the tunnel URL, and registry credentials. Azure restarts containers whose image has changed, whether any has is returned.
+// Registry password isn't returned by Azure and is issued again
+func redeployACI(
+	ctx context.Context,
+	config *parser.Config,
+	containerInstance *parser.ContainerInstance,
+	profile *parser.Profile,
+	image func(imageRef, registryURL string) string,
+) (bool, error) {
+	username, password, err := local_registry.RuntimeCredentials(config, profile)
+	if err != nil {
+		return false, err
+	}
+	resp, err := aciClient.Get(ctx, containerInstance.ResourceGroupName, containerInstance.ContainerInstanceName, nil)
+	if err != nil {
+		return false, fmt.Errorf("❌ failed to get container instance: %w", err)
+	}
+	containerGroup := resp.ContainerGroup
+	registryHost := strings.TrimPrefix(profile.Tunnel.URL, "https://")
+	changed := false
+	for _, container := range containerGroup.Properties.Containers {
+		if container.Properties != nil && container.Properties.Image != nil {
+			updated := image(*container.Properties.Image, registryHost)
+			changed = changed || updated != *container.Properties.Image
+			container.Properties.Image = to.Ptr(updated)
+		}
+	}
+	for _, credential := range containerGroup.Properties.ImageRegistryCredentials {
+		credential.Server = to.Ptr(registryHost)
+		credential.Username = to.Ptr(username)
+		credential.Password = to.Ptr(password)
+	}
+	// Read-only properties are not accepted on update
+	containerGroup.Properties.InstanceView = nil
+	containerGroup.Properties.ProvisioningState = nil
+
+	poller, err := aciClient.BeginCreateOrUpdate(ctx, containerInstance.ResourceGroupName, containerInstance.ContainerInstanceName, containerGroup, nil)
+	if err != nil {
+		return false, fmt.Errorf("❌ failed to update container instance: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return false, fmt.Errorf("❌ failed to update container instance: %w", err)
+	}
+	log.Printf("✅ Container Instance %s updated to pull from %s", containerInstance.ContainerInstanceName, registryHost)
+	return changed, nil
+}
+
+// restartACI restarts containers of the container group in place, Azure pulls their images again
+func restartACI(ctx context.Context, containerInstance *parser.ContainerInstance) error {
+	poller, err := aciClient.BeginRestart(ctx, containerInstance.ResourceGroupName, containerInstance.ContainerInstanceName, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to restart container instance: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("❌ failed to restart container instance: %w", err)
+	}
+	log.Printf("✅ Container Instance %s restarted", containerInstance.ContainerInstanceName)
+	return nil
+}
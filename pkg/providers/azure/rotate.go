@@ -0,0 +1,59 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+)
+
+// RotateRegistryCredentials updates registry credentials of the deployed App Service or Container Instance
+func (Provider) RotateRegistryCredentials(config *parser.Config) error {
+	profile, err := loadDeployedProfile()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if appService := profile.AzureCloudResource.AppService; appService != nil {
+		if err := rotateAppService(ctx, config, appService, profile); err != nil {
+			return err
+		}
+	}
+	if containerInstance := profile.AzureCloudResource.ContainerInstance; containerInstance != nil {
+		if profile.Tunnel == nil {
+			return fmt.Errorf("❌ tunnel does not exist, container instance can't be updated")
+		}
+		// Credentials of a container group can only be changed by updating the whole group
+		if _, err := redeployACI(ctx, config, containerInstance, profile, providers.ReplaceRegistryHost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateAppService updates registry credential app settings of the App Service, they are used on the next image pull
+func rotateAppService(ctx context.Context, config *parser.Config, appService *parser.AppService, profile *parser.Profile) error {
+	username, password, err := local_registry.RuntimeCredentials(config, profile)
+	if err != nil {
+		return err
+	}
+	settingsResp, err := webAppsClient.ListApplicationSettings(ctx, appService.ResourceGroupName, appService.AppServiceName, nil)
+	if err != nil {
+		return fmt.Errorf("❌ failed to get app service settings: %w", err)
+	}
+	settings := settingsResp.StringDictionary
+	if settings.Properties == nil {
+		settings.Properties = map[string]*string{}
+	}
+	settings.Properties["DOCKER_REGISTRY_SERVER_USERNAME"] = to.Ptr(username)
+	settings.Properties["DOCKER_REGISTRY_SERVER_PASSWORD"] = to.Ptr(password)
+	if _, err := webAppsClient.UpdateApplicationSettings(ctx, appService.ResourceGroupName, appService.AppServiceName, settings, nil); err != nil {
+		return fmt.Errorf("❌ failed to update app service settings: %w", err)
+	}
+	log.Printf("✅ App Service %s updated with new registry credentials", appService.AppServiceName)
+	return nil
+}
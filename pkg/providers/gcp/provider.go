@@ -0,0 +1,35 @@
+package gcp
+
+import (
+	"fmt"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/providers"
+)
+
+// Provider is a placeholder for GCP Cloud Run deployments
+type Provider struct{}
+
+func init() {
+	providers.Register("gcp", Provider{})
+}
+
+func (Provider) Validate(_ *parser.Config) error {
+	return fmt.Errorf("❌ GCP provider is not implemented yet")
+}
+
+func (Provider) Deploy(_ *parser.Config, _ map[string]string) error {
+	Deploy()
+	return providers.ErrNotSupported
+}
+
+func (Provider) Destroy(_ *parser.Config) error {
+	return providers.ErrNotDeployed
+}
+
+func (Provider) Status(_ *parser.Config) (string, error) {
+	return "", providers.ErrNotDeployed
+}
+
+func (Provider) Logs(_ *parser.Config) ([]string, error) {
+	return nil, providers.ErrNotDeployed
+}
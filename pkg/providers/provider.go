@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+var (
+	// ErrNotDeployed is returned by a provider when the profile has no cloud resources created by it
+	ErrNotDeployed = errors.New("no cloud resources of this provider found in profile")
+	// ErrNotSupported is returned by a provider for operations it can't perform
+	ErrNotSupported = errors.New("operation is not supported by this provider")
+)
+
+// Provider is a cloud deployment backend used by locreg to run the image stored in the local registry.
+// Every provider lives in its own package and registers itself with Register from its init function,
+// so adding a new backend doesn't require changes in the cmd package
+type Provider interface {
+	// Validate checks that the configuration and profile contain everything needed to deploy
+	Validate(config *parser.Config) error
+	// Deploy creates cloud resources and runs the image from the local registry
+	Deploy(config *parser.Config, envVars map[string]string) error
+	// Destroy removes cloud resources recorded in the profile and clears them from it.
+	// Returns ErrNotDeployed if there is nothing to destroy
+	Destroy(config *parser.Config) error
+	// Status returns a human-readable state of the deployed resources
+	Status(config *parser.Config) (string, error)
+	// Logs returns the most recent log lines of the deployed application
+	Logs(config *parser.Config) ([]string, error)
+}
+
+// Redeployer is implemented by providers that can point deployed resources to a new registry URL,
+// e.g. after the tunnel was restarted with a different public URL
+type Redeployer interface {
+	// Redeploy updates deployed resources to pull the image through the tunnel URL recorded in the profile.
+	// Returns ErrNotDeployed if there is nothing to update
+	Redeploy(config *parser.Config) error
+}
+
+// CredentialRotator is implemented by providers that store registry credentials in deployed resources
+type CredentialRotator interface {
+	// RotateRegistryCredentials updates deployed resources with the current registry credentials.
+	// Returns ErrNotDeployed if there is nothing to update
+	RotateRegistryCredentials(config *parser.Config) error
+}
+
+// ImageUpdater is implemented by providers that can roll deployed resources out to a newly pushed image
+type ImageUpdater interface {
+	// UpdateImage makes deployed resources pull and run the image configured under `image` through the tunnel URL
+	// recorded in the profile, even if its reference is unchanged. Returns ErrNotDeployed if there is nothing to update
+	UpdateImage(config *parser.Config) error
+}
+
+// ReplaceRegistryHost replaces the registry host of the image reference with the host of the registry URL
+func ReplaceRegistryHost(imageRef, registryURL string) string {
+	_, repository, found := strings.Cut(imageRef, "/")
+	if !found {
+		return RegistryImage(imageRef, registryURL)
+	}
+	return RegistryImage(repository, registryURL)
+}
+
+// RegistryImage returns the reference of the image, without registry host, pulled from the registry at the URL
+func RegistryImage(image, registryURL string) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(registryURL, "https://"), "http://"), "/")
+	return host + "/" + image
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register makes a provider available by the provided name.
+// If Register is called twice with the same name it panics
+func Register(name string, provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		panic("providers: Register provider is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("providers: Register called twice for provider " + name)
+	}
+	providers[name] = provider
+}
+
+// Get returns the provider registered with the provided name
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("❌ unknown provider %q, available providers: %s", name, strings.Join(names(), ", "))
+	}
+	return provider, nil
+}
+
+// Names returns a sorted list of the names of the registered providers
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(providers))
+	for name := range providers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+type dummyProvider struct{}
+
+func (dummyProvider) Validate(_ *parser.Config) error                    { return nil }
+func (dummyProvider) Deploy(_ *parser.Config, _ map[string]string) error { return nil }
+func (dummyProvider) Destroy(_ *parser.Config) error                     { return ErrNotDeployed }
+func (dummyProvider) Status(_ *parser.Config) (string, error)            { return "", ErrNotDeployed }
+func (dummyProvider) Logs(_ *parser.Config) ([]string, error)            { return nil, ErrNotDeployed }
+
+func TestRegisterAndGet(t *testing.T) {
+	Register("dummy-b", dummyProvider{})
+	Register("dummy-a", dummyProvider{})
+
+	if _, err := Get("dummy-a"); err != nil {
+		t.Fatalf("❌ registered provider is not found: %v", err)
+	}
+	if _, err := Get("unknown"); err == nil {
+		t.Fatal("❌ unknown provider is returned")
+	}
+
+	names := Names()
+	if len(names) < 2 || names[0] != "dummy-a" || names[1] != "dummy-b" {
+		t.Errorf("❌ provider names are not sorted: %v", names)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	Register("dummy-dup", dummyProvider{})
+	defer func() {
+		if recover() == nil {
+			t.Error("❌ registering provider twice didn't panic")
+		}
+	}()
+	Register("dummy-dup", dummyProvider{})
+}
+
+func TestReplaceRegistryHost(t *testing.T) {
+	for _, tc := range []struct {
+		imageRef, registryURL, expected string
+	}{
+		{"old.ngrok.app/app:latest", "https://new.ngrok.app", "new.ngrok.app/app:latest"},
+		{"old.trycloudflare.com/team/app:v1", "https://new.trycloudflare.com/", "new.trycloudflare.com/team/app:v1"},
+		{"bore.example.com:4000/app:latest", "bore.example.com:4001", "bore.example.com:4001/app:latest"},
+	} {
+		if actual := ReplaceRegistryHost(tc.imageRef, tc.registryURL); actual != tc.expected {
+			t.Errorf("❌ expected %s, got %s", tc.expected, actual)
+		}
+	}
+	if actual := RegistryImage("team/app:v2", "https://new.ngrok.app/"); actual != "new.ngrok.app/team/app:v2" {
+		t.Errorf("❌ expected image in the registry, got %s", actual)
+	}
+}
@@ -0,0 +1,63 @@
+package bore
+
+import (
+	"fmt"
+
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+)
+
+const providerName = "bore"
+
+// Provider exposes the local registry through a self-hosted bore server with bore client running in a Docker container
+type Provider struct{}
+
+func init() {
+	tunnels.Register(providerName, Provider{})
+}
+
+func (Provider) Start(config *parser.Config) error {
+	return RunBoreTunnelContainer(config)
+}
+
+func (Provider) Stop(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := local_registry.StopAndRemoveContainer(profile.Tunnel.ContainerID); err != nil {
+		return fmt.Errorf("❌ failed to stop or remove tunnel container: %w", err)
+	}
+	return nil
+}
+
+// PublicURL returns the `host:port` address of the tunnel recorded in the profile
+func (Provider) PublicURL(_ *parser.Config) (string, error) {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return "", err
+	}
+	return profile.Tunnel.URL, nil
+}
+
+// Health checks that bore container is running and the registry is reachable through the tunnel.
+// bore forwards plain TCP, so the registry is served over HTTP on the public address
+func (Provider) Health(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := tunnels.CheckContainerRunning(profile.Tunnel.ContainerID); err != nil {
+		return err
+	}
+	return tunnels.CheckRegistryURL("http://" + profile.Tunnel.URL)
+}
+
+func loadTunnelProfile() (*parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil || profile.Tunnel.ContainerID == "" {
+		return nil, fmt.Errorf("❌ no bore tunnel container found in profile")
+	}
+	return profile, nil
+}
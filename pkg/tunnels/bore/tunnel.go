@@ -0,0 +1,152 @@
+package bore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// startTimeout is the time given to bore client to connect to the server
+const startTimeout = time.Minute
+
+// listeningAt matches the public address printed by bore client once the server has allocated a port
+var listeningAt = regexp.MustCompile(`listening at ([A-Za-z0-9.-]+:\d+)`)
+
+// RunBoreTunnelContainer runs bore client in a Docker container on the registry network,
+// the public address allocated by the bore server is parsed from the container logs
+func RunBoreTunnelContainer(config *parser.Config) error {
+	boreConfig := config.Tunnel.Provider.Bore
+	if boreConfig.Server == "" {
+		return fmt.Errorf("❌ server must be specified for bore tunnel")
+	}
+
+	ctx := context.Background()
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	networkID, err := tunnels.EnsureNetwork(ctx, dockerClient, boreConfig.NetworkName)
+	if err != nil {
+		return err
+	}
+	containerImage := fmt.Sprintf("%v:%v", boreConfig.Image, boreConfig.Tag)
+	if err := tunnels.PullImage(ctx, dockerClient, containerImage); err != nil {
+		return err
+	}
+
+	registryHost, registryPort, _ := strings.Cut(tunnels.RegistryAddress(config), ":")
+	cmd := []string{
+		"local", registryPort,
+		"--local-host", registryHost,
+		"--to", boreConfig.Server,
+	}
+	if boreConfig.Port != 0 {
+		cmd = append(cmd, "--port", strconv.Itoa(boreConfig.Port))
+	}
+	var env []string
+	if secret := getSecret(config); secret != "" {
+		env = append(env, "BORE_SECRET="+secret)
+	}
+
+	resp, err := dockerClient.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image: containerImage,
+			Cmd:   cmd,
+			Env:   env,
+		},
+		&container.HostConfig{
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+			ExtraHosts:    tunnels.RegistryExtraHosts(config),
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkID: {},
+			},
+		},
+		nil,
+		boreConfig.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create container: %w", err)
+	}
+
+	if err := dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		errorCleanup(resp.ID)
+		return fmt.Errorf("❌ failed to start bore container: %w", err)
+	}
+
+	publicURL, err := getPublicURL(ctx, dockerClient, resp.ID, startTimeout)
+	if err != nil {
+		errorCleanup(resp.ID)
+		return err
+	}
+	log.Printf("✅ bore tunnel is running at %s", publicURL)
+
+	if err := writeToProfile(resp.ID, publicURL); err != nil {
+		errorCleanup(resp.ID)
+		return fmt.Errorf("❌ failed to write to profile: %w", err)
+	}
+	return nil
+}
+
+// getPublicURL returns the last `host:port` address printed by bore client,
+// the address changes if the client reconnects without a fixed remote port
+func getPublicURL(ctx context.Context, dockerClient *client.Client, containerID string, timeout time.Duration) (string, error) {
+	var publicURL string
+	err := tunnels.ScanLogs(ctx, dockerClient, containerID, timeout, func(line string) bool {
+		publicURL = publicAddress(line)
+		return publicURL != ""
+	})
+	return publicURL, err
+}
+
+// publicAddress returns the `host:port` address from the log line of bore client, empty if the line has none
+func publicAddress(line string) string {
+	if match := listeningAt.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// getSecret returns bore server secret from the config or from BORE_SECRET env variable
+func getSecret(config *parser.Config) string {
+	if config.Tunnel.Provider.Bore.Secret != "" {
+		return config.Tunnel.Provider.Bore.Secret
+	}
+	return os.Getenv("BORE_SECRET")
+}
+
+// writeToProfile writes the container ID and tunnel address to the profile
+func writeToProfile(containerID, publicURL string) error {
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider:    providerName,
+			ContainerID: containerID,
+			URL:         publicURL,
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return nil
+}
+
+func errorCleanup(containerID string) {
+	if err := local_registry.StopAndRemoveContainer(containerID); err != nil {
+		log.Printf("❌ failed to remove bore container, you will need to do this manually: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package bore
+
+import "testing"
+
+func TestPublicAddress(t *testing.T) {
+	for line, expected := range map[string]string{
+		"2024-08-01T10:00:00.000000Z  INFO bore_cli::client: connected to server remote_port=41234":                                                       "",
+		"2024-08-01T10:00:00.000000Z  INFO bore_cli::client: listening at bore.pub:41234":                                                                 "bore.pub:41234",
+		"\x1b[2m2024-08-01T10:00:00Z\x1b[0m \x1b[32m INFO\x1b[0m \x1b[2mbore_cli::client\x1b[0m\x1b[2m:\x1b[0m listening at bore.example.com:5000\x1b[0m": "bore.example.com:5000",
+		"2024-08-01T10:00:00.000000Z ERROR bore_cli::client: server error: port already in use":                                                           "",
+	} {
+		if address := publicAddress(line); address != expected {
+			t.Errorf("❌ %q: expected %q, got %q", line, expected, address)
+		}
+	}
+}
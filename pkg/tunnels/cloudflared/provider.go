@@ -0,0 +1,79 @@
+package cloudflared
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/docker/docker/client"
+)
+
+const providerName = "cloudflared"
+
+// logsTimeout is used by PublicURL as the URL is already present in logs of a running container
+const logsTimeout = 10 * time.Second
+
+// Provider exposes the local registry with Cloudflare Tunnel running in a Docker container
+type Provider struct{}
+
+func init() {
+	tunnels.Register(providerName, Provider{})
+}
+
+func (Provider) Start(config *parser.Config) error {
+	return RunCloudflaredTunnelContainer(config)
+}
+
+func (Provider) Stop(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := local_registry.StopAndRemoveContainer(profile.Tunnel.ContainerID); err != nil {
+		return fmt.Errorf("❌ failed to stop or remove tunnel container: %w", err)
+	}
+	return nil
+}
+
+// PublicURL returns the hostname of the named tunnel or reads quick tunnel URL from the container logs
+func (Provider) PublicURL(config *parser.Config) (string, error) {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return "", err
+	}
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	return getPublicURL(
+		context.Background(),
+		dockerClient,
+		profile.Tunnel.ContainerID,
+		logsTimeout,
+		getTunnelToken(config),
+		config.Tunnel.Provider.Cloudflared.Hostname,
+	)
+}
+
+// Health checks that cloudflared container is running and the registry is reachable through the tunnel
+func (Provider) Health(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := tunnels.CheckContainerRunning(profile.Tunnel.ContainerID); err != nil {
+		return err
+	}
+	return tunnels.CheckRegistryURL(profile.Tunnel.URL)
+}
+
+func loadTunnelProfile() (*parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil || profile.Tunnel.ContainerID == "" {
+		return nil, fmt.Errorf("❌ no cloudflared tunnel container found in profile")
+	}
+	return profile, nil
+}
@@ -1,7 +1,171 @@
 package cloudflared
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 
-func StartTunnel() {
-	fmt.Println("🌐 Hello, World!")
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// startTimeout is the time given to cloudflared to establish a connection with Cloudflare edge
+const startTimeout = 2 * time.Minute
+
+var (
+	// quickTunnelURL matches the URL of a quick tunnel printed by cloudflared on startup
+	quickTunnelURL = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+	// namedTunnelReady matches the log line printed once the named tunnel is connected to the edge
+	namedTunnelReady = regexp.MustCompile(`Registered tunnel connection`)
+)
+
+// RunCloudflaredTunnelContainer runs cloudflared in a Docker container on the registry network.
+// If tunnel token is provided named tunnel is run and its hostname is used as URL,
+// otherwise a quick tunnel is created and its trycloudflare.com URL is parsed from the container logs
+func RunCloudflaredTunnelContainer(config *parser.Config) error {
+	cloudflaredConfig := config.Tunnel.Provider.Cloudflared
+	token := getTunnelToken(config)
+	if err := validateTunnel(token, cloudflaredConfig.Hostname); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	networkID, err := tunnels.EnsureNetwork(ctx, dockerClient, cloudflaredConfig.NetworkName)
+	if err != nil {
+		return err
+	}
+	containerImage := fmt.Sprintf("%v:%v", cloudflaredConfig.Image, cloudflaredConfig.Tag)
+	if err := tunnels.PullImage(ctx, dockerClient, containerImage); err != nil {
+		return err
+	}
+
+	// Origin URL is used by quick tunnels and by locally managed named tunnels,
+	// remotely managed named tunnels must route their hostname to the same URL in Cloudflare dashboard
+	cmd := []string{
+		"tunnel",
+		"--no-autoupdate",
+		"--url", "http://" + tunnels.RegistryAddress(config),
+	}
+	var env []string
+	if token != "" {
+		cmd = append(cmd, "run")
+		env = append(env, "TUNNEL_TOKEN="+token)
+	}
+
+	resp, err := dockerClient.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image: containerImage,
+			Cmd:   cmd,
+			Env:   env,
+		},
+		&container.HostConfig{
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+			ExtraHosts:    tunnels.RegistryExtraHosts(config),
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkID: {},
+			},
+		},
+		nil,
+		cloudflaredConfig.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create container: %w", err)
+	}
+
+	if err := dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		errorCleanup(resp.ID)
+		return fmt.Errorf("❌ failed to start cloudflared container: %w", err)
+	}
+
+	publicURL, err := getPublicURL(ctx, dockerClient, resp.ID, startTimeout, token, cloudflaredConfig.Hostname)
+	if err != nil {
+		errorCleanup(resp.ID)
+		return err
+	}
+	log.Printf("✅ Cloudflare tunnel is running at %s", publicURL)
+
+	if err := writeToProfile(resp.ID, publicURL); err != nil {
+		errorCleanup(resp.ID)
+		return fmt.Errorf("❌ failed to write to profile: %w", err)
+	}
+	return nil
+}
+
+// getPublicURL waits for the tunnel to be connected and returns its public URL
+func getPublicURL(
+	ctx context.Context,
+	dockerClient *client.Client,
+	containerID string,
+	timeout time.Duration,
+	token, hostname string,
+) (string, error) {
+	if token == "" {
+		return tunnels.WaitForLogMatch(ctx, dockerClient, containerID, timeout, quickTunnelURL)
+	}
+	if _, err := tunnels.WaitForLogMatch(ctx, dockerClient, containerID, timeout, namedTunnelReady); err != nil {
+		return "", err
+	}
+	return namedTunnelURL(hostname), nil
+}
+
+// validateTunnel checks that a named tunnel has both the token and the hostname routed to it,
+// quick tunnels have neither
+func validateTunnel(token, hostname string) error {
+	if token != "" && hostname == "" {
+		return fmt.Errorf("❌ hostname must be specified for named cloudflared tunnel")
+	}
+	if token == "" && hostname != "" {
+		return fmt.Errorf("❌ hostname %s requires a named cloudflared tunnel, set its token or TUNNEL_TOKEN", hostname)
+	}
+	return nil
+}
+
+// namedTunnelURL returns the registry URL of the named tunnel routed to the hostname
+func namedTunnelURL(hostname string) string {
+	return "https://" + strings.TrimSuffix(strings.TrimPrefix(hostname, "https://"), "/")
+}
+
+// getTunnelToken returns named tunnel token from the config or from TUNNEL_TOKEN env variable
+func getTunnelToken(config *parser.Config) string {
+	if config.Tunnel.Provider.Cloudflared.Token != "" {
+		return config.Tunnel.Provider.Cloudflared.Token
+	}
+	return os.Getenv("TUNNEL_TOKEN")
+}
+
+// writeToProfile writes the container ID and tunnel URL to the profile
+func writeToProfile(containerID, publicURL string) error {
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider:    providerName,
+			ContainerID: containerID,
+			URL:         publicURL,
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return nil
+}
+
+func errorCleanup(containerID string) {
+	if err := local_registry.StopAndRemoveContainer(containerID); err != nil {
+		log.Printf("❌ failed to remove cloudflared container, you will need to do this manually: %v", err)
+	}
 }
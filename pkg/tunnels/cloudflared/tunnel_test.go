@@ -0,0 +1,46 @@
+package cloudflared
+
+import "testing"
+
+func TestQuickTunnelURL(t *testing.T) {
+	for line, expected := range map[string]string{
+		"INF |  https://seasonal-deck-organisms-sf.trycloudflare.com                                  |":     "https://seasonal-deck-organisms-sf.trycloudflare.com",
+		"INF Requesting new quick Tunnel on trycloudflare.com...":                                            "",
+		"INF +--------------------------------------------------------------------------------------------+": "",
+		"INF Registered tunnel connection connIndex=0 location=ams01 protocol=quic":                          "",
+	} {
+		if url := quickTunnelURL.FindString(line); url != expected {
+			t.Errorf("❌ %q: expected %q, got %q", line, expected, url)
+		}
+	}
+	if !namedTunnelReady.MatchString("INF Registered tunnel connection connIndex=0 location=ams01 protocol=quic") {
+		t.Error("❌ connection of the named tunnel is not detected")
+	}
+}
+
+func TestValidateTunnel(t *testing.T) {
+	for name, tc := range map[string]struct {
+		token, hostname string
+		valid           bool
+	}{
+		"quick tunnel":       {"", "", true},
+		"named tunnel":       {"eyJhIjoi", "registry.example.com", true},
+		"token without host": {"eyJhIjoi", "", false},
+		"host without token": {"", "registry.example.com", false},
+	} {
+		if err := validateTunnel(tc.token, tc.hostname); (err == nil) != tc.valid {
+			t.Errorf("❌ %s: expected valid %v, got %v", name, tc.valid, err)
+		}
+	}
+}
+
+func TestNamedTunnelURL(t *testing.T) {
+	for hostname, expected := range map[string]string{
+		"registry.example.com":          "https://registry.example.com",
+		"https://registry.example.com/": "https://registry.example.com",
+	} {
+		if url := namedTunnelURL(hostname); url != expected {
+			t.Errorf("❌ %s: expected %s, got %s", hostname, expected, url)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package tunnels
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Helpers shared by tunnel providers that run their agent in a Docker container
+// attached to the same network as the local registry
+
+// RegistryAddress returns the address of the registry container inside the tunnel network
+func RegistryAddress(config *parser.Config) string {
+	address, err := local_registry.ContainerAddress(config)
+	if err != nil {
+		// Unknown backend is reported when the registry is started, default registry port is used until then
+		return fmt.Sprintf("%v:%v", config.Registry.Name, "5000")
+	}
+	return address
+}
+
+// RegistryExtraHosts returns the hosts tunnel containers need to reach the registry
+func RegistryExtraHosts(config *parser.Config) []string {
+	return local_registry.ContainerExtraHosts(config)
+}
+
+// EnsureNetwork returns ID of the network with provided name and creates it if it doesn't exist
+func EnsureNetwork(ctx context.Context, dockerClient *client.Client, networkName string) (string, error) {
+	resp, err := dockerClient.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", networkName)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to list networks: %w", err)
+	}
+	if len(resp) != 0 {
+		return resp[0].ID, nil
+	}
+	netResp, err := dockerClient.NetworkCreate(ctx, networkName, network.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to create network: %w", err)
+	}
+	return netResp.ID, nil
+}
+
+// PullImage pulls the image and prints pull progress
+func PullImage(ctx context.Context, dockerClient *client.Client, imageRef string) error {
+	imagePuller, err := dockerClient.ImagePull(ctx, imageRef, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("❌ failed to pull %s image: %w", imageRef, err)
+	}
+	defer imagePuller.Close()
+	if err := local_registry.PrintLog(imagePuller); err != nil {
+		return fmt.Errorf("❌ failed to pull image: %w", err)
+	}
+	return nil
+}
+
+// ScanLogs follows logs of the container and passes each line to handle until it returns true.
+// Returns an error if the container stops or timeout is reached before that
+func ScanLogs(ctx context.Context, dockerClient *client.Client, containerID string, timeout time.Duration, handle func(line string) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logs, err := dockerClient.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to get container logs: %w", err)
+	}
+	defer logs.Close()
+
+	// Container logs are multiplexed as containers are run without TTY
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, logs)
+		writer.CloseWithError(err)
+	}()
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if handle(scanner.Text()) {
+			return nil
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("❌ timed out after %s waiting for container %s", timeout, containerID)
+	}
+	return fmt.Errorf("❌ container %s stopped before tunnel was ready", containerID)
+}
+
+// WaitForLogMatch returns the first match of the pattern in the container logs
+func WaitForLogMatch(ctx context.Context, dockerClient *client.Client, containerID string, timeout time.Duration, pattern *regexp.Regexp) (string, error) {
+	var match string
+	err := ScanLogs(ctx, dockerClient, containerID, timeout, func(line string) bool {
+		match = pattern.FindString(line)
+		return match != ""
+	})
+	return match, err
+}
+
+// CheckContainerRunning returns an error if the container is not running
+func CheckContainerRunning(containerID string) error {
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	containerInfo, err := dockerClient.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return fmt.Errorf("❌ failed to inspect tunnel container: %w", err)
+	}
+	if !containerInfo.State.Running {
+		return fmt.Errorf("❌ tunnel container is %s", containerInfo.State.Status)
+	}
+	return nil
+}
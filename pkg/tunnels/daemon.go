@@ -0,0 +1,81 @@
+package tunnels
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// Helpers shared by tunnel providers that keep the tunnel alive in a background locreg process.
+// The command starting the daemon records its PID in the profile and the daemon reports its state there
+
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+)
+
+// profileRetries is the number of attempts the daemon makes to find its PID in the profile,
+// as the profile is written by the command that started the daemon after it was spawned
+const profileRetries = 50
+
+// errTunnelNotRecorded is returned when the profile doesn't have the tunnel of the daemon yet
+var errTunnelNotRecorded = errors.New("tunnel is not recorded in profile")
+
+// UpdateDaemonTunnel applies update to the tunnel run by the daemon with provided PID and saves the profile.
+// The profile is updated under the profile lock, so registry updates made in the meantime are kept
+func UpdateDaemonTunnel(pid int, update func(tunnel *parser.Tunnel)) error {
+	for i := 0; i < profileRetries; i++ {
+		err := parser.Update(func(profile *parser.Profile) error {
+			if profile.Tunnel == nil || profile.Tunnel.PID != pid {
+				return errTunnelNotRecorded
+			}
+			update(profile.Tunnel)
+			return nil
+		})
+		if !errors.Is(err, errTunnelNotRecorded) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("❌ tunnel with PID %d is not found in profile", pid)
+}
+
+// WaitForDaemon waits until the daemon with provided PID reports that the tunnel is connected
+// and its URL is known, returns the tunnel recorded in the profile
+func WaitForDaemon(pid int, daemonName string, timeout time.Duration) (*parser.Tunnel, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !daemon.IsRunning(pid) {
+			return nil, fmt.Errorf("❌ %s daemon exited, see %s", daemonName, daemonLogHint(daemonName))
+		}
+		profile, _ := parser.LoadProfileData()
+		if profile != nil && profile.Tunnel != nil && profile.Tunnel.PID == pid &&
+			profile.Tunnel.State == StateConnected && profile.Tunnel.URL != "" {
+			return profile.Tunnel, nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("❌ %s tunnel was not connected in %s, see %s", daemonName, timeout, daemonLogHint(daemonName))
+}
+
+// CheckDaemonTunnel returns an error if the daemon running the tunnel is not running or not connected
+func CheckDaemonTunnel(tunnel *parser.Tunnel) error {
+	if !daemon.IsRunning(tunnel.PID) {
+		return fmt.Errorf("❌ tunnel daemon with PID %d is not running", tunnel.PID)
+	}
+	if tunnel.State != StateConnected {
+		return fmt.Errorf("❌ tunnel is %s", tunnel.State)
+	}
+	return nil
+}
+
+func daemonLogHint(daemonName string) string {
+	logPath, err := daemon.LogPath(daemonName)
+	if err != nil {
+		return "daemon logs"
+	}
+	return logPath
+}
@@ -0,0 +1,75 @@
+package microsoft_dev_tunnels
+
+import (
+	"fmt"
+
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+)
+
+const providerName = "microsoftDevTunnels"
+
+// Provider exposes the local registry with Microsoft Dev Tunnels using devtunnel CLI running in a Docker container
+type Provider struct{}
+
+func init() {
+	tunnels.Register(providerName, Provider{})
+}
+
+func (Provider) Start(config *parser.Config) error {
+	return RunDevTunnelContainer(config)
+}
+
+// Stop deletes the dev tunnel and removes the container hosting it
+func (Provider) Stop(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if profile.Tunnel.TunnelID != "" {
+		if err := deleteTunnel(profile.Tunnel.ContainerID, profile.Tunnel.TunnelID); err != nil {
+			return err
+		}
+	}
+	if err := local_registry.StopAndRemoveContainer(profile.Tunnel.ContainerID); err != nil {
+		return fmt.Errorf("❌ failed to stop or remove tunnel container: %w", err)
+	}
+	return nil
+}
+
+// PublicURL returns the URL of the dev tunnel recorded in the profile, it doesn't change while the tunnel exists
+func (Provider) PublicURL(_ *parser.Config) (string, error) {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return "", err
+	}
+	return profile.Tunnel.URL, nil
+}
+
+// Health checks that devtunnel container is running and the registry is reachable through the tunnel
+func (Provider) Health(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := tunnels.CheckContainerRunning(profile.Tunnel.ContainerID); err != nil {
+		return err
+	}
+	return tunnels.CheckRegistryURL(profile.Tunnel.URL)
+}
+
+// CheckDeploy refuses deployments through the dev tunnel. Anonymous access to it is disabled, and cloud runtimes
+// can't send the X-Tunnel-Authorization access token, so the deployed resources would never pull the image
+func (Provider) CheckDeploy(_ *parser.Config) error {
+	return fmt.Errorf("❌ cloud runtimes can't pull through Microsoft Dev Tunnels as anonymous access is disabled, " +
+		"use another tunnel provider to deploy")
+}
+
+func loadTunnelProfile() (*parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil || profile.Tunnel.ContainerID == "" {
+		return nil, fmt.Errorf("❌ no devtunnel container found in profile")
+	}
+	return profile, nil
+}
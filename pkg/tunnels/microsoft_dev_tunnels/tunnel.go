@@ -1,7 +1,244 @@
 package microsoft_dev_tunnels
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
 
-func StartTunnel() {
-	fmt.Println("🌐 Starting Microsoft Dev Tunnel...")
+	"github.com/Uitware/locreg/pkg/local_registry"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// startTimeout includes the time needed to install the CLI and to sign in with the device code
+	startTimeout = 5 * time.Minute
+	// deleteTimeout bounds `devtunnel delete`, which may hang on the network or waiting for a login
+	deleteTimeout = time.Minute
+	// homeDir is mounted to the login volume, so the CLI and the login token are kept between runs
+	homeDir = "/root"
+	// registryPort is the port registry listens on inside its container and the port exposed by the tunnel
+	registryPort = "5000"
+	// tunnelIDPrefix is printed by the entrypoint script once the tunnel is created
+	tunnelIDPrefix = "locreg tunnel id: "
+)
+
+var (
+	// publicURL matches the URL of the hosted port, inspection URL has `-inspect` suffix and is not matched
+	publicURL = regexp.MustCompile(`https://[a-z0-9-]+-` + registryPort + `\.[a-z0-9]+\.devtunnels\.ms`)
+	// deviceLogin matches the instructions printed by `devtunnel user login -d`
+	deviceLogin = regexp.MustCompile(`microsoft\.com/devicelogin`)
+	// sha256Hex matches a hex-encoded SHA-256 digest
+	sha256Hex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+// entrypoint downloads the pinned devtunnel CLI to the login volume once and verifies its checksum on every start,
+// signs in with device code if needed, creates a tunnel once per container and hosts it.
+// Tunnel is created without `--allow-anonymous`, so anonymous access to it is disabled.
+// devtunnel can only forward ports on localhost, so socat from the signed apt repositories of the image
+// is used to forward them to the registry container
+const entrypoint = `set -e
+export PATH="$HOME/bin:$PATH"
+if ! command -v socat >/dev/null 2>&1; then
+  apt-get update -qq && apt-get install -y -qq socat >/dev/null
+fi
+if ! echo "$CLI_SHA256  $HOME/bin/devtunnel" | sha256sum -c --status 2>/dev/null; then
+  mkdir -p "$HOME/bin"
+  curl -fsSL "$CLI_URL" -o /tmp/devtunnel
+  echo "$CLI_SHA256  /tmp/devtunnel" | sha256sum -c --status || { echo "devtunnel CLI checksum mismatch"; exit 1; }
+  install -m 755 /tmp/devtunnel "$HOME/bin/devtunnel"
+fi
+devtunnel user show >/dev/null 2>&1 || devtunnel user login -d
+ID_FILE=/var/lib/locreg-tunnel-id
+if [ ! -s "$ID_FILE" ]; then
+  devtunnel create | sed -n 's/^Tunnel ID *: *//p' > "$ID_FILE"
+  [ -s "$ID_FILE" ] || { echo "failed to create dev tunnel"; exit 1; }
+  devtunnel port create "$(cat "$ID_FILE")" -p "$REGISTRY_PORT"
+fi
+echo "` + tunnelIDPrefix + `$(cat "$ID_FILE")"
+socat TCP-LISTEN:"$REGISTRY_PORT",fork,reuseaddr TCP:"$REGISTRY_ADDRESS" &
+exec devtunnel host "$(cat "$ID_FILE")"
+`
+
+// RunDevTunnelContainer runs devtunnel CLI in a Docker container on the registry network
+// and hosts a dev tunnel forwarding traffic to the registry
+func RunDevTunnelContainer(config *parser.Config) error {
+	if err := validateConfig(config); err != nil {
+		return err
+	}
+	devTunnelConfig := config.Tunnel.Provider.MicrosoftDevTunnels
+	ctx := context.Background()
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	networkID, err := tunnels.EnsureNetwork(ctx, dockerClient, devTunnelConfig.NetworkName)
+	if err != nil {
+		return err
+	}
+	containerImage := fmt.Sprintf("%v:%v", devTunnelConfig.Image, devTunnelConfig.Tag)
+	if err := tunnels.PullImage(ctx, dockerClient, containerImage); err != nil {
+		return err
+	}
+
+	resp, err := dockerClient.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image:      containerImage,
+			Entrypoint: []string{"/bin/bash", "-c", entrypoint},
+			User:       "root",
+			Env: []string{
+				"HOME=" + homeDir,
+				"REGISTRY_PORT=" + registryPort,
+				"REGISTRY_ADDRESS=" + tunnels.RegistryAddress(config),
+				"CLI_URL=" + devTunnelConfig.CLIURL,
+				"CLI_SHA256=" + strings.ToLower(devTunnelConfig.CLISHA256),
+			},
+		},
+		&container.HostConfig{
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+			ExtraHosts:    tunnels.RegistryExtraHosts(config),
+			Mounts: []mount.Mount{
+				{
+					Type:   mount.TypeVolume,
+					Source: devTunnelConfig.LoginVolume,
+					Target: homeDir,
+				},
+			},
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkID: {},
+			},
+		},
+		nil,
+		devTunnelConfig.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("❌ failed to create container: %w", err)
+	}
+
+	if err := dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		errorCleanup(resp.ID, "")
+		return fmt.Errorf("❌ failed to start devtunnel container: %w", err)
+	}
+
+	tunnelID, url, err := waitForTunnel(ctx, dockerClient, resp.ID, startTimeout)
+	if err != nil {
+		errorCleanup(resp.ID, tunnelID)
+		return err
+	}
+	log.Printf("✅ Microsoft Dev Tunnel %s is running at %s", tunnelID, url)
+	log.Printf("Anonymous access to the tunnel is disabled, so cloud runtimes can't pull through it and locreg deploy is refused")
+
+	if err := writeToProfile(resp.ID, tunnelID, url); err != nil {
+		errorCleanup(resp.ID, tunnelID)
+		return fmt.Errorf("❌ failed to write to profile: %w", err)
+	}
+	return nil
+}
+
+// validateConfig checks that the devtunnel CLI is pinned to a release with its checksum,
+// so a CLI replaced on the download server is never run with the Microsoft account login
+func validateConfig(config *parser.Config) error {
+	devTunnelConfig := config.Tunnel.Provider.MicrosoftDevTunnels
+	if !strings.HasPrefix(devTunnelConfig.CLIURL, "https://") {
+		return fmt.Errorf("❌ tunnel.provider.microsoftDevTunnels.cliUrl must be the https download URL of a devtunnel CLI release")
+	}
+	if !sha256Hex.MatchString(strings.ToLower(devTunnelConfig.CLISHA256)) {
+		return fmt.Errorf("❌ tunnel.provider.microsoftDevTunnels.cliSha256 must be the hex SHA-256 of the devtunnel CLI")
+	}
+	return nil
+}
+
+// waitForTunnel reads tunnel ID and public URL from the container logs.
+// Device code sign in instructions are relayed to the user as the container isn't attached to the terminal
+func waitForTunnel(ctx context.Context, dockerClient *client.Client, containerID string, timeout time.Duration) (string, string, error) {
+	var tunnelID, url string
+	err := tunnels.ScanLogs(ctx, dockerClient, containerID, timeout, func(line string) bool {
+		switch {
+		case deviceLogin.MatchString(line):
+			log.Printf("🔑 %s", strings.TrimSpace(line))
+		case strings.HasPrefix(line, tunnelIDPrefix):
+			tunnelID = strings.TrimSpace(strings.TrimPrefix(line, tunnelIDPrefix))
+		case url == "":
+			url = publicURL.FindString(line)
+		}
+		return tunnelID != "" && url != ""
+	})
+	return tunnelID, url, err
+}
+
+// deleteTunnel deletes the dev tunnel using the CLI in the running container
+func deleteTunnel(containerID, tunnelID string) error {
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+	defer cancel()
+	execResp, err := dockerClient.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd: []string{homeDir + "/bin/devtunnel", "delete", tunnelID, "-f"},
+		Env: []string{"HOME=" + homeDir},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to create exec for tunnel deletion: %w", err)
+	}
+	if err := dockerClient.ContainerExecStart(ctx, execResp.ID, container.ExecStartOptions{}); err != nil {
+		return fmt.Errorf("❌ failed to delete dev tunnel: %w", err)
+	}
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inspect, err := dockerClient.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return fmt.Errorf("❌ failed to inspect tunnel deletion: %w", err)
+		}
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return fmt.Errorf("❌ devtunnel delete exited with code %d", inspect.ExitCode)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("❌ devtunnel delete did not finish within %s", deleteTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeToProfile writes the container ID, tunnel ID and tunnel URL to the profile
+func writeToProfile(containerID, tunnelID, url string) error {
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider:    providerName,
+			ContainerID: containerID,
+			TunnelID:    tunnelID,
+			URL:         url,
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return nil
+}
+
+func errorCleanup(containerID, tunnelID string) {
+	if tunnelID != "" {
+		if err := deleteTunnel(containerID, tunnelID); err != nil {
+			log.Printf("❌ failed to delete dev tunnel %s, you will need to do this manually: %v", tunnelID, err)
+		}
+	}
+	if err := local_registry.StopAndRemoveContainer(containerID); err != nil {
+		log.Printf("❌ failed to remove devtunnel container, you will need to do this manually: %v", err)
+	}
 }
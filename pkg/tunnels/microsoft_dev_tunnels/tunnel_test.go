@@ -0,0 +1,50 @@
+package microsoft_dev_tunnels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestPublicURL(t *testing.T) {
+	for line, expected := range map[string]string{
+		"Connect via browser: https://abc123x4-5000.euw.devtunnels.ms":                                     "https://abc123x4-5000.euw.devtunnels.ms",
+		"Connect via browser: https://abc123x4.euw.devtunnels.ms, https://abc123x4-5000.euw.devtunnels.ms": "https://abc123x4-5000.euw.devtunnels.ms",
+		"Inspect network activity: https://abc123x4-5000-inspect.euw.devtunnels.ms":                        "",
+		"Connect via browser: https://abc123x4-8080.euw.devtunnels.ms":                                     "",
+		"Hosting port: 5000": "",
+	} {
+		if url := publicURL.FindString(line); url != expected {
+			t.Errorf("❌ %q: expected %q, got %q", line, expected, url)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	checksum := strings.Repeat("ab", 32)
+	for name, tc := range map[string]struct {
+		url, checksum string
+		valid         bool
+	}{
+		"pinned":             {"https://example.com/devtunnel", checksum, true},
+		"uppercase checksum": {"https://example.com/devtunnel", strings.ToUpper(checksum), true},
+		"no url":             {"", checksum, false},
+		"plain http":         {"http://example.com/devtunnel", checksum, false},
+		"no checksum":        {"https://example.com/devtunnel", "", false},
+		"short checksum":     {"https://example.com/devtunnel", checksum[:40], false},
+	} {
+		config := &parser.Config{}
+		config.Tunnel.Provider.MicrosoftDevTunnels.CLIURL = tc.url
+		config.Tunnel.Provider.MicrosoftDevTunnels.CLISHA256 = tc.checksum
+		if err := validateConfig(config); (err == nil) != tc.valid {
+			t.Errorf("❌ %s: expected valid %v, got %v", name, tc.valid, err)
+		}
+	}
+}
+
+func TestCheckDeploy(t *testing.T) {
+	if err := (Provider{}).CheckDeploy(&parser.Config{}); err == nil {
+		t.Error("❌ deploy through a dev tunnel without anonymous access is allowed")
+	}
+}
@@ -8,19 +8,11 @@ import (
 )
 
 func DestroyTunnel() error {
-	profilePath, err := parser.GetProfilePath()
-	if err != nil {
-		return fmt.Errorf("❌ failed to get profile path: %w", err)
-	}
-	profile, err := parser.LoadOrCreateProfile(profilePath)
-	if err != nil {
-		return fmt.Errorf("❌ failed to load or create profile: %w", err)
-	}
-
-	if profile.Tunnel.ContainerID == "" {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil || profile.Tunnel.ContainerID == "" {
 		return fmt.Errorf("❌ no tunnel container running found found in profile")
 	}
-	err = local_registry.StopAndRemoveContainer(profile.Tunnel.ContainerID)
+	err := local_registry.StopAndRemoveContainer(profile.Tunnel.ContainerID)
 	if err != nil {
 		return fmt.Errorf("❌ failed to stop or remove tunnel container: %w", err)
 	}
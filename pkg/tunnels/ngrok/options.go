@@ -0,0 +1,72 @@
+package ngrok
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"golang.ngrok.com/ngrok"
+	ngrokconfig "golang.ngrok.com/ngrok/config"
+)
+
+// agentArgs returns ngrok agent command line forwarding traffic to the registry with the configured domain,
+// region and edge policy
+func agentArgs(config *parser.Config) ([]string, error) {
+	if err := validatePolicy(config); err != nil {
+		return nil, err
+	}
+	ngrokConfig := config.Tunnel.Provider.Ngrok
+	args := []string{
+		"http",
+		// Forward traffic to registry on registry port
+		tunnels.RegistryAddress(config),
+	}
+	if ngrokConfig.Domain != "" {
+		args = append(args, "--domain", ngrokConfig.Domain)
+	}
+	if ngrokConfig.Region != "" {
+		args = append(args, "--region", ngrokConfig.Region)
+	}
+	for _, cidr := range ngrokConfig.Policy.AllowCIDR {
+		args = append(args, "--cidr-allow", cidr)
+	}
+	for _, cidr := range ngrokConfig.Policy.DenyCIDR {
+		args = append(args, "--cidr-deny", cidr)
+	}
+	return args, nil
+}
+
+// endpointOptions returns ngrok-go options matching the agent command line built by agentArgs
+func endpointOptions(config *parser.Config) ([]ngrokconfig.HTTPEndpointOption, []ngrok.ConnectOption, error) {
+	if err := validatePolicy(config); err != nil {
+		return nil, nil, err
+	}
+	ngrokConfig := config.Tunnel.Provider.Ngrok
+	var endpointOpts []ngrokconfig.HTTPEndpointOption
+	if ngrokConfig.Domain != "" {
+		endpointOpts = append(endpointOpts, ngrokconfig.WithDomain(ngrokConfig.Domain))
+	}
+	if len(ngrokConfig.Policy.AllowCIDR) != 0 {
+		endpointOpts = append(endpointOpts, ngrokconfig.WithAllowCIDRString(ngrokConfig.Policy.AllowCIDR...))
+	}
+	if len(ngrokConfig.Policy.DenyCIDR) != 0 {
+		endpointOpts = append(endpointOpts, ngrokconfig.WithDenyCIDRString(ngrokConfig.Policy.DenyCIDR...))
+	}
+	var connectOpts []ngrok.ConnectOption
+	if ngrokConfig.Region != "" {
+		connectOpts = append(connectOpts, ngrok.WithRegion(ngrokConfig.Region))
+	}
+	return endpointOpts, connectOpts, nil
+}
+
+// validatePolicy checks edge policy before it is passed to ngrok, as the agent only reports errors in its logs
+func validatePolicy(config *parser.Config) error {
+	policy := config.Tunnel.Provider.Ngrok.Policy
+	for _, cidr := range append(append([]string{}, policy.AllowCIDR...), policy.DenyCIDR...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("❌ invalid ngrok policy CIDR %q: %w", cidr, err)
+		}
+	}
+	return nil
+}
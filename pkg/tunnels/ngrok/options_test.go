@@ -0,0 +1,44 @@
+package ngrok
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+func TestAgentArgs(t *testing.T) {
+	config := &parser.Config{}
+	config.Registry.Name = "locreg-registry"
+	config.Tunnel.Provider.Ngrok.Domain = "locreg.ngrok.app"
+	config.Tunnel.Provider.Ngrok.Region = "eu"
+	config.Tunnel.Provider.Ngrok.Policy.AllowCIDR = []string{"10.0.0.0/8"}
+	config.Tunnel.Provider.Ngrok.Policy.DenyCIDR = []string{"10.1.0.0/16"}
+
+	args, err := agentArgs(config)
+	if err != nil {
+		t.Fatalf("❌ failed to build agent args: %v", err)
+	}
+	expected := []string{
+		"http", "locreg-registry:5000",
+		"--domain", "locreg.ngrok.app",
+		"--region", "eu",
+		"--cidr-allow", "10.0.0.0/8",
+		"--cidr-deny", "10.1.0.0/16",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("❌ unexpected agent args: %v", args)
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	for name, policy := range map[string]func(config *parser.Config){
+		"invalid CIDR": func(c *parser.Config) { c.Tunnel.Provider.Ngrok.Policy.DenyCIDR = []string{"10.0.0.1"} },
+	} {
+		config := &parser.Config{}
+		policy(config)
+		if err := validatePolicy(config); err == nil {
+			t.Errorf("❌ invalid policy is accepted: %s", name)
+		}
+	}
+}
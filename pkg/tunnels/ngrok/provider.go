@@ -0,0 +1,63 @@
+package ngrok
+
+import (
+	"fmt"
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"strconv"
+)
+
+const providerName = "ngrok"
+
+// Provider exposes the local registry with ngrok agent running in a Docker container
+// or in a background locreg process if `mode: sdk` is set
+type Provider struct{}
+
+func init() {
+	tunnels.Register(providerName, Provider{})
+}
+
+func (Provider) Start(config *parser.Config) error {
+	if !config.IsNgrokConfigured() {
+		return fmt.Errorf("❌ ngrok tunnel is not fully configured")
+	}
+	if config.Tunnel.Provider.Ngrok.Mode == modeSDK {
+		return RunNgrokSDKTunnel(config)
+	}
+	return RunNgrokTunnelContainer(config)
+}
+
+func (Provider) Stop(_ *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if profile != nil && profile.Tunnel != nil && profile.Tunnel.PID != 0 {
+		return daemon.Stop(profile.Tunnel.PID)
+	}
+	return DestroyTunnel()
+}
+
+// PublicURL returns the URL reported by ngrok agent API of the running container,
+// the URL of the tunnel run by the daemon is recorded in the profile
+func (Provider) PublicURL(config *parser.Config) (string, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile != nil && profile.Tunnel != nil && profile.Tunnel.PID != 0 {
+		return profile.Tunnel.URL, nil
+	}
+	return getPublicURL(strconv.Itoa(config.Tunnel.Provider.Ngrok.Port))
+}
+
+// Health checks that ngrok container or daemon is running and the registry is reachable through the tunnel
+func (Provider) Health(_ *parser.Config) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil {
+		return fmt.Errorf("❌ tunnel does not exist")
+	}
+	if profile.Tunnel.PID != 0 {
+		if err := tunnels.CheckDaemonTunnel(profile.Tunnel); err != nil {
+			return err
+		}
+	} else if err := tunnels.CheckContainerRunning(profile.Tunnel.ContainerID); err != nil {
+		return err
+	}
+	return tunnels.CheckRegistryURL(profile.Tunnel.URL)
+}
@@ -0,0 +1,128 @@
+package ngrok
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"golang.ngrok.com/ngrok"
+	ngrokconfig "golang.ngrok.com/ngrok/config"
+)
+
+const (
+	// modeSDK runs ngrok agent in-process with ngrok-go in a background locreg process instead of a container
+	modeSDK = "sdk"
+	// daemonName is the name of the background process keeping ngrok session alive
+	daemonName = "ngrok"
+	// connectTimeout is the time given to the daemon to establish ngrok session
+	connectTimeout = 30 * time.Second
+)
+
+// DaemonArgs are the locreg arguments that run the ngrok daemon
+var DaemonArgs = []string{"tunnel", "ngrok-daemon"}
+
+// RunNgrokSDKTunnel starts the daemon forwarding ngrok tunnel to the registry
+// and waits until it reports the tunnel URL
+func RunNgrokSDKTunnel(config *parser.Config) error {
+	if !validateNgrokAuthtokens() {
+		return fmt.Errorf("❌ NGROK_AUTHTOKEN is not valid")
+	}
+	if err := validatePolicy(config); err != nil {
+		return err
+	}
+	pid, err := daemon.Spawn(daemonName, DaemonArgs...)
+	if err != nil {
+		return err
+	}
+	err = parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider: providerName,
+			PID:      pid,
+		}
+		return nil
+	})
+	if err != nil {
+		sdkErrorCleanup(pid)
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	tunnel, err := tunnels.WaitForDaemon(pid, daemonName, connectTimeout)
+	if err != nil {
+		sdkErrorCleanup(pid)
+		return err
+	}
+	log.Printf("✅ ngrok tunnel is running at %s", tunnel.URL)
+	return nil
+}
+
+// RunDaemon forwards ngrok tunnel to the registry port until SIGTERM or SIGINT is received.
+// The tunnel URL is obtained when the tunnel is created and recorded in the profile with the session state,
+// ngrok-go reconnects the session by itself when it is lost
+func RunDaemon(config *parser.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	pid := os.Getpid()
+	setState := func(state string) {
+		err := tunnels.UpdateDaemonTunnel(pid, func(tunnel *parser.Tunnel) {
+			tunnel.State = state
+		})
+		if err != nil {
+			log.Printf("❌ failed to record tunnel state: %v", err)
+		}
+	}
+
+	endpointOpts, connectOpts, err := endpointOptions(config)
+	if err != nil {
+		return err
+	}
+	backend := &url.URL{
+		Scheme: "http",
+		Host:   "localhost:" + strconv.Itoa(config.Registry.Port),
+	}
+	connectOpts = append(connectOpts,
+		ngrok.WithAuthtokenFromEnv(),
+		ngrok.WithDisconnectHandler(func(_ context.Context, _ ngrok.Session, err error) {
+			if err != nil && ctx.Err() == nil {
+				log.Printf("❌ ngrok session lost: %v", err)
+				setState(tunnels.StateReconnecting)
+			}
+		}),
+		ngrok.WithConnectHandler(func(_ context.Context, _ ngrok.Session) {
+			setState(tunnels.StateConnected)
+		}),
+	)
+	forwarder, err := ngrok.ListenAndForward(ctx, backend, ngrokconfig.HTTPEndpoint(endpointOpts...), connectOpts...)
+	if err != nil {
+		return fmt.Errorf("❌ failed to start ngrok tunnel: %w", err)
+	}
+	defer forwarder.Close()
+
+	err = tunnels.UpdateDaemonTunnel(pid, func(tunnel *parser.Tunnel) {
+		tunnel.URL = forwarder.URL()
+		tunnel.State = tunnels.StateConnected
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ Forwarding %s to %s", forwarder.URL(), backend)
+
+	if err := forwarder.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("❌ ngrok tunnel stopped: %w", err)
+	}
+	return nil
+}
+
+func sdkErrorCleanup(pid int) {
+	if err := daemon.Stop(pid); err != nil {
+		log.Printf("❌ failed to stop ngrok daemon, you will need to do this manually: %v", err)
+	}
+}
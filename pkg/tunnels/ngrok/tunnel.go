@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/Uitware/locreg/pkg/local_registry"
 	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
@@ -29,19 +30,23 @@ type Tunnels struct {
 }
 
 // RunNgrokTunnelContainer runs a Docker container with ngrok image for tunneling local registry
-func RunNgrokTunnelContainer(config *parser.Config) {
+func RunNgrokTunnelContainer(config *parser.Config) error {
 	if !validateNgrokAuthtokens() {
-		return
+		return fmt.Errorf("❌ NGROK_AUTHTOKEN is not valid")
+	}
+	cmd, err := agentArgs(config)
+	if err != nil {
+		return err
 	}
 	ctx := context.Background()
 	containerImage := fmt.Sprintf("%v:%v", config.Tunnel.Provider.Ngrok.Image, config.Tunnel.Provider.Ngrok.Tag)
 	port, err := nat.NewPort("tcp", "4040")
 	if err != nil {
-		log.Fatalf("❌ failed to run on port: %v", err)
+		return fmt.Errorf("❌ failed to run on port: %w", err)
 	}
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		log.Fatalf("❌ failed to create Docker client: %v", err)
+		return fmt.Errorf("❌ failed to create Docker client: %w", err)
 	}
 
 	portBindings := nat.PortMap{ // Container port bindings
@@ -61,28 +66,24 @@ func RunNgrokTunnelContainer(config *parser.Config) {
 			network.CreateOptions{},
 		)
 		if err != nil {
-			log.Fatalf("❌ failed to create network: %v", err)
+			return fmt.Errorf("❌ failed to create network: %w", err)
 		}
 		networkID = netResp.ID
 	}
 	// Create container
 	imagePuller, err := dockerClient.ImagePull(ctx, containerImage, image.PullOptions{})
 	if err != nil {
-		log.Fatalf("❌ failed to pull ngrok image: %v", err)
+		return fmt.Errorf("❌ failed to pull ngrok image: %w", err)
 	}
 	if err := local_registry.PrintLog(imagePuller); err != nil {
-		log.Fatalf("❌ failed to pull image: %v", err)
+		return fmt.Errorf("❌ failed to pull image: %w", err)
 	}
 
 	resp, err := dockerClient.ContainerCreate(
 		ctx,
 		&container.Config{
 			Image: containerImage,
-			Cmd: []string{
-				"http",
-				// Forward traffic to registry on registry port
-				fmt.Sprintf("%v:%v", config.Registry.Name, "5000"),
-			},
+			Cmd:   cmd,
 			Env: []string{
 				"NGROK_AUTHTOKEN=" + os.Getenv("NGROK_AUTHTOKEN"),
 			},
@@ -92,6 +93,7 @@ func RunNgrokTunnelContainer(config *parser.Config) {
 		},
 		&container.HostConfig{
 			PortBindings: portBindings, // expose port 4040 for accessing ngrok api
+			ExtraHosts:   tunnels.RegistryExtraHosts(config),
 		},
 		&network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
@@ -102,53 +104,63 @@ func RunNgrokTunnelContainer(config *parser.Config) {
 		config.Tunnel.Provider.Ngrok.Name,
 	)
 	if err != nil {
-		log.Fatalf("❌ failed to create container: %v", err)
+		return fmt.Errorf("❌ failed to create container: %w", err)
 	}
 
 	if err = dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		defer errorCleanup(resp.ID, err)
-		log.Printf("❌ failed to start ngrok container: %v", err)
+		return fmt.Errorf("❌ failed to start ngrok container: %w", err)
 	}
 	if err = writeToProfile(resp.ID, strconv.Itoa(config.Tunnel.Provider.Ngrok.Port)); err != nil {
 		defer errorCleanup(resp.ID, err)
-		log.Fatalf("❌ failed to write to profile: %v", err)
+		return fmt.Errorf("❌ failed to write to profile: %w", err)
 	}
+	return nil
 }
 
 // writeToProfile writes the container ID and credentials to the profile file in TOML format
 func writeToProfile(dockerID string, port string) error {
-	var tunnelsResponse Tunnels
-	var resp *http.Response
-	profilePath, err := parser.GetProfilePath()
+	publicURL, err := getPublicURL(port)
 	if err != nil {
-		return fmt.Errorf("❌ failed to get profile path: %w", err)
+		return err
 	}
-	profile, err := parser.LoadOrCreateProfile(profilePath)
+	err = parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider:    providerName,
+			ContainerID: dockerID,
+			URL:         publicURL,
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("❌ failed to load or create profile: %w", err)
+		return fmt.Errorf("❌ failed to save profile: %w", err)
 	}
-	// Get tunnel URL from ngrok container API
+	return nil
+}
+
+// getPublicURL retrieves tunnel URL from ngrok container API, waiting for the agent to start
+func getPublicURL(port string) (string, error) {
+	var lastErr error
 	for i := 0; i < 5; i++ {
-		resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%s/api/tunnels", port))
+		time.Sleep(time.Duration(i) * time.Second) // Wait for agent to start before retrying
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/api/tunnels", port))
 		if err != nil {
-			time.Sleep(time.Duration(i) * time.Second) // Wait for 5 seconds before retrying
+			lastErr = err
 			continue
 		}
-		break
-	}
-	err = json.NewDecoder(resp.Body).Decode(&tunnelsResponse)
-	if err != nil {
-		return fmt.Errorf("❌ failed to decode response body: %w", err)
-	}
-	// write to profile
-	profile.Tunnel = &parser.Tunnel{
-		ContainerID: dockerID,
-		URL:         tunnelsResponse.Tunnels[0].PublicURL,
-	}
-	if err := parser.SaveProfile(profile, profilePath); err != nil {
-		return fmt.Errorf("❌ failed to save profile: %w", err)
+		var tunnelsResponse Tunnels
+		err = json.NewDecoder(resp.Body).Decode(&tunnelsResponse)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("❌ failed to decode response body: %w", err)
+		}
+		if len(tunnelsResponse.Tunnels) == 0 {
+			lastErr = fmt.Errorf("no tunnels started yet")
+			continue
+		}
+		return tunnelsResponse.Tunnels[0].PublicURL, nil
 	}
-	return nil
+	return "", fmt.Errorf("❌ failed to get tunnel URL from ngrok agent: %w", lastErr)
 }
 
 func getNetworkID(dockerClient *client.Client, networkName string) string {
@@ -69,7 +69,9 @@ func getProfile(t *testing.T) *parser.Profile {
 
 func createTunnel(t *testing.T) {
 	config := getConfig(t)
-	RunNgrokTunnelContainer(config)
+	if err := RunNgrokTunnelContainer(config); err != nil {
+		t.Fatalf("❌ failed to run ngrok tunnel: %v", err)
+	}
 	openDummyPort(t)
 	t.Cleanup(
 		func() {
@@ -0,0 +1,134 @@
+package ssh_reverse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/crypto/ssh"
+)
+
+// keepaliveInterval is the interval of keepalive requests used to detect a dead connection to the SSH server
+const keepaliveInterval = 30 * time.Second
+
+// Options describe a reverse forward from the remote address on the SSH server to the local address
+type Options struct {
+	ServerAddress string
+	ClientConfig  *ssh.ClientConfig
+	RemoteAddress string
+	LocalAddress  string
+}
+
+// Forward connects to the SSH server, asks it to listen on the remote address and forwards every
+// accepted connection to the local address, like `ssh -R` does. ready is called with the address
+// of the remote listener once forwarding is set up. Forward returns when ctx is done or the connection is lost
+func Forward(ctx context.Context, opts Options, ready func(net.Addr)) error {
+	client, err := ssh.Dial("tcp", opts.ServerAddress, opts.ClientConfig)
+	if err != nil {
+		return fmt.Errorf("❌ failed to connect to SSH server %s: %w", opts.ServerAddress, err)
+	}
+	defer client.Close()
+
+	listener, err := client.Listen("tcp", opts.RemoteAddress)
+	if err != nil {
+		return fmt.Errorf("❌ failed to listen on %s on SSH server: %w", opts.RemoteAddress, err)
+	}
+	defer listener.Close()
+	if ready != nil {
+		ready(listener.Addr())
+	}
+
+	// Connection is closed on cancellation or dead connection to unblock Accept
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(keepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				client.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+					client.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		remoteConn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("❌ SSH connection lost: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			forwardConnection(remoteConn, opts.LocalAddress)
+		}()
+	}
+}
+
+// forwardConnection copies data between the forwarded connection and a new connection to the local address
+func forwardConnection(remoteConn net.Conn, localAddress string) {
+	defer remoteConn.Close()
+	localConn, err := net.Dial("tcp", localAddress)
+	if err != nil {
+		log.Printf("❌ failed to connect to %s: %v", localAddress, err)
+		return
+	}
+	defer localConn.Close()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(localConn, remoteConn)
+		errs <- err
+	}()
+	go func() {
+		_, err := io.Copy(remoteConn, localConn)
+		errs <- err
+	}()
+	// Either side closing the connection ends forwarding, deferred closes unblock the other copy
+	<-errs
+}
+
+// Supervise keeps the reverse forward running, reconnecting with exponential backoff when the connection is lost.
+// onState is called with tunnels.StateConnected or tunnels.StateReconnecting on every state change. Supervise returns when ctx is done
+func Supervise(ctx context.Context, opts Options, onState func(state string)) error {
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxInterval = time.Minute
+	retry.MaxElapsedTime = 0 // Retry until stopped
+	for {
+		err := Forward(ctx, opts, func(addr net.Addr) {
+			retry.Reset()
+			log.Printf("✅ Forwarding %s on SSH server to %s", addr, opts.LocalAddress)
+			onState(tunnels.StateConnected)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		onState(tunnels.StateReconnecting)
+		wait := retry.NextBackOff()
+		log.Printf("%v, reconnecting in %s", err, wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package ssh_reverse
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is a minimal SSH server supporting remote port forwarding
+type testServer struct {
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	mu        sync.Mutex
+	conns     []*ssh.ServerConn
+	forwarded []net.Listener
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("❌ failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("❌ failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func startTestServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(newSigner(t))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("❌ failed to listen: %v", err)
+	}
+	server := &testServer{listener: listener, config: config}
+	go server.serve()
+	t.Cleanup(server.close)
+	return server
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+	go func() {
+		for newChannel := range chans {
+			newChannel.Reject(ssh.Prohibited, "only remote forwarding is supported")
+		}
+	}()
+	for req := range reqs {
+		if req.Type != "tcpip-forward" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct {
+			Address string
+			Port    uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(payload.Address, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		s.mu.Lock()
+		s.forwarded = append(s.forwarded, listener)
+		s.mu.Unlock()
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+		go s.forward(serverConn, listener, payload.Address, port)
+	}
+	s.closeForwarded()
+}
+
+func (s *testServer) forward(serverConn *ssh.ServerConn, listener net.Listener, address string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		origin := conn.RemoteAddr().(*net.TCPAddr)
+		channel, reqs, err := serverConn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+			Address    string
+			Port       uint32
+			OriginAddr string
+			OriginPort uint32
+		}{address, port, origin.IP.String(), uint32(origin.Port)}))
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			defer conn.Close()
+			defer channel.Close()
+			go io.Copy(channel, conn)
+			io.Copy(conn, channel)
+		}()
+	}
+}
+
+func (s *testServer) closeForwarded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, listener := range s.forwarded {
+		listener.Close()
+	}
+	s.forwarded = nil
+}
+
+// dropConnections closes connections of all clients like a restarted SSH server would
+func (s *testServer) dropConnections() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (s *testServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+	s.closeForwarded()
+}
+
+func newTestOptions(t *testing.T, server *testServer, signer ssh.Signer, localAddress string) Options {
+	return Options{
+		ServerAddress: server.listener.Addr().String(),
+		ClientConfig: &ssh.ClientConfig{
+			User:            "locreg",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		},
+		RemoteAddress: "127.0.0.1:0",
+		LocalAddress:  localAddress,
+	}
+}
+
+// newRegistry returns a fake registry answering to the API version check
+func newRegistry(t *testing.T) *httptest.Server {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+func checkRegistryThrough(t *testing.T, addr net.Addr) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/v2/", addr))
+	if err != nil {
+		t.Fatalf("❌ registry is not reachable through the tunnel: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Docker-Distribution-API-Version") == "" {
+		t.Fatalf("❌ unexpected response through the tunnel: %s", resp.Status)
+	}
+}
+
+func TestForward(t *testing.T) {
+	signer := newSigner(t)
+	server := startTestServer(t, signer.PublicKey())
+	registry := newRegistry(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan net.Addr, 1)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Forward(ctx, newTestOptions(t, server, signer, registry.Listener.Addr().String()), func(addr net.Addr) {
+			ready <- addr
+		})
+	}()
+
+	select {
+	case addr := <-ready:
+		checkRegistryThrough(t, addr)
+	case err := <-errs:
+		t.Fatalf("❌ forward failed: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("❌ forward was not set up in time")
+	}
+
+	cancel()
+	select {
+	case <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("❌ forward didn't stop after cancellation")
+	}
+}
+
+func TestForwardUnauthorizedKey(t *testing.T) {
+	server := startTestServer(t, newSigner(t).PublicKey())
+	err := Forward(context.Background(), newTestOptions(t, server, newSigner(t), "127.0.0.1:1"), nil)
+	if err == nil {
+		t.Fatal("❌ forward succeeded with unauthorized key")
+	}
+}
+
+func TestSuperviseReconnects(t *testing.T) {
+	signer := newSigner(t)
+	server := startTestServer(t, signer.PublicKey())
+	registry := newRegistry(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	states := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Supervise(ctx, newTestOptions(t, server, signer, registry.Listener.Addr().String()), func(state string) {
+			states <- state
+		})
+	}()
+
+	expectState := func(expected string) {
+		t.Helper()
+		select {
+		case state := <-states:
+			if state != expected {
+				t.Fatalf("❌ expected state %s, got %s", expected, state)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("❌ state %s was not reported in time", expected)
+		}
+	}
+	expectState(tunnels.StateConnected)
+	server.dropConnections()
+	expectState(tunnels.StateReconnecting)
+	expectState(tunnels.StateConnected)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("❌ supervise returned an error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("❌ supervise didn't stop after cancellation")
+	}
+}
@@ -0,0 +1,61 @@
+package ssh_reverse
+
+import (
+	"fmt"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+)
+
+const providerName = "ssh"
+
+// Provider exposes the local registry with a reverse forward to a self-hosted SSH server
+// supervised by a background locreg process
+type Provider struct{}
+
+func init() {
+	tunnels.Register(providerName, Provider{})
+}
+
+func (Provider) Start(config *parser.Config) error {
+	return RunSSHTunnel(config)
+}
+
+// Stop stops the daemon, the remote port is closed by the SSH server once the connection is closed
+func (Provider) Stop(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	return daemon.Stop(profile.Tunnel.PID)
+}
+
+// PublicURL returns the public hostname of the SSH server recorded in the profile
+func (Provider) PublicURL(_ *parser.Config) (string, error) {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return "", err
+	}
+	return profile.Tunnel.URL, nil
+}
+
+// Health checks that the daemon is running and connected and the registry is reachable through the tunnel
+func (Provider) Health(_ *parser.Config) error {
+	profile, err := loadTunnelProfile()
+	if err != nil {
+		return err
+	}
+	if err := tunnels.CheckDaemonTunnel(profile.Tunnel); err != nil {
+		return err
+	}
+	return tunnels.CheckRegistryURL(profile.Tunnel.URL)
+}
+
+func loadTunnelProfile() (*parser.Profile, error) {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil || profile.Tunnel.PID == 0 {
+		return nil, fmt.Errorf("❌ no SSH tunnel daemon found in profile")
+	}
+	return profile, nil
+}
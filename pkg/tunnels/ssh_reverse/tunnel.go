@@ -0,0 +1,148 @@
+package ssh_reverse
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/daemon"
+	"github.com/Uitware/locreg/pkg/parser"
+	"github.com/Uitware/locreg/pkg/tunnels"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// daemonName is the name of the background process supervising the tunnel
+	daemonName = "ssh-tunnel"
+	// connectTimeout is the time given to the daemon to set up the reverse forward
+	connectTimeout = 30 * time.Second
+)
+
+// DaemonArgs are the locreg arguments that run the tunnel daemon
+var DaemonArgs = []string{"tunnel", "ssh-daemon"}
+
+// RunSSHTunnel starts the daemon supervising the reverse forward and waits until it is connected
+func RunSSHTunnel(config *parser.Config) error {
+	if _, err := newOptions(config); err != nil {
+		return err
+	}
+	pid, err := daemon.Spawn(daemonName, DaemonArgs...)
+	if err != nil {
+		return err
+	}
+	url := publicURL(config)
+	if err := writeToProfile(pid, url); err != nil {
+		errorCleanup(pid)
+		return fmt.Errorf("❌ failed to write to profile: %w", err)
+	}
+	if _, err := tunnels.WaitForDaemon(pid, daemonName, connectTimeout); err != nil {
+		errorCleanup(pid)
+		return err
+	}
+	log.Printf("✅ SSH tunnel is running at %s", url)
+	return nil
+}
+
+// RunDaemon runs the reverse forward in the foreground until SIGTERM or SIGINT is received
+// and records its state in the profile
+func RunDaemon(config *parser.Config) error {
+	opts, err := newOptions(config)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	return Supervise(ctx, opts, func(state string) {
+		err := tunnels.UpdateDaemonTunnel(os.Getpid(), func(tunnel *parser.Tunnel) {
+			tunnel.State = state
+		})
+		if err != nil {
+			log.Printf("❌ failed to record tunnel state: %v", err)
+		}
+	})
+}
+
+// newOptions builds reverse forward options from the config
+func newOptions(config *parser.Config) (Options, error) {
+	sshConfig := config.Tunnel.Provider.SSH
+	if sshConfig.Host == "" || sshConfig.User == "" || sshConfig.PublicHostname == "" {
+		return Options{}, fmt.Errorf("❌ host, user and publicHostname must be specified for SSH tunnel")
+	}
+	key, err := os.ReadFile(expandHome(sshConfig.KeyPath))
+	if err != nil {
+		return Options{}, fmt.Errorf("❌ failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return Options{}, fmt.Errorf("❌ failed to parse SSH key: %w", err)
+	}
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !sshConfig.InsecureIgnoreHostKey {
+		hostKeyCallback, err = knownhosts.New(expandHome(sshConfig.KnownHostsPath))
+		if err != nil {
+			return Options{}, fmt.Errorf("❌ failed to load known hosts: %w", err)
+		}
+	}
+	return Options{
+		ServerAddress: net.JoinHostPort(sshConfig.Host, strconv.Itoa(sshConfig.Port)),
+		ClientConfig: &ssh.ClientConfig{
+			User:            sshConfig.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+		RemoteAddress: net.JoinHostPort(sshConfig.RemoteBindAddress, strconv.Itoa(sshConfig.RemotePort)),
+		LocalAddress:  net.JoinHostPort("localhost", strconv.Itoa(config.Registry.Port)),
+	}, nil
+}
+
+// publicURL returns the URL the remote port is exposed at, e.g. by a reverse proxy on the SSH server
+func publicURL(config *parser.Config) string {
+	hostname := config.Tunnel.Provider.SSH.PublicHostname
+	if strings.Contains(hostname, "://") {
+		return hostname
+	}
+	return "https://" + hostname
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
+
+// writeToProfile writes the daemon PID and tunnel URL to the profile
+func writeToProfile(pid int, url string) error {
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = &parser.Tunnel{
+			Provider: providerName,
+			URL:      url,
+			PID:      pid,
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return nil
+}
+
+func errorCleanup(pid int) {
+	if err := daemon.Stop(pid); err != nil {
+		log.Printf("❌ failed to stop SSH tunnel daemon, you will need to do this manually: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package tunnels
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// defaultProvider is used for profiles written before the tunnel provider was recorded in them
+const defaultProvider = "ngrok"
+
+// TunnelProvider is a backend that exposes the local registry to the public Internet.
+// Every backend lives in its own package and registers itself with Register from its init function,
+// the backend used is selected by the key set under `tunnel.provider` in locreg.yaml
+type TunnelProvider interface {
+	// Start creates the tunnel to the local registry and records it in the profile
+	Start(config *parser.Config) error
+	// Stop removes the tunnel recorded in the profile
+	Stop(config *parser.Config) error
+	// PublicURL returns the public URL of the running tunnel
+	PublicURL(config *parser.Config) (string, error)
+	// Health returns an error if the tunnel is down or doesn't forward traffic to the registry
+	Health(config *parser.Config) error
+}
+
+// DeployChecker is implemented by providers whose tunnels cloud runtimes can't pull through,
+// locreg deploy fails with the returned error before creating any cloud resources
+type DeployChecker interface {
+	CheckDeploy(config *parser.Config) error
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]TunnelProvider)
+)
+
+// Register makes a tunnel provider available by the provided name.
+// If Register is called twice with the same name it panics
+func Register(name string, provider TunnelProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		panic("tunnels: Register provider is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("tunnels: Register called twice for provider " + name)
+	}
+	providers[name] = provider
+}
+
+// Get returns the tunnel provider registered with the provided name
+func Get(name string) (TunnelProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("❌ unknown tunnel provider %q, available providers: %s", name, strings.Join(names(), ", "))
+	}
+	return provider, nil
+}
+
+// Names returns a sorted list of the names of the registered tunnel providers
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(providers))
+	for name := range providers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// FromConfig returns the tunnel provider specified under `tunnel.provider` in the config
+func FromConfig(config *parser.Config) (string, TunnelProvider, error) {
+	name, err := config.TunnelProviderName()
+	if err != nil {
+		return "", nil, err
+	}
+	provider, err := Get(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, provider, nil
+}
+
+// FromProfile returns the tunnel provider that created the tunnel recorded in the profile
+func FromProfile(profile *parser.Profile) (TunnelProvider, error) {
+	if profile == nil || profile.Tunnel == nil {
+		return nil, fmt.Errorf("❌ tunnel does not exist")
+	}
+	name := profile.Tunnel.Provider
+	if name == "" {
+		name = defaultProvider
+	}
+	return Get(name)
+}
+
+// CheckRegistryURL makes a request to the registry API through the tunnel URL.
+// Registry must answer either with 200 or with 401 if authentication is required
+func CheckRegistryURL(url string) error {
+	if url == "" {
+		return fmt.Errorf("❌ tunnel URL is empty")
+	}
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get(strings.TrimSuffix(url, "/") + "/v2/")
+	if err != nil {
+		return fmt.Errorf("❌ registry is not reachable through tunnel: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("❌ unexpected response from registry through tunnel: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// Watcher probes the tunnel recorded in the profile, restarts it when it stays unhealthy
+// and reports changes of its public URL
+type Watcher struct {
+	Config *parser.Config
+	// Interval is the time between health probes
+	Interval time.Duration
+	// FailureThreshold is the number of failed probes in a row after which the tunnel is restarted
+	FailureThreshold int
+	// OnURLChange is called with the new URL after it was recorded in the profile.
+	// If it returns an error it is called again after the next probe
+	OnURLChange func(url string) error
+	// OnProbe is called after every probe for periodic work like renewing credentials, its errors are logged
+	OnProbe func() error
+
+	// providerName is the provider of the watched tunnel, used to start it again if restart failed
+	providerName string
+}
+
+// Run probes the tunnel until ctx is done
+func (w *Watcher) Run(ctx context.Context) error {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil || profile.Tunnel == nil {
+		return fmt.Errorf("❌ tunnel does not exist")
+	}
+	w.providerName = profile.Tunnel.Provider
+	if w.providerName == "" {
+		w.providerName = defaultProvider
+	}
+	lastURL := profile.Tunnel.URL
+	failures := 0
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		failures = w.probe(failures)
+		if w.OnProbe != nil {
+			if err := w.OnProbe(); err != nil {
+				log.Printf("❌ %v", err)
+			}
+		}
+		profile, _ := parser.LoadProfileData()
+		if profile == nil || profile.Tunnel == nil || profile.Tunnel.URL == lastURL {
+			continue
+		}
+		log.Printf("🔄 Tunnel URL changed from %s to %s", lastURL, profile.Tunnel.URL)
+		if w.OnURLChange != nil {
+			if err := w.OnURLChange(profile.Tunnel.URL); err != nil {
+				log.Printf("❌ failed to propagate tunnel URL, will retry: %v", err)
+				continue
+			}
+		}
+		lastURL = profile.Tunnel.URL
+	}
+}
+
+// probe checks the tunnel health and returns the updated number of failed probes in a row.
+// The URL of a healthy tunnel is compared to the profile as it may change when the agent reconnects
+func (w *Watcher) probe(failures int) int {
+	profile, _ := parser.LoadProfileData()
+	if profile == nil {
+		log.Printf("❌ failed to load profile")
+		return failures
+	}
+	if profile.Tunnel == nil {
+		// Previous restart has failed after the tunnel was stopped
+		if err := w.start(); err != nil {
+			log.Printf("❌ failed to start tunnel: %v", err)
+		}
+		return 0
+	}
+	provider, err := FromProfile(profile)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return failures
+	}
+
+	if err := provider.Health(w.Config); err != nil {
+		failures++
+		log.Printf("❌ tunnel is unhealthy (%d/%d): %v", failures, w.FailureThreshold, err)
+		if failures < w.FailureThreshold {
+			return failures
+		}
+		if err := w.restart(provider); err != nil {
+			log.Printf("❌ failed to restart tunnel: %v", err)
+		}
+		return 0
+	}
+
+	url, err := provider.PublicURL(w.Config)
+	if err != nil {
+		log.Printf("❌ failed to get tunnel URL: %v", err)
+		return 0
+	}
+	if url != "" && url != profile.Tunnel.URL {
+		err := parser.Update(func(profile *parser.Profile) error {
+			if profile.Tunnel != nil {
+				profile.Tunnel.URL = url
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("❌ failed to save profile: %v", err)
+		}
+	}
+	return 0
+}
+
+// restart stops the tunnel, clears it from the profile and starts a new one
+func (w *Watcher) restart(provider TunnelProvider) error {
+	log.Printf("🔄 Restarting %s tunnel", w.providerName)
+	if err := provider.Stop(w.Config); err != nil {
+		log.Printf("❌ failed to stop tunnel, starting a new one anyway: %v", err)
+	}
+	err := parser.Update(func(profile *parser.Profile) error {
+		profile.Tunnel = nil
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("❌ failed to save profile: %w", err)
+	}
+	return w.start()
+}
+
+// start starts the tunnel with the provider of the watched tunnel
+func (w *Watcher) start() error {
+	provider, err := Get(w.providerName)
+	if err != nil {
+		return err
+	}
+	return provider.Start(w.Config)
+}
@@ -0,0 +1,108 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Uitware/locreg/pkg/parser"
+)
+
+// fakeProvider is a tunnel provider that gets a new URL on every start
+type fakeProvider struct {
+	mu      sync.Mutex
+	name    string
+	healthy bool
+	starts  int
+	url     string
+}
+
+func (p *fakeProvider) Start(_ *parser.Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+	p.url = fmt.Sprintf("https://tunnel-%d.example.com", p.starts)
+	p.healthy = true
+	profile, profilePath := parser.LoadProfileData()
+	profile.Tunnel = &parser.Tunnel{Provider: p.name, URL: p.url}
+	return parser.SaveProfile(profile, profilePath)
+}
+
+func (p *fakeProvider) Stop(_ *parser.Config) error { return nil }
+
+func (p *fakeProvider) PublicURL(_ *parser.Config) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.url, nil
+}
+
+func (p *fakeProvider) Health(_ *parser.Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.healthy {
+		return fmt.Errorf("tunnel is down")
+	}
+	return nil
+}
+
+// watchForURL runs the watcher until the first URL change is propagated
+func watchForURL(t *testing.T, provider *fakeProvider) string {
+	t.Helper()
+	profile, profilePath := parser.LoadProfileData()
+	profile.Tunnel = &parser.Tunnel{Provider: provider.name, URL: "https://tunnel-0.example.com"}
+	if err := parser.SaveProfile(profile, profilePath); err != nil {
+		t.Fatalf("❌ failed to save profile: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	urls := make(chan string, 1)
+	watcher := &Watcher{
+		Config:           &parser.Config{},
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+		OnURLChange: func(url string) error {
+			urls <- url
+			cancel()
+			return nil
+		},
+	}
+	if err := watcher.Run(ctx); err != nil {
+		t.Fatalf("❌ watcher failed: %v", err)
+	}
+	select {
+	case url := <-urls:
+		return url
+	default:
+		t.Fatal("❌ URL change was not propagated")
+		return ""
+	}
+}
+
+func TestWatcherRestartsUnhealthyTunnel(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	provider := &fakeProvider{name: "fake-restart"}
+	Register(provider.name, provider)
+
+	if url := watchForURL(t, provider); url != "https://tunnel-1.example.com" {
+		t.Errorf("❌ unexpected URL after restart: %s", url)
+	}
+	if provider.starts != 1 {
+		t.Errorf("❌ tunnel was started %d times", provider.starts)
+	}
+}
+
+func TestWatcherDetectsURLChange(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	provider := &fakeProvider{name: "fake-url-change", healthy: true, url: "https://reconnected.example.com"}
+	Register(provider.name, provider)
+
+	if url := watchForURL(t, provider); url != "https://reconnected.example.com" {
+		t.Errorf("❌ unexpected URL: %s", url)
+	}
+	if provider.starts != 0 {
+		t.Errorf("❌ healthy tunnel was restarted")
+	}
+}